@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/G1P0/pushdalek/internal/store"
+)
+
+const usage = `usage:
+  archive export [-format jsonl|csv] [-o file]   (по умолчанию jsonl в stdout)
+  archive import [-policy keep|overwrite|newest] file.jsonl   ("-" — stdin)
+
+DB_PATH — путь к базе (по умолчанию bot.db), DATABASE_URL=postgres://… — PostgreSQL`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "bot.db"
+	}
+	if u := os.Getenv("DATABASE_URL"); u != "" {
+		dbPath = u
+	}
+
+	switch os.Args[1] {
+	case "export":
+		fs := flag.NewFlagSet("export", flag.ExitOnError)
+		format := fs.String("format", "jsonl", "jsonl или csv")
+		out := fs.String("o", "", "файл (по умолчанию stdout)")
+		_ = fs.Parse(os.Args[2:])
+
+		st := openStore(dbPath)
+		defer st.Close()
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		var n int
+		var err error
+		switch *format {
+		case "jsonl":
+			n, err = st.ExportJSONL(w)
+		case "csv":
+			n, err = st.ExportCSV(w)
+		default:
+			log.Fatalf("bad -format %q\n\n%s", *format, usage)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "export ok: posts=%d format=%s db=%s\n", n, *format, dbPath)
+
+	case "import":
+		fs := flag.NewFlagSet("import", flag.ExitOnError)
+		policy := fs.String("policy", store.ConflictKeepLocal, "конфликт по vk_full_id: "+strings.Join(store.ConflictPolicies, ", "))
+		_ = fs.Parse(os.Args[2:])
+		if fs.NArg() != 1 {
+			log.Fatal(usage)
+		}
+		if !slices.Contains(store.ConflictPolicies, *policy) {
+			log.Fatalf("bad -policy %q\n\n%s", *policy, usage)
+		}
+
+		var r io.Reader = os.Stdin
+		if name := fs.Arg(0); name != "-" {
+			f, err := os.Open(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		st := openStore(dbPath)
+		defer st.Close()
+
+		res, err := st.ImportJSONL(r, *policy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stats, err := st.Stats()
+		if err != nil {
+			slog.Warn("stats", "err", err)
+		}
+		fmt.Printf("import ok: read=%d inserted=%d updated=%d unchanged=%d publications=%d tags=%d destinations=%d policy=%s stats=%v\n",
+			res.Read, res.Inserted, res.Updated, res.Unchanged, res.Publications, res.Tags, res.Destinations, *policy, stats)
+
+	default:
+		log.Fatal(usage)
+	}
+}
+
+func openStore(dsn string) store.Repository {
+	st, err := store.OpenRepository(dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return st
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	invitePrefix = "invite_"
+	inviteTTL    = 24 * time.Hour
+)
+
+// минимальная роль для команды / callback-действия.
+// всё, чего нет в списке, — только owner.
+var actionRoles = map[string]string{
+	"start":  store.RoleViewer,
+	"help":   store.RoleViewer,
+	"menu":   store.RoleViewer,
+	"noop":   store.RoleViewer,
+	"whoami": store.RoleViewer,
+	"stats":  store.RoleViewer,
+	"used":   store.RoleViewer,
+	"uopen":  store.RoleViewer,
+	"find":   store.RoleViewer,
+	"fopen":  store.RoleViewer,
+	"dupes":  store.RoleViewer,
+
+	"sync":      store.RoleEditor,
+	"next":      store.RoleEditor,
+	"next5":     store.RoleEditor,
+	"today":     store.RoleEditor,
+	"strategy":  store.RoleEditor,
+	"setnew":    store.RoleEditor,
+	"fpub":      store.RoleEditor,
+	"post":      store.RoleEditor,
+	"undo":      store.RoleEditor,
+	"recap":     store.RoleEditor,
+	"capask":    store.RoleEditor,
+	"tagask":    store.RoleEditor,
+	"captags":   store.RoleEditor,
+	"ban":       store.RoleEditor,
+	"reconcile": store.RoleEditor,
+	"unban":     store.RoleEditor,
+	"alerts":    store.RoleEditor,
+	"amute":     store.RoleEditor,
+
+	"grant":    store.RoleOwner,
+	"revoke":   store.RoleOwner,
+	"invite":   store.RoleOwner,
+	"admins":   store.RoleOwner,
+	"template": store.RoleOwner,
+	"rules":    store.RoleOwner,
+	"backup":   store.RoleOwner,
+	"restore":  store.RoleOwner,
+	"log":      store.RoleOwner,
+	"loglevel": store.RoleOwner,
+	"dest":     store.RoleOwner,
+}
+
+// access: владельцы из TG_ADMIN_IDS + админы из таблицы admins
+type access struct {
+	st     store.Repository
+	owners map[int64]struct{}
+}
+
+func newAccess(st store.Repository, owners map[int64]struct{}) *access {
+	return &access{st: st, owners: owners}
+}
+
+// role: "" — не админ
+func (a *access) role(log *slog.Logger, userID int64) string {
+	if _, ok := a.owners[userID]; ok {
+		return store.RoleOwner
+	}
+	role, err := a.st.AdminRole(userID)
+	if err != nil {
+		log.Warn("admin role lookup", "user", userID, "err", err)
+		return ""
+	}
+	return role
+}
+
+func (a *access) isEnvOwner(userID int64) bool {
+	_, ok := a.owners[userID]
+	return ok
+}
+
+func allowed(role, action string) bool {
+	need, ok := actionRoles[action]
+	if !ok {
+		need = store.RoleOwner
+	}
+	return store.RoleLevel(role) >= store.RoleLevel(need)
+}
+
+// /start invite_<token>
+func doAcceptInvite(log *slog.Logger, bot *tgbotapi.BotAPI, acc *access, chatID, userID int64, token string) {
+	role, err := acc.st.UseInvite(token, userID)
+	audit(log, acc.st, userID, chatID, "invite_accept", "", role, err)
+	if errors.Is(err, store.ErrInviteNotFound) {
+		reply(log, bot, chatID, "🚫 Приглашение недействительно или уже использовано.")
+		return
+	}
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if acc.isEnvOwner(userID) {
+		role = store.RoleOwner
+	}
+	reply(log, bot, chatID, fmt.Sprintf("✅ Доступ выдан: %s", role))
+	sendMenu(log, bot, chatID, role)
+}
+
+// /grant <user_id> <role>
+func doGrant(log *slog.Logger, bot *tgbotapi.BotAPI, acc *access, chatID, actorID int64, args string) {
+	f := strings.Fields(args)
+	if len(f) != 2 {
+		reply(log, bot, chatID, "Формат: /grant <user_id> <owner|editor|viewer>")
+		return
+	}
+	uid, err := strconv.ParseInt(f[0], 10, 64)
+	if err != nil || uid == 0 {
+		reply(log, bot, chatID, "Некорректный user_id")
+		return
+	}
+	role := strings.ToLower(f[1])
+	if !store.ValidRole(role) {
+		reply(log, bot, chatID, "Роль: owner, editor или viewer")
+		return
+	}
+	if acc.isEnvOwner(uid) {
+		reply(log, bot, chatID, "Этот пользователь — owner из TG_ADMIN_IDS, его роль меняется только через env.")
+		return
+	}
+	err = acc.st.SetAdmin(uid, role, actorID)
+	audit(log, acc.st, actorID, chatID, "grant", "", fmt.Sprintf("%d → %s", uid, role), err)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	reply(log, bot, chatID, fmt.Sprintf("✅ %d → %s", uid, role))
+}
+
+// /revoke <user_id>
+func doRevoke(log *slog.Logger, bot *tgbotapi.BotAPI, acc *access, chatID, actorID int64, args string) {
+	uid, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil || uid == 0 {
+		reply(log, bot, chatID, "Формат: /revoke <user_id>")
+		return
+	}
+	if acc.isEnvOwner(uid) {
+		reply(log, bot, chatID, "Этот пользователь — owner из TG_ADMIN_IDS, убрать его можно только через env.")
+		return
+	}
+	ok, err := acc.st.RemoveAdmin(uid)
+	audit(log, acc.st, actorID, chatID, "revoke", "", strconv.FormatInt(uid, 10), err)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if !ok {
+		reply(log, bot, chatID, fmt.Sprintf("%d и так не админ.", uid))
+		return
+	}
+	reply(log, bot, chatID, fmt.Sprintf("✅ Доступ %d отозван.", uid))
+}
+
+// /invite [role] — одноразовая ссылка, по умолчанию viewer
+func doInvite(log *slog.Logger, bot *tgbotapi.BotAPI, acc *access, chatID, actorID int64, args string) {
+	role := strings.ToLower(strings.TrimSpace(args))
+	if role == "" {
+		role = store.RoleViewer
+	}
+	if !store.ValidRole(role) {
+		reply(log, bot, chatID, "Формат: /invite [owner|editor|viewer]")
+		return
+	}
+	token, err := acc.st.CreateInvite(role, actorID, inviteTTL)
+	audit(log, acc.st, actorID, chatID, "invite", "", role, err)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	link := fmt.Sprintf("https://t.me/%s?start=%s%s", bot.Self.UserName, invitePrefix, token)
+	reply(log, bot, chatID, fmt.Sprintf("🔑 Приглашение (%s, одноразовое, %s):\n%s", role, inviteTTL, link))
+}
+
+// /admins
+func doListAdmins(log *slog.Logger, bot *tgbotapi.BotAPI, acc *access, chatID int64) {
+	list, err := acc.st.ListAdmins()
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("👥 Админы\n\n")
+	for id := range acc.owners {
+		b.WriteString(fmt.Sprintf("%d | owner (env)\n", id))
+	}
+	for _, a := range list {
+		if acc.isEnvOwner(a.UserID) {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("%d | %s | by %d\n", a.UserID, a.Role, a.AddedBy))
+	}
+	reply(log, bot, chatID, b.String())
+}
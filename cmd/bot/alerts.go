@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	"github.com/G1P0/pushdalek/internal/vk"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ops: алерты о сбоях в ops-чат (OPS_CHAT_ID); задаётся в main
+var ops *alerter
+
+// alertKeep: сколько хранить сбои в alerts
+const alertKeep = 30 * 24 * time.Hour
+
+// alerter: каждый сбой пишет в alerts и, если можно, шлёт в ops-чат.
+// Не шлёт: повтор того же сбоя по тому же посту раньше dedup, больше perHour в час,
+// заглушённый кнопкой вид. Всё подавленное видно в дайджесте.
+type alerter struct {
+	bot     *tgbotapi.BotAPI
+	st      store.Repository
+	chatID  int64 // 0 — только лог и дайджест по /alerts
+	dedup   time.Duration
+	perHour int
+
+	mu sync.Mutex
+}
+
+func newAlerter(bot *tgbotapi.BotAPI, st store.Repository, chatID int64, dedup time.Duration, perHour int) *alerter {
+	return &alerter{bot: bot, st: st, chatID: chatID, dedup: dedup, perHour: perHour}
+}
+
+// alert: сбой операции op (publish, sync, reconcile, backup, phash), vkFullID — если про пост
+func (a *alerter) alert(log *slog.Logger, op, vkFullID string, err error) {
+	if a == nil || err == nil {
+		return
+	}
+	log.Error("alert", "op", op, "vk_full_id", vkFullID, "err", err)
+
+	kind := alertKind(op, err)
+	id, reason, rerr := a.record(log, op, kind, vkFullID, err)
+	if rerr != nil {
+		log.Warn("record alert", "err", rerr)
+	}
+	if reason != "" {
+		log.Debug("alert suppressed", "kind", kind, "reason", reason)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(a.chatID, formatAlert(op, vkFullID, err))
+	if id != 0 {
+		msg.ReplyMarkup = muteKeyboard(id)
+	}
+	_, serr := a.bot.Send(msg)
+	countSend("sendMessage", serr)
+	if serr != nil {
+		log.Warn("send alert", "err", serr)
+	}
+}
+
+// record: решает, слать ли, и пишет сбой в alerts — под a.mu, чтобы dedup и лимит
+// видели предыдущий алерт; сама отправка в Telegram идёт уже без блокировки
+func (a *alerter) record(log *slog.Logger, op, kind, vkFullID string, err error) (id int64, reason string, rerr error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	reason = a.suppressed(log, kind, vkFullID, now)
+	id, rerr = a.st.RecordAlert(store.Alert{
+		At:       now.Unix(),
+		Op:       op,
+		Kind:     kind,
+		VKFullID: vkFullID,
+		Error:    err.Error(),
+		Sent:     reason == "",
+	})
+	return id, reason, rerr
+}
+
+// suppressed: почему не слать ("" — слать)
+func (a *alerter) suppressed(log *slog.Logger, kind, vkFullID string, now time.Time) string {
+	if a.chatID == 0 {
+		return "no ops chat"
+	}
+	until, err := a.st.AlertMutedUntil(kind)
+	if err != nil {
+		log.Warn("alert mute", "err", err)
+	}
+	if until > now.Unix() {
+		return "muted"
+	}
+	last, err := a.st.LastAlertSent(kind, vkFullID)
+	if err != nil {
+		log.Warn("alert dedup", "err", err)
+	}
+	if last > 0 && now.Sub(time.Unix(last, 0)) < a.dedup {
+		return "duplicate"
+	}
+	n, err := a.st.CountAlertsSent(now.Add(-time.Hour).Unix())
+	if err != nil {
+		log.Warn("alert rate", "err", err)
+	}
+	if n >= a.perHour {
+		return "rate limit"
+	}
+	return ""
+}
+
+var alertDigits = regexp.MustCompile(`\d+`)
+
+// alertKind: op и первая строка ошибки, числа заменены на N — retry after 35 и retry after 36 один вид
+func alertKind(op string, err error) string {
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	msg = alertDigits.ReplaceAllString(msg, "N")
+	if r := []rune(msg); len(r) > 200 {
+		msg = string(r[:200])
+	}
+	return op + ": " + msg
+}
+
+func formatAlert(op, vkFullID string, err error) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "🚨 Сбой: %s\n", op)
+	if vkFullID != "" {
+		fmt.Fprintf(&b, "пост: %s https://vk.com/wall%s\n", vkFullID, vkFullID)
+	}
+	fmt.Fprintf(&b, "ошибка: %s", snippet(err.Error(), 1000))
+	var vkErr *vk.Error
+	if errors.As(err, &vkErr) && vkErr.Code == vk.ErrCodeAuth {
+		b.WriteString("\n\n🔑 Похоже, VK_TOKEN истёк или отозван: обнови его и перезапусти бота.")
+	}
+	return b.String()
+}
+
+// muteKeyboard: amute:<alert_id>:<часы>
+func muteKeyboard(alertID int64) tgbotapi.InlineKeyboardMarkup {
+	row := make([]tgbotapi.InlineKeyboardButton, 0, 3)
+	for _, h := range []int{1, 8, 24} {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🔕 %dч", h), fmt.Sprintf("amute:%d:%d", alertID, h)))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+// doMuteAlert: кнопка под алертом — не слать такие сбои hours часов
+func doMuteAlert(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, msgID int, alertID int64, hours int) {
+	a, err := st.GetAlert(alertID)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if a == nil {
+		reply(log, bot, chatID, "Алерт уже удалён из журнала.")
+		return
+	}
+	until := time.Now().Add(time.Duration(hours) * time.Hour)
+	err = st.MuteAlerts(a.Kind, until.Unix())
+	audit(log, st, userID, chatID, "alert_mute", a.VKFullID, fmt.Sprintf("%s на %dч", a.Kind, hours), err)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	label := "🔕 до " + until.Format("02.01 15:04")
+	send(log, bot, tgbotapi.NewEditMessageReplyMarkup(chatID, msgID, tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, "noop")),
+	)))
+}
+
+// runDigest: каждый день в at ("09:00", часовой пояс TZ) — сводка сбоев за сутки в ops-чат;
+// заодно чистит старые записи. Пустой at или нет ops-чата — не шлём.
+func (a *alerter) runDigest(at string) {
+	if a.chatID == 0 || at == "" {
+		return
+	}
+	log := slog.With("task", "alert_digest")
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		log.Error("bad ALERT_DIGEST_AT", "value", at, "err", err)
+		return
+	}
+	for {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		time.Sleep(time.Until(next))
+
+		txt, err := alertDigest(a.st, next.AddDate(0, 0, -1))
+		if err != nil {
+			log.Error("alert digest", "err", err)
+			continue
+		}
+		msg := tgbotapi.NewMessage(a.chatID, txt)
+		_, err = a.bot.Send(msg)
+		countSend("sendMessage", err)
+		if err != nil {
+			log.Warn("send alert digest", "err", err)
+		}
+		if n, err := a.st.PruneAlerts(time.Now().Add(-alertKeep).Unix()); err != nil {
+			log.Warn("prune alerts", "err", err)
+		} else if n > 0 {
+			log.Info("prune alerts", "deleted", n)
+		}
+	}
+}
+
+// /alerts — сводка сбоев за сутки, как в ежедневном дайджесте
+func doAlerts(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64) {
+	txt, err := alertDigest(st, time.Now().AddDate(0, 0, -1))
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	reply(log, bot, chatID, txt)
+}
+
+func alertDigest(st store.Repository, since time.Time) (string, error) {
+	groups, err := st.AlertSummary(since.Unix())
+	if err != nil {
+		return "", err
+	}
+	if len(groups) == 0 {
+		return "📋 С " + since.Format("02.01 15:04") + " сбоев не было.", nil
+	}
+	total := 0
+	for _, g := range groups {
+		total += g.Count
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "📋 Сбои с %s: %d\n", since.Format("02.01 15:04"), total)
+	for i, g := range groups {
+		if i == 15 {
+			fmt.Fprintf(&b, "\n… ещё видов: %d", len(groups)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n• %s ×%d", g.Op, g.Count)
+		var notes []string
+		if g.Posts > 0 {
+			notes = append(notes, "постов "+strconv.Itoa(g.Posts))
+		}
+		if g.Sent < g.Count {
+			notes = append(notes, fmt.Sprintf("в чат ушло %d", g.Sent))
+		}
+		notes = append(notes, "последний "+time.Unix(g.LastAt, 0).Format("15:04"))
+		fmt.Fprintf(&b, " (%s)\n  %s", strings.Join(notes, ", "), snippet(g.Example, 200))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAlertKind(t *testing.T) {
+	a := alertKind("sync", errors.New("vk: retry after 35 s\nstack"))
+	b := alertKind("sync", errors.New("vk: retry after 36 s\nдругой хвост"))
+	if a != "sync: vk: retry after N s" || a != b {
+		t.Fatalf("числа и хвост после первой строки: %q, %q", a, b)
+	}
+	if k := alertKind("publish", errors.New("vk: retry after 35 s")); k == a {
+		t.Fatalf("разные op — один вид: %q", k)
+	}
+	if k := alertKind("sync", errors.New("vk: 5 flood control")); k == a {
+		t.Fatalf("разные ошибки — один вид: %q", k)
+	}
+
+	long := alertKind("sync", errors.New(strings.Repeat("ж", 500)))
+	if n := utf8.RuneCountInString(long); n != len("sync: ")+200 || !utf8.ValidString(long) {
+		t.Fatalf("длинная ошибка: %d рун, valid=%v", n, utf8.ValidString(long))
+	}
+}
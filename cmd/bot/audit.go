@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultLogPage = 10
+	maxLogPage     = 50
+)
+
+// audit: запись в журнал действий. Пишем сразу после изменения, с его ошибкой;
+// не записалось — только в лог: действие уже сделано
+func audit(log *slog.Logger, st store.Repository, userID, chatID int64, action, vkFullID, details string, err error) {
+	e := store.AuditEntry{
+		ActorID:  userID,
+		ChatID:   chatID,
+		Action:   action,
+		VKFullID: vkFullID,
+		Details:  details,
+		Result:   store.AuditOK,
+	}
+	if err != nil {
+		e.Result = err.Error()
+	}
+	if err := st.LogAction(e); err != nil {
+		log.Warn("audit", "action", action, "vk_full_id", vkFullID, "err", err)
+	}
+}
+
+// /log [N] — последние N записей журнала (по умолчанию 10), дальше кнопками
+func doLog(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, arg string) {
+	n := defaultLogPage
+	if a := strings.TrimSpace(arg); a != "" {
+		v, err := strconv.Atoi(a)
+		if err != nil || v <= 0 {
+			reply(log, bot, chatID, "Формат: /log [N]")
+			return
+		}
+		n = v
+	}
+	sendLogPage(log, bot, st, chatID, 0, 0, n)
+}
+
+// sendLogPage: log:<page>:<n>; msgID != 0 — правим сообщение со страницей
+func sendLogPage(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, msgID int, page, n int) {
+	n = min(max(n, 1), maxLogPage)
+	page = max(page, 0)
+
+	total, err := st.CountAuditLog()
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	maxPage := 0
+	if total > 0 {
+		maxPage = (total - 1) / n
+	}
+	page = min(page, maxPage)
+
+	entries, err := st.AuditLog(n, page*n)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📒 Журнал: страница %d/%d (всего %d)\n", page+1, maxPage+1, total))
+	if len(entries) == 0 {
+		b.WriteString("\nПусто.")
+	}
+	for _, e := range entries {
+		b.WriteString("\n" + formatAuditEntry(e, true))
+	}
+
+	prev := tgbotapi.NewInlineKeyboardButtonData("⬅️ Prev", fmt.Sprintf("log:%d:%d", page-1, n))
+	next := tgbotapi.NewInlineKeyboardButtonData("Next ➡️", fmt.Sprintf("log:%d:%d", page+1, n))
+	if page <= 0 {
+		prev = tgbotapi.NewInlineKeyboardButtonData("·", "noop")
+	}
+	if page >= maxPage {
+		next = tgbotapi.NewInlineKeyboardButtonData("·", "noop")
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		prev, next, tgbotapi.NewInlineKeyboardButtonData("🏠 Menu", "menu"),
+	))
+
+	if msgID != 0 {
+		edit := tgbotapi.NewEditMessageText(chatID, msgID, b.String())
+		edit.ReplyMarkup = &markup
+		send(log, bot, edit)
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, b.String())
+	msg.ReplyMarkup = markup
+	send(log, bot, msg)
+}
+
+// formatAuditEntry: "• 01-02 15:04 123 publish -1_2 pub #5 ✅"; withChat — добавить чат
+func formatAuditEntry(e store.AuditEntry, withChat bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "• %s %s %s", time.Unix(e.At, 0).Format("01-02 15:04"), formatActor(e.ActorID), e.Action)
+	if e.VKFullID != "" {
+		b.WriteString(" " + e.VKFullID)
+	}
+	if e.Details != "" {
+		b.WriteString(" " + snippet(e.Details, 60))
+	}
+	if withChat && e.ChatID != 0 {
+		fmt.Fprintf(&b, " (chat %d)", e.ChatID)
+	}
+	if e.Result == store.AuditOK {
+		b.WriteString(" ✅")
+	} else {
+		b.WriteString(" ❌ " + snippet(e.Result, 80))
+	}
+	return b.String()
+}
+
+func formatActor(userID int64) string {
+	if userID == 0 {
+		return "бот"
+	}
+	return strconv.FormatInt(userID, 10)
+}
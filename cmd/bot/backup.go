@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/backup"
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Bot API отдаёт ботам файлы не больше 20 МБ
+const maxRestoreBytes = 20 << 20
+
+const noPostgresBackup = "Бэкап и восстановление через бота — только для SQLite. Базу в PostgreSQL бэкапь pg_dump."
+
+// runBackups: бэкап по расписанию; при BACKUP_SEND — файл владельцам из TG_ADMIN_IDS в личку
+func runBackups(bot *tgbotapi.BotAPI, st store.Repository, cfg settings, owners map[int64]struct{}) {
+	if cfg.backupEvery <= 0 || cfg.postgres {
+		return
+	}
+	log := slog.With("task", "backup")
+	for range time.Tick(cfg.backupEvery) {
+		path, err := backup.Run(st, cfg.backup)
+		if err != nil {
+			ops.alert(log, "backup", "", err)
+			if path == "" {
+				continue
+			}
+		}
+		log.Info("backup", "path", path)
+
+		if !cfg.backupSend {
+			continue
+		}
+		for id := range owners {
+			if err := sendBackup(bot, id, path); err != nil {
+				log.Warn("backup send", "to", id, "err", err)
+			}
+		}
+	}
+}
+
+func sendBackup(bot *tgbotapi.BotAPI, chatID int64, path string) error {
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(path))
+	doc.Caption = fmt.Sprintf("💾 %s (схема v%d)", filepath.Base(path), store.SchemaVersion)
+	_, err := bot.Send(doc)
+	countSend("sendDocument", err)
+	return err
+}
+
+// /backup — снимок прямо сейчас, файл — в личку тому, кто попросил
+func doBackup(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, cfg settings) {
+	if cfg.postgres {
+		reply(log, bot, chatID, noPostgresBackup)
+		return
+	}
+	path, err := backup.Run(st, cfg.backup)
+	audit(log, st, userID, chatID, "backup", "", filepath.Base(path), err)
+	ops.alert(log, "backup", "", err)
+	if err != nil && path == "" {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка бэкапа: %v", err))
+		return
+	}
+	if err := sendBackup(bot, userID, path); err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("💾 Бэкап сохранён: %s\nВ личку отправить не смог (напиши боту /start в личке): %v", path, err))
+		return
+	}
+	if chatID != userID {
+		reply(log, bot, chatID, "💾 Бэкап отправил в личку.")
+	}
+}
+
+// /restore — ответом на сообщение с файлом бэкапа
+func doRestore(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, m *tgbotapi.Message, cfg settings) {
+	if cfg.postgres {
+		reply(log, bot, chatID, noPostgresBackup)
+		return
+	}
+	if m.ReplyToMessage == nil || m.ReplyToMessage.Document == nil {
+		reply(log, bot, chatID, "Пришли файл бэкапа и ответь на него командой /restore.")
+		return
+	}
+	doc := m.ReplyToMessage.Document
+	if doc.FileSize > maxRestoreBytes {
+		reply(log, bot, chatID, "Файл больше 20 МБ — Telegram не отдаст его боту. Восстанавливай вручную.")
+		return
+	}
+
+	reply(log, bot, chatID, "⏳ Скачиваю и проверяю бэкап...")
+
+	path, err := downloadDocument(bot, doc.FileID, cfg.backup.Dir)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Не скачал файл: %v", err))
+		return
+	}
+	defer os.Remove(path)
+
+	dbPath, cleanup, err := backup.Unpack(path)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Не распаковал: %v", err))
+		return
+	}
+	defer cleanup()
+
+	if _, err := store.CheckBackup(dbPath); err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("⚠️ Это не наш бэкап: %v", err))
+		return
+	}
+
+	// текущая база — на всякий случай, перед тем как её затереть
+	safety, err := backup.Run(st, cfg.backup)
+	if err != nil && safety == "" {
+		reply(log, bot, chatID, fmt.Sprintf("Не смог сохранить текущую базу перед восстановлением: %v", err))
+		return
+	}
+
+	// журнал тоже из бэкапа — запись о восстановлении делаем уже в нём
+	info, err := st.Restore(dbPath)
+	audit(log, st, userID, chatID, "restore", "", fmt.Sprintf("%s, постов %d, прежняя база %s", doc.FileName, info.Posts, filepath.Base(safety)), err)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка восстановления: %v\nБаза не изменилась.", err))
+		return
+	}
+
+	stats := loadStats(log, st)
+	reply(log, bot, chatID, fmt.Sprintf("✅ Восстановлено из бэкапа (схема v%d, постов %d).\nПрежняя база: %s\n%s",
+		info.Version, info.Posts, safety, formatStats(stats)))
+}
+
+func downloadDocument(bot *tgbotapi.BotAPI, fileID, dir string) (string, error) {
+	url, err := bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("http %d", resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, io.LimitReader(resp.Body, maxRestoreBytes+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
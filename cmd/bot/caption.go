@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// по этому тексту узнаём ответ на запрос своей подписи (ForceReply),
+// так не нужно держать состояние между апдейтами
+const captionPromptPrefix = "✍️ Новая подпись для поста "
+
+var captionPromptRe = regexp.MustCompile(`^` + captionPromptPrefix + `(-?\d+_\d+)`)
+
+// recap:<vkfullid> — перерисовать подпись текущим шаблоном
+func doRecaption(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, vkFull, archiveTag string) {
+	p, err := st.GetByVKFullID(vkFull)
+	if err != nil || p == nil {
+		reply(log, bot, chatID, "Не нашёл этот пост в БД.")
+		return
+	}
+	pubs, err := st.ActivePublications(vkFull)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	// у каждого чата может быть свой шаблон
+	byChat := map[int64]string{}
+	for _, pub := range pubs {
+		if _, ok := byChat[pub.ChatID]; !ok {
+			byChat[pub.ChatID] = renderCaption(log, st, p, pub.ChatID, archiveTag)
+		}
+	}
+	reply(log, bot, chatID, editCaptions(log, bot, st, chatID, userID, "recap", pubs, func(pub store.Publication) string { return byChat[pub.ChatID] }))
+}
+
+// capask:<vkfullid> — просим прислать подпись ответом
+func doAskCaption(log *slog.Logger, bot *tgbotapi.BotAPI, chatID int64, vkFull string) {
+	msg := tgbotapi.NewMessage(chatID, captionPromptPrefix+vkFull+
+		"\nПришли её ответом на это сообщение. Можно HTML: <b>, <i>, <a href=\"…\">.")
+	msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true, Selective: true}
+	send(log, bot, msg)
+}
+
+// captionReplyTarget: vk_full_id, если сообщение — ответ на наш запрос подписи
+func captionReplyTarget(bot *tgbotapi.BotAPI, m *tgbotapi.Message) (string, bool) {
+	r := m.ReplyToMessage
+	if r == nil || r.From == nil || r.From.ID != bot.Self.ID {
+		return "", false
+	}
+	sm := captionPromptRe.FindStringSubmatch(r.Text)
+	if sm == nil {
+		return "", false
+	}
+	return sm[1], true
+}
+
+func doManualCaption(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, vkFull, captionHTML string) {
+	captionHTML = strings.TrimSpace(captionHTML)
+	if captionHTML == "" {
+		reply(log, bot, chatID, "Пустая подпись, ничего не меняю.")
+		return
+	}
+	pubs, err := st.ActivePublications(vkFull)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	reply(log, bot, chatID, editCaptions(log, bot, st, chatID, userID, "caption", pubs, func(store.Publication) string { return captionHTML }))
+}
+
+// editCaptions: editMessageCaption для переданных публикаций поста
+func editCaptions(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, action string, pubs []store.Publication, captionFor func(store.Publication) string) string {
+	if len(pubs) == 0 {
+		return "У поста нет действующих публикаций."
+	}
+
+	edited, same := 0, 0
+	var errs []string
+	for _, pub := range pubs {
+		if len(pub.MessageIDs) == 0 {
+			continue
+		}
+		captionHTML := captionFor(pub)
+		if pub.Caption == captionHTML {
+			same++
+			continue
+		}
+
+		// подпись альбома висит на первом сообщении
+		cfg := tgbotapi.NewEditMessageCaption(pub.ChatID, pub.MessageIDs[0], captionHTML)
+		cfg.ParseMode = "HTML"
+		if _, err := bot.Request(cfg); err != nil {
+			if strings.Contains(err.Error(), "message is not modified") {
+				same++
+				continue
+			}
+			errs = append(errs, fmt.Sprintf("chat %d msg %d: %v", pub.ChatID, pub.MessageIDs[0], err))
+			continue
+		}
+
+		err := st.UpdatePublicationCaption(pub.ID, captionHTML, userID)
+		audit(log, st, userID, chatID, action, pub.VKFullID, fmt.Sprintf("pub #%d", pub.ID), err)
+		if err != nil {
+			return fmt.Sprintf("Ошибка БД: %v", err)
+		}
+		edited++
+	}
+
+	txt := fmt.Sprintf("✏️ Подпись обновлена: %d, без изменений: %d", edited, same)
+	if len(errs) > 0 {
+		txt += "\nОшибки:\n" + strings.Join(errs, "\n")
+	}
+	return txt
+}
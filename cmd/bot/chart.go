@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+)
+
+// график публикаций по дням для /stats: столбики, сетка, подписи цифрами 3×5 —
+// без шрифтов и внешних сервисов, только image/png
+
+const (
+	chartW      = 720
+	chartH      = 320
+	chartLeft   = 44
+	chartRight  = 12
+	chartTop    = 16
+	chartBottom = 28
+	glyphScale  = 2
+)
+
+var (
+	chartBG   = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartAxis = color.RGBA{0x55, 0x55, 0x55, 0xff}
+	chartGrid = color.RGBA{0xe4, 0xe4, 0xe4, 0xff}
+	chartBar  = color.RGBA{0x3b, 0x82, 0xc4, 0xff}
+	chartLast = color.RGBA{0xf0, 0x8c, 0x2e, 0xff} // сегодня
+	chartText = color.RGBA{0x33, 0x33, 0x33, 0xff}
+)
+
+// glyphs: цифры и точка 3×5, строки сверху вниз
+var glyphs = map[rune][5]string{
+	'0': {"111", "101", "101", "101", "111"},
+	'1': {"010", "110", "010", "010", "111"},
+	'2': {"111", "001", "111", "100", "111"},
+	'3': {"111", "001", "111", "001", "111"},
+	'4': {"101", "101", "111", "001", "001"},
+	'5': {"111", "100", "111", "001", "111"},
+	'6': {"111", "100", "111", "101", "111"},
+	'7': {"111", "001", "001", "001", "001"},
+	'8': {"111", "101", "111", "101", "111"},
+	'9': {"111", "101", "111", "001", "111"},
+	'.': {"000", "000", "000", "000", "010"},
+}
+
+// renderDailyChart: PNG со столбиком на каждый день; days — подряд, без пропусков (fillDays)
+func renderDailyChart(days []store.DayCount) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartW, chartH))
+	draw.Draw(img, img.Bounds(), &image.Uniform{chartBG}, image.Point{}, draw.Src)
+
+	maxV := 0
+	for _, d := range days {
+		maxV = max(maxV, d.Count)
+	}
+	step := gridStep(maxV)
+	top := max((maxV+step-1)/step*step, step)
+
+	plotW := chartW - chartLeft - chartRight
+	plotH := chartH - chartTop - chartBottom
+	y := func(v int) int { return chartTop + plotH - v*plotH/top }
+
+	// сетка и подписи оси Y
+	for v := 0; v <= top; v += step {
+		fillRect(img, chartLeft, y(v), chartLeft+plotW, y(v)+1, chartGrid)
+		label := strconv.Itoa(v)
+		drawText(img, chartLeft-6-textWidth(label), y(v)-5*glyphScale/2, label, chartText)
+	}
+
+	if len(days) > 0 {
+		slot := plotW / len(days)
+		gap := max(slot/5, 1)
+		for i, d := range days {
+			x0 := chartLeft + i*slot + gap
+			x1 := chartLeft + (i+1)*slot - gap
+			c := chartBar
+			if i == len(days)-1 {
+				c = chartLast
+			}
+			if d.Count > 0 {
+				fillRect(img, x0, y(d.Count), x1, y(0), c)
+			}
+			// дата под каждым седьмым днём, считая от последнего
+			if (len(days)-1-i)%7 == 0 {
+				label := d.Day
+				if t, err := time.Parse("2006-01-02", d.Day); err == nil {
+					label = t.Format("02.01")
+				}
+				drawText(img, (x0+x1)/2-textWidth(label)/2, chartTop+plotH+8, label, chartText)
+			}
+		}
+	}
+
+	// оси
+	fillRect(img, chartLeft, chartTop, chartLeft+1, chartTop+plotH+1, chartAxis)
+	fillRect(img, chartLeft, chartTop+plotH, chartLeft+plotW, chartTop+plotH+1, chartAxis)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gridStep: 1, 2, 5, 10, 20, 50… — чтобы линий сетки было не больше пяти
+func gridStep(maxV int) int {
+	for step := 1; ; step *= 10 {
+		for _, k := range []int{1, 2, 5} {
+			if maxV <= 5*k*step {
+				return k * step
+			}
+		}
+	}
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	draw.Draw(img, image.Rect(x0, y0, x1, y1), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func drawText(img *image.RGBA, x, y int, s string, c color.Color) {
+	for _, r := range s {
+		g, ok := glyphs[r]
+		if !ok {
+			x += 4 * glyphScale
+			continue
+		}
+		for row, line := range g {
+			for col, px := range line {
+				if px == '1' {
+					fillRect(img, x+col*glyphScale, y+row*glyphScale, x+(col+1)*glyphScale, y+(row+1)*glyphScale, c)
+				}
+			}
+		}
+		x += 4 * glyphScale
+	}
+}
+
+func textWidth(s string) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (4*n - 1) * glyphScale
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatQueue: id назначения этого чата, 0 — чат не назначение и живёт общей очередью
+func chatQueue(log *slog.Logger, st store.Repository, chatID int64) int64 {
+	d, err := st.DestinationByChat(chatID)
+	if err != nil {
+		log.Warn("destination by chat", "chat", chatID, "err", err)
+		return 0
+	}
+	if d == nil {
+		return 0
+	}
+	return d.ID
+}
+
+// loadChatStats: статусы в очереди чата — его назначения или общие
+func loadChatStats(log *slog.Logger, st store.Repository, chatID int64) map[string]int {
+	dest := chatQueue(log, st, chatID)
+	if dest == 0 {
+		return loadStats(log, st)
+	}
+	stats, err := st.DestStats(dest)
+	if err != nil {
+		log.Warn("destination stats", "dest", dest, "err", err)
+	}
+	return stats
+}
+
+// chatPost: пост со статусом в очереди этого чата — для карточек и подтверждения повтора
+func chatPost(log *slog.Logger, st store.Repository, chatID int64, vkFullID string) (*store.Post, error) {
+	if dest := chatQueue(log, st, chatID); dest != 0 {
+		return st.GetDestPost(dest, vkFullID)
+	}
+	return st.GetByVKFullID(vkFullID)
+}
+
+// findDestination: по имени (можно с @) или id; nil, nil если нет
+func findDestination(st store.Repository, ref string) (*store.Destination, error) {
+	ref = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ref), "@"))
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		return st.GetDestination(id)
+	}
+	list, err := st.ListDestinations()
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Name == ref {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
+
+const destHelp = `/dest — список назначений
+/dest add <chat_id|here> <имя> — новое назначение (чат, куда бот публикует)
+/dest del <имя>
+/dest on|off <имя> — включить / приостановить
+/dest schedule <имя> <09:00,18:30|off> — автопубликация по расписанию (TZ)
+/dest template <имя> <scope|reset> — шаблон подписи (scope как в /template)
+/next @имя [#тег] — опубликовать в назначение отсюда`
+
+// /dest [add | del | on | off | schedule | template] — назначения публикаций
+func doDest(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, args string) {
+	f := strings.Fields(args)
+	if len(f) == 0 || f[0] == "list" {
+		sendDestinations(log, bot, st, chatID)
+		return
+	}
+	sub := strings.ToLower(f[0])
+
+	if sub == "add" {
+		if len(f) < 3 {
+			reply(log, bot, chatID, "Формат: /dest add <chat_id|here> <имя>")
+			return
+		}
+		target := chatID
+		if f[1] != "here" {
+			id, err := strconv.ParseInt(f[1], 10, 64)
+			if err != nil {
+				reply(log, bot, chatID, "chat_id — число (для канала обычно -100…), или here")
+				return
+			}
+			target = id
+		}
+		d, err := st.AddDestination(store.Destination{ChatID: target, Name: f[2], CreatedBy: userID})
+		audit(log, st, userID, chatID, "dest", "", fmt.Sprintf("add %s %d", f[2], target), err)
+		if errors.Is(err, store.ErrDestinationExists) {
+			reply(log, bot, chatID, "Такое назначение уже есть: этот чат или это имя заняты.")
+			return
+		}
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Не получилось: %v", err))
+			return
+		}
+		reply(log, bot, chatID, fmt.Sprintf("✅ Назначение %s → %d. Публиковать: /next @%s (бот должен быть админом чата)\n%s",
+			d.Name, d.ChatID, d.Name, formatStats(loadChatStats(log, st, d.ChatID))))
+		return
+	}
+
+	if len(f) < 2 {
+		reply(log, bot, chatID, destHelp)
+		return
+	}
+	d, err := findDestination(st, f[1])
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if d == nil {
+		reply(log, bot, chatID, "Нет такого назначения. Список: /dest")
+		return
+	}
+	rest := strings.Join(f[2:], " ")
+
+	switch sub {
+	case "del":
+		err := st.DeleteDestination(d.ID)
+		audit(log, st, userID, chatID, "dest", "", "del "+d.Name, err)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+		reply(log, bot, chatID, fmt.Sprintf("🗑 Назначение %s удалено, его статусы постов — тоже. История публикаций осталась.", d.Name))
+		return
+
+	case "on", "off":
+		d.Enabled = sub == "on"
+
+	case "schedule":
+		if rest == "" {
+			reply(log, bot, chatID, "Формат: /dest schedule <имя> <09:00,18:30|off>")
+			return
+		}
+		if rest == "off" {
+			rest = ""
+		}
+		d.Schedule = rest
+
+	case "template":
+		switch {
+		case rest == "":
+			reply(log, bot, chatID, "Формат: /dest template <имя> <scope|reset>\nScope: default | source:<owner_id> | chat:<chat_id>")
+			return
+		case rest == "reset":
+			d.Template = ""
+		default:
+			scope, ok := normalizeTemplateScope(rest, d.ChatID)
+			if !ok {
+				reply(log, bot, chatID, "Scope: default | source:<owner_id> | chat:<chat_id> | here (чат назначения)")
+				return
+			}
+			d.Template = scope
+		}
+
+	default:
+		reply(log, bot, chatID, destHelp)
+		return
+	}
+
+	err = st.UpdateDestination(*d)
+	audit(log, st, userID, chatID, "dest", "", fmt.Sprintf("%s %s %s", sub, d.Name, rest), err)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Не получилось: %v", err))
+		return
+	}
+	if d, err = st.GetDestination(d.ID); err != nil || d == nil {
+		reply(log, bot, chatID, "✅ Сохранено.")
+		return
+	}
+	reply(log, bot, chatID, "✅ "+formatDestination(log, st, *d))
+}
+
+func sendDestinations(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64) {
+	list, err := st.ListDestinations()
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	var b strings.Builder
+	b.WriteString("📍 Назначения\n\n")
+	if len(list) == 0 {
+		b.WriteString("Нет: каждый чат публикует из общей очереди.\n")
+	}
+	for _, d := range list {
+		b.WriteString("• " + formatDestination(log, st, d) + "\n")
+	}
+	b.WriteString("\n" + destHelp)
+	reply(log, bot, chatID, b.String())
+}
+
+// formatDestination: "main → -100123, 09:00,18:00 · Статы: new=… used=…"
+func formatDestination(log *slog.Logger, st store.Repository, d store.Destination) string {
+	txt := fmt.Sprintf("%s → %d", d.Name, d.ChatID)
+	if !d.Enabled {
+		txt += " ⏸ выключено"
+	}
+	if d.Schedule != "" {
+		txt += ", по расписанию " + d.Schedule
+	}
+	if d.Template != "" {
+		txt += ", шаблон " + d.Template
+	}
+	stats, err := st.DestStats(d.ID)
+	if err != nil {
+		log.Warn("destination stats", "dest", d.ID, "err", err)
+	}
+	return txt + "\n  " + formatStats(stats)
+}
+
+// formatDestinationsStats: строки для /stats, "" — назначений нет
+func formatDestinationsStats(log *slog.Logger, st store.Repository) string {
+	list, err := st.ListDestinations()
+	if err != nil {
+		log.Warn("destinations", "err", err)
+		return ""
+	}
+	if len(list) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n📍 По назначениям:")
+	for _, d := range list {
+		stats, err := st.DestStats(d.ID)
+		if err != nil {
+			log.Warn("destination stats", "dest", d.ID, "err", err)
+		}
+		fmt.Fprintf(&b, "\n• %s: new=%d used=%d", d.Name, stats["new"], stats["used"])
+		if !d.Enabled {
+			b.WriteString(" ⏸")
+		}
+	}
+	return b.String()
+}
+
+// runSchedules: раз в минуту для каждого включённого назначения берёт последний
+// слот расписания (TZ) и, если он ещё не отработан, забирает его в БД
+// (ClaimScheduleSlot) и публикует один пост. Слот в БД, а не в памяти: после
+// рестарта догоняем последний пропущенный слот (один, не все), а из нескольких
+// реплик публикует та, что забрала слот первой.
+func runSchedules(bot *tgbotapi.BotAPI, st store.Repository, cfg settings) {
+	log := slog.With("task", "schedule")
+	for {
+		now := time.Now()
+		list, err := st.ListDestinations()
+		if err != nil {
+			ops.alert(log, "schedule", "", err)
+		}
+		for _, d := range list {
+			slot := store.ScheduleSlot(d.Schedule, now)
+			if !d.Enabled || slot == "" || slot <= d.LastSlot {
+				continue
+			}
+			ok, err := st.ClaimScheduleSlot(d.ID, slot)
+			if err != nil {
+				ops.alert(log, "schedule", "", fmt.Errorf("%s: %w", d.Name, err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			log.Info("schedule slot", "dest", d.Name, "slot", slot)
+			publishScheduled(log, bot, st, cfg, d)
+		}
+
+		now = time.Now()
+		time.Sleep(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+	}
+}
+
+// publishScheduled: следующий пост в назначение от имени бота (user_id 0)
+func publishScheduled(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, cfg settings, d store.Destination) {
+	p, by, err := nextSelector(log, st, cfg, d.ChatID, "").Pick()
+	if err != nil {
+		ops.alert(log, "schedule", "", fmt.Errorf("%s: %w", d.Name, err))
+		return
+	}
+	if p == nil {
+		ops.alert(log, "schedule", "", fmt.Errorf("%s: queue is empty", d.Name))
+		return
+	}
+	if pubID, ok := publishTo(log, bot, st, 0, d.ChatID, 0, cfg.archiveTag, p); ok {
+		log.Info("scheduled publish", "dest", d.Name, "vk_full_id", p.VKFullID, "by", by, "pub", pubID)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/G1P0/pushdalek/internal/phash"
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// hashing: не запускаем второй проход хэширования, пока идёт первый
+var hashing atomic.Bool
+
+// hashThumbs: досчитывает перцептивные хэши новых превью, в фоне после sync/сверки
+func hashThumbs(st store.Repository) {
+	if !hashing.CompareAndSwap(false, true) {
+		return
+	}
+	defer hashing.Store(false)
+	log := slog.With("task", "phash")
+
+	hashed, failed, err := st.HashPendingThumbs(phash.NewFetcher().Hash)
+	if err != nil {
+		ops.alert(log, "phash", "", err)
+		return
+	}
+	if hashed+failed > 0 {
+		log.Info("phash", "hashed", hashed, "failed", failed)
+	}
+}
+
+// /dupes [N] — группы постов с похожими фото
+func doDupes(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, arg string) {
+	limit := 10
+	if v, err := strconv.Atoi(strings.TrimSpace(arg)); err == nil && v > 0 {
+		limit = min(v, 30)
+	}
+
+	clusters, err := st.DupeClusters(limit)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if len(clusters) == 0 {
+		txt := "Дублей не нашёл."
+		if hashing.Load() {
+			txt += " Хэши ещё считаются, попробуй позже."
+		}
+		reply(log, bot, chatID, txt)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("🪞 Похожие посты (по фото):\n")
+	for i, c := range clusters {
+		fmt.Fprintf(&b, "\n%d)", i+1)
+		for _, p := range c.Posts {
+			fmt.Fprintf(&b, "\n   %s — %s", p.VKFullID, p.Status)
+		}
+	}
+	b.WriteString("\n\nОпубликованный пост помечает похожие new как duplicate. Опубликовать всё равно: /post <id>, убрать совсем: /ban <id>")
+	reply(log, bot, chatID, b.String())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// logLevel: уровень логов; LOG_LEVEL при старте, /loglevel — на ходу
+var logLevel = new(slog.LevelVar)
+
+// setupLogging: LOG_FORMAT=text|json, LOG_LEVEL=debug|info|warn|error.
+// slog становится логгером по умолчанию, туда же уходит и log библиотек.
+func setupLogging(format, level string) error {
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("bad LOG_LEVEL: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: logLevel}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("bad LOG_FORMAT %q: want text or json", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// fatal: ошибка при старте — в лог и выход
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// beginUpdate: логгер апдейта (req, user_id, chat_id, command) — его обработчики
+// получают параметром log и передают дальше; done() — по окончании обработки.
+// Фоновые задачи (сверка, расписание, бэкапы, хэши) заводят свой slog.With("task", …).
+func beginUpdate(upd tgbotapi.Update) (log *slog.Logger, done func()) {
+	var userID, chatID int64
+	command := ""
+	switch {
+	case upd.CallbackQuery != nil:
+		userID = upd.CallbackQuery.From.ID
+		if m := upd.CallbackQuery.Message; m != nil {
+			chatID = m.Chat.ID
+		}
+		command = "cb:" + strings.SplitN(upd.CallbackQuery.Data, ":", 2)[0]
+	case upd.Message != nil:
+		if upd.Message.From != nil {
+			userID = upd.Message.From.ID
+		}
+		chatID = upd.Message.Chat.ID
+		command = "text"
+		if upd.Message.IsCommand() {
+			command = "/" + upd.Message.Command()
+		}
+	}
+
+	log = slog.With("req", upd.UpdateID, "user_id", userID, "chat_id", chatID, "command", command)
+	start := time.Now()
+	log.Debug("update")
+	return log, func() {
+		log.Debug("update done", "dur", time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// send: bot.Send, когда ответ не нужен; ошибку — в лог
+func send(log *slog.Logger, bot *tgbotapi.BotAPI, c tgbotapi.Chattable) {
+	if _, err := bot.Send(c); err != nil {
+		log.Warn("telegram send", "err", err)
+	}
+}
+
+// loadStats: st.Stats() для строки «Статы: …»; ошибка — в лог, строка будет с нулями
+func loadStats(log *slog.Logger, st store.Repository) map[string]int {
+	stats, err := st.Stats()
+	if err != nil {
+		log.Warn("stats", "err", err)
+	}
+	return stats
+}
+
+// /loglevel [debug|info|warn|error] — показать или сменить уровень логов до перезапуска
+func doLogLevel(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, arg string) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		reply(log, bot, chatID, fmt.Sprintf("Уровень логов: %s\nСменить: /loglevel debug|info|warn|error", logLevel.Level()))
+		return
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(arg)); err != nil {
+		reply(log, bot, chatID, "Уровень: debug, info, warn или error")
+		return
+	}
+	prev := logLevel.Level()
+	logLevel.Set(lvl)
+	audit(log, st, userID, chatID, "loglevel", "", fmt.Sprintf("%s → %s", prev, lvl), nil)
+	log.Info("log level changed", "from", prev, "to", lvl, "by", userID)
+	reply(log, bot, chatID, fmt.Sprintf("✅ Уровень логов: %s (до перезапуска, потом — LOG_LEVEL)", lvl))
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"fmt"
 	"html"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/G1P0/pushdalek/internal/backup"
 	"github.com/G1P0/pushdalek/internal/store"
 	"github.com/G1P0/pushdalek/internal/vk"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -18,160 +21,386 @@ const (
 	perPageUsed = 10
 )
 
+// settings: всё, что читаем из env при старте и раздаём обработчикам
+type settings struct {
+	vkToken    string
+	vkOwner    string
+	archiveTag string
+	undoWindow time.Duration
+
+	// стратегия /next по умолчанию (store.SelectorNames), чат может переопределить через /strategy
+	nextMode    string
+	todayWindow int
+
+	// как часто сверять базу с VK (удалённые и поправленные посты), 0 — не сверять
+	reconcileEvery time.Duration
+
+	// бэкапы: куда и сколько хранить, как часто (0 — только /backup), слать ли владельцам
+	backup      backup.Config
+	backupEvery time.Duration
+	backupSend  bool
+	postgres    bool // бэкапы и /restore — только для SQLite
+}
+
 func main() {
+	// логи: LOG_FORMAT=text|json, LOG_LEVEL=debug|info|warn|error (на ходу — /loglevel)
+	if err := setupLogging(os.Getenv("LOG_FORMAT"), getenvDefault("LOG_LEVEL", "info")); err != nil {
+		fatal("logging", "err", err)
+	}
+
 	// --- env ---
 	tgToken := mustEnv("TG_BOT_TOKEN")
 	vkToken := mustEnv("VK_TOKEN")
 	vkOwner := mustEnv("VK_OWNER_ID")
 
 	dbPath := getenvDefault("DB_PATH", "bot.db")
+	// DATABASE_URL=postgres://… — PostgreSQL вместо файла SQLite
+	dsn := getenvDefault("DATABASE_URL", dbPath)
 
-	// админы: TG_ADMIN_IDS=123,456,789
+	// владельцы: TG_ADMIN_IDS=123,456,789 (остальные админы — в БД, см. /grant и /invite)
 	adminIDs := parseAdminIDs(os.Getenv("TG_ADMIN_IDS"))
-	log.Printf("admins loaded: %d", len(adminIDs))
+	slog.Info("owners loaded", "count", len(adminIDs))
 
 	// тег: ARCHIVE_TAG=#матрица (или ARCHIVE_TAG=матрица)
 	archiveTag := normalizeTag(getenvDefault("ARCHIVE_TAG", "#архив"))
-	log.Printf("archive tag: %s", archiveTag)
+	slog.Info("archive tag", "tag", archiveTag)
+
+	// окно для /undo: телеграм даёт боту удалять сообщения только первые 48ч
+	undoWindow, err := time.ParseDuration(getenvDefault("UNDO_WINDOW", "48h"))
+	if err != nil {
+		fatal("bad UNDO_WINDOW", "err", err)
+	}
+
+	// стратегия выбора для /next, например NEXT_MODE=today («в этот день»)
+	nextMode := getenvDefault("NEXT_MODE", store.SelectRandom)
+	if !slices.Contains(store.SelectorNames, nextMode) {
+		fatal("bad NEXT_MODE", "value", nextMode, "want", strings.Join(store.SelectorNames, ", "))
+	}
+	todayWindow, err := strconv.Atoi(getenvDefault("ONTHISDAY_WINDOW", "3"))
+	if err != nil || todayWindow < 0 {
+		fatal("bad ONTHISDAY_WINDOW", "value", os.Getenv("ONTHISDAY_WINDOW"))
+	}
+
+	reconcileEvery, err := time.ParseDuration(getenvDefault("RECONCILE_EVERY", "6h"))
+	if err != nil {
+		fatal("bad RECONCILE_EVERY", "err", err)
+	}
+
+	backupEvery, err := time.ParseDuration(getenvDefault("BACKUP_EVERY", "24h"))
+	if err != nil {
+		fatal("bad BACKUP_EVERY", "err", err)
+	}
+	backupKeep, err := strconv.Atoi(getenvDefault("BACKUP_KEEP", "7"))
+	if err != nil {
+		fatal("bad BACKUP_KEEP", "err", err)
+	}
+	backupGzip, err := strconv.ParseBool(getenvDefault("BACKUP_GZIP", "true"))
+	if err != nil {
+		fatal("bad BACKUP_GZIP", "err", err)
+	}
+	backupSend, err := strconv.ParseBool(getenvDefault("BACKUP_SEND", "false"))
+	if err != nil {
+		fatal("bad BACKUP_SEND", "err", err)
+	}
+
+	// HTTP_ADDR=:8080 — /healthz, /readyz и /metrics; пусто — не слушаем
+	httpAddr := os.Getenv("HTTP_ADDR")
+
+	// алерты о сбоях: OPS_CHAT_ID — куда (0 — только лог), повтор не чаще ALERT_DEDUP,
+	// не больше ALERT_MAX_PER_HOUR в час, сводка каждый день в ALERT_DIGEST_AT (пусто — без сводки)
+	opsChatID, err := strconv.ParseInt(getenvDefault("OPS_CHAT_ID", "0"), 10, 64)
+	if err != nil {
+		fatal("bad OPS_CHAT_ID", "err", err)
+	}
+	alertDedup, err := time.ParseDuration(getenvDefault("ALERT_DEDUP", "1h"))
+	if err != nil {
+		fatal("bad ALERT_DEDUP", "err", err)
+	}
+	alertPerHour, err := strconv.Atoi(getenvDefault("ALERT_MAX_PER_HOUR", "20"))
+	if err != nil || alertPerHour < 1 {
+		fatal("bad ALERT_MAX_PER_HOUR", "value", os.Getenv("ALERT_MAX_PER_HOUR"))
+	}
+	alertDigestAt := strings.TrimSpace(getenvDefault("ALERT_DIGEST_AT", "09:00"))
+	if strings.EqualFold(alertDigestAt, "off") {
+		alertDigestAt = ""
+	}
+	if alertDigestAt != "" {
+		if _, err := time.Parse("15:04", alertDigestAt); err != nil {
+			fatal("bad ALERT_DIGEST_AT", "err", err)
+		}
+	}
+
+	cfg := settings{
+		vkToken:        vkToken,
+		vkOwner:        vkOwner,
+		archiveTag:     archiveTag,
+		undoWindow:     undoWindow,
+		nextMode:       nextMode,
+		todayWindow:    todayWindow,
+		reconcileEvery: reconcileEvery,
+
+		backup: backup.Config{
+			Dir:  getenvDefault("BACKUP_DIR", filepath.Join(filepath.Dir(dbPath), "backups")),
+			Keep: backupKeep,
+			Gzip: backupGzip,
+		},
+		backupEvery: backupEvery,
+		backupSend:  backupSend,
+		postgres:    store.IsPostgresDSN(dsn),
+	}
 
 	// --- tg bot ---
 	bot, err := tgbotapi.NewBotAPI(tgToken)
 	if err != nil {
-		log.Fatal(err)
+		fatal("telegram", "err", err)
 	}
 	bot.Debug = false
-	log.Printf("Bot started as %s", bot.Self.UserName)
+	slog.Info("bot started", "username", bot.Self.UserName)
 
 	// --- store ---
-	st, err := store.Open(dbPath)
+	st, err := store.OpenRepository(dsn)
 	if err != nil {
-		log.Fatal(err)
+		fatal("open store", "err", err)
 	}
 	defer st.Close()
 
+	acc := newAccess(st, adminIDs)
+	h := newHealth(st)
+	ops = newAlerter(bot, st, opsChatID, alertDedup, alertPerHour)
+	go ops.runDigest(alertDigestAt)
+
+	go runReconciler(bot, st, cfg, adminIDs)
+	go runSchedules(bot, st, cfg)
+	go runBackups(bot, st, cfg, adminIDs)
+
 	// --- updates loop ---
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
-	updates := bot.GetUpdatesChan(u)
+	updates := pollUpdates(bot, u, h)
+
+	go serveHTTP(httpAddr, h)
 
 	for upd := range updates {
-		// callbacks (кнопки)
-		if upd.CallbackQuery != nil {
-			handleCallback(bot, st, upd.CallbackQuery, adminIDs, vkToken, vkOwner, archiveTag)
-			continue
-		}
+		log, done := beginUpdate(upd)
+		handleUpdate(log, bot, st, upd, acc, cfg)
+		done()
+	}
+}
 
-		// обычные сообщения
-		if upd.Message == nil {
-			continue
+func handleUpdate(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, upd tgbotapi.Update, acc *access, cfg settings) {
+	// callbacks (кнопки)
+	if upd.CallbackQuery != nil {
+		handleCallback(log, bot, st, upd.CallbackQuery, acc, cfg)
+		return
+	}
+
+	// обычные сообщения
+	if upd.Message == nil {
+		return
+	}
+
+	chatID := upd.Message.Chat.ID
+	userID := int64(upd.Message.From.ID)
+
+	// /whoami доступна всем
+	if upd.Message.IsCommand() && upd.Message.Command() == "whoami" {
+		reply(log, bot, chatID, fmt.Sprintf("user_id=%d\nchat_id=%d", userID, chatID))
+		return
+	}
+
+	// приглашение: /start invite_<token>
+	if upd.Message.IsCommand() && upd.Message.Command() == "start" {
+		if a := strings.TrimSpace(upd.Message.CommandArguments()); strings.HasPrefix(a, invitePrefix) {
+			doAcceptInvite(log, bot, acc, chatID, userID, strings.TrimPrefix(a, invitePrefix))
+			return
 		}
+	}
 
-		chatID := upd.Message.Chat.ID
-		userID := int64(upd.Message.From.ID)
+	role := acc.role(log, userID)
 
-		// /whoami доступна всем
-		if upd.Message.IsCommand() && upd.Message.Command() == "whoami" {
-			reply(bot, chatID, fmt.Sprintf("user_id=%d\nchat_id=%d", userID, chatID))
-			continue
+	// start/help тоже доступен всем, но меню показываем только админам
+	if upd.Message.IsCommand() && (upd.Message.Command() == "start" || upd.Message.Command() == "help") {
+		if role != "" {
+			sendMenu(log, bot, chatID, role)
+		} else {
+			reply(log, bot, chatID, "🚫 Нет доступа.\nСделай /whoami и попроси владельца бота выдать доступ (/grant или ссылка-приглашение).")
 		}
+		return
+	}
 
-		// start/help тоже доступен всем, но меню показываем только админам
-		if upd.Message.IsCommand() && (upd.Message.Command() == "start" || upd.Message.Command() == "help") {
-			if isAdmin(adminIDs, userID) {
-				sendMenu(bot, chatID)
-			} else {
-				reply(bot, chatID, "🚫 Нет доступа.\nСделай /whoami и добавь свой user_id в TG_ADMIN_IDS, потом перезапусти бота.")
-			}
-			continue
+	// команды кроме /whoami — только админы с подходящей ролью
+	if upd.Message.IsCommand() && !allowed(role, upd.Message.Command()) {
+		reply(log, bot, chatID, "🚫 Нет доступа")
+		return
+	}
+
+	if !upd.Message.IsCommand() {
+		// ответ на запрос своей подписи
+		if vkFull, ok := captionReplyTarget(bot, upd.Message); ok && allowed(role, "capask") {
+			doManualCaption(log, bot, st, chatID, userID, vkFull, upd.Message.Text)
 		}
+		// ответ на запрос тегов
+		if vkFull, ok := tagsReplyTarget(bot, upd.Message); ok && allowed(role, "tagask") {
+			doEditTags(log, bot, st, chatID, userID, vkFull, upd.Message.Text)
+		}
+		return
+	}
 
-		// команды кроме /whoami — только админы
-		if upd.Message.IsCommand() && !isAdmin(adminIDs, userID) {
-			reply(bot, chatID, "🚫 Нет доступа")
-			continue
+	switch upd.Message.Command() {
+	case "start", "help":
+		sendMenu(log, bot, chatID, role)
+
+	case "sync":
+		doSync(log, bot, st, chatID, userID, cfg.vkToken, cfg.vkOwner)
+		sendMenu(log, bot, chatID, role)
+
+	case "next", "next5":
+		// /next #tag — только посты с этим тегом; /next @имя — в назначение, а не в этот чат
+		to, tag, ok := parseNextArgs(log, bot, st, chatID, upd.Message.CommandArguments())
+		if !ok {
+			return
+		}
+		n := 1
+		if upd.Message.Command() == "next5" {
+			n = 5
 		}
+		doNext(log, bot, st, chatID, to, userID, cfg.archiveTag, nextTagSelector(log, st, cfg, to, tag), n)
+		sendNextMenu(log, bot, chatID, role, tag)
 
-		if !upd.Message.IsCommand() {
-			continue
+	case "used":
+		page := 0
+		if a := strings.TrimSpace(upd.Message.CommandArguments()); a != "" {
+			if n, err := strconv.Atoi(a); err == nil && n >= 0 {
+				page = n
+			}
 		}
+		sendUsedPage(log, bot, st, chatID, 0, page)
 
-		switch upd.Message.Command() {
-		case "start", "help":
-			sendMenu(bot, chatID)
+	case "grant":
+		doGrant(log, bot, acc, chatID, userID, upd.Message.CommandArguments())
 
-		case "sync":
-			doSync(bot, st, chatID, vkToken, vkOwner)
-			sendMenu(bot, chatID)
+	case "revoke":
+		doRevoke(log, bot, acc, chatID, userID, upd.Message.CommandArguments())
 
-		case "next":
-			doNext(bot, st, chatID, archiveTag, 1)
-			sendMenu(bot, chatID)
+	case "invite":
+		doInvite(log, bot, acc, chatID, userID, upd.Message.CommandArguments())
 
-		case "next5":
-			doNext(bot, st, chatID, archiveTag, 5)
-			sendMenu(bot, chatID)
+	case "admins":
+		doListAdmins(log, bot, acc, chatID)
 
-		case "used":
-			page := 0
-			if a := strings.TrimSpace(upd.Message.CommandArguments()); a != "" {
-				if n, err := strconv.Atoi(a); err == nil && n >= 0 {
-					page = n
-				}
-			}
-			sendUsedPage(bot, st, chatID, 0, page)
+	case "find":
+		doFind(log, bot, st, chatID, upd.Message.CommandArguments())
 
-		default:
-			reply(bot, chatID, "Не знаю такую команду. Жми Menu или /help")
-		}
+	case "post":
+		doPostByID(log, bot, st, chatID, upd.Message.CommandArguments(), cfg.vkToken, cfg.vkOwner, role)
+
+	case "undo":
+		doUndoLast(log, bot, st, chatID, userID, cfg.undoWindow)
+
+	case "captags":
+		doCaptionTags(log, bot, st, chatID, userID, upd.Message.CommandArguments())
+
+	case "strategy":
+		doStrategy(log, bot, st, chatID, userID, cfg, upd.Message.CommandArguments())
+
+	case "today":
+		doNext(log, bot, st, chatID, chatID, userID, cfg.archiveTag, nextSelector(log, st, cfg, chatID, store.SelectToday), 1)
+		sendMenu(log, bot, chatID, role)
+
+	case "template":
+		doTemplate(log, bot, st, chatID, userID, upd.Message.CommandArguments(), cfg.archiveTag)
+
+	case "backup":
+		doBackup(log, bot, st, chatID, userID, cfg)
+
+	case "restore":
+		doRestore(log, bot, st, chatID, userID, upd.Message, cfg)
+
+	case "dupes":
+		doDupes(log, bot, st, chatID, upd.Message.CommandArguments())
+
+	case "reconcile":
+		doReconcile(log, bot, st, chatID, userID, cfg.vkToken, cfg.vkOwner)
+
+	case "rules":
+		doRules(log, bot, st, chatID, userID, upd.Message.CommandArguments())
+
+	case "ban", "unban":
+		doBan(log, bot, st, chatID, userID, upd.Message.CommandArguments(), upd.Message.Command() == "ban")
+
+	case "stats":
+		doStats(log, bot, st, chatID)
+
+	case "log":
+		doLog(log, bot, st, chatID, upd.Message.CommandArguments())
+
+	case "loglevel":
+		doLogLevel(log, bot, st, chatID, userID, upd.Message.CommandArguments())
+
+	case "dest":
+		doDest(log, bot, st, chatID, userID, upd.Message.CommandArguments())
+
+	case "alerts":
+		doAlerts(log, bot, st, chatID)
+
+	default:
+		reply(log, bot, chatID, "Не знаю такую команду. Жми Menu или /help")
 	}
 }
 
-func handleCallback(bot *tgbotapi.BotAPI, st *store.Store, cq *tgbotapi.CallbackQuery, admins map[int64]struct{}, vkToken, vkOwner, archiveTag string) {
+func handleCallback(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, cq *tgbotapi.CallbackQuery, acc *access, cfg settings) {
 	chatID := cq.Message.Chat.ID
 	msgID := cq.Message.MessageID
 	userID := int64(cq.From.ID)
 
-	// всегда гасим “крутилку”
-	_ = answerCallback(bot, cq.ID, "", false)
+	data := strings.TrimSpace(cq.Data)
+	parts := strings.Split(data, ":")
 
 	// доступ
-	if !isAdmin(admins, userID) {
-		_ = answerCallback(bot, cq.ID, "Нет доступа", true)
+	role := acc.role(log, userID)
+	if !allowed(role, parts[0]) {
+		answerCallback(log, bot, cq.ID, "Нет доступа", true)
 		return
 	}
 
-	data := strings.TrimSpace(cq.Data)
-	parts := strings.Split(data, ":")
+	// гасим “крутилку”
+	answerCallback(log, bot, cq.ID, "", false)
 
 	switch parts[0] {
 	case "noop":
 		// ничего
 
 	case "menu":
-		editMenu(bot, chatID, msgID)
+		editMenu(log, bot, chatID, msgID, role)
 
 	case "whoami":
-		reply(bot, chatID, fmt.Sprintf("user_id=%d\nchat_id=%d", userID, chatID))
+		reply(log, bot, chatID, fmt.Sprintf("user_id=%d\nchat_id=%d", userID, chatID))
 
 	case "stats":
-		stats, _ := st.Stats()
-		reply(bot, chatID, formatStats(stats))
-		sendMenu(bot, chatID)
+		doStats(log, bot, st, chatID)
+		sendMenu(log, bot, chatID, role)
 
 	case "sync":
-		doSync(bot, st, chatID, vkToken, vkOwner)
-		sendMenu(bot, chatID)
+		doSync(log, bot, st, chatID, userID, cfg.vkToken, cfg.vkOwner)
+		sendMenu(log, bot, chatID, role)
 
 	case "next":
-		// next or next:5
-		n := 1
+		// next, next:5 или next:<n>:<tag>
+		n, tag := 1, ""
 		if len(parts) >= 2 {
 			if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
 				n = v
 			}
 		}
-		doNext(bot, st, chatID, archiveTag, n)
-		sendMenu(bot, chatID)
+		if len(parts) >= 3 {
+			tag = parts[2]
+		}
+		doNext(log, bot, st, chatID, chatID, userID, cfg.archiveTag, nextTagSelector(log, st, cfg, chatID, tag), n)
+		sendNextMenu(log, bot, chatID, role, tag)
+
+	case "today":
+		doNext(log, bot, st, chatID, chatID, userID, cfg.archiveTag, nextSelector(log, st, cfg, chatID, store.SelectToday), 1)
+		sendMenu(log, bot, chatID, role)
 
 	case "used":
 		// used:<page>
@@ -181,7 +410,7 @@ func handleCallback(bot *tgbotapi.BotAPI, st *store.Store, cq *tgbotapi.Callback
 				page = v
 			}
 		}
-		sendUsedPage(bot, st, chatID, msgID, page)
+		sendUsedPage(log, bot, st, chatID, msgID, page)
 
 	case "uopen":
 		// uopen:<page>:<vkfullid>
@@ -192,15 +421,15 @@ func handleCallback(bot *tgbotapi.BotAPI, st *store.Store, cq *tgbotapi.Callback
 		_ = tryAtoi(parts[1], &page)
 		vkFull := parts[2]
 
-		p, err := st.GetByVKFullID(vkFull)
+		p, err := chatPost(log, st, chatID, vkFull)
 		if err != nil || p == nil {
-			reply(bot, chatID, "Не нашёл этот пост в БД.")
+			reply(log, bot, chatID, "Не нашёл этот пост в БД.")
 			return
 		}
-		sendUsedDetails(bot, chatID, msgID, page, p)
+		sendUsedDetails(log, bot, st, chatID, msgID, page, p, role)
 
 	case "setnew":
-		// setnew:<vkfullid>:<page>
+		// setnew:<vkfullid>:<page>[:<searchid>]
 		if len(parts) < 3 {
 			return
 		}
@@ -208,51 +437,212 @@ func handleCallback(bot *tgbotapi.BotAPI, st *store.Store, cq *tgbotapi.Callback
 		page := 0
 		_ = tryAtoi(parts[2], &page)
 
-		if err := st.SetStatus(vkFull, "new"); err != nil {
-			reply(bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		// в чате-назначении — только в его очереди
+		var err error
+		if dest := chatQueue(log, st, chatID); dest != 0 {
+			err = st.SetDestStatus(vkFull, dest, "new")
+		} else {
+			err = st.SetStatus(vkFull, "new")
+		}
+		audit(log, st, userID, chatID, "setnew", vkFull, "", err)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+		if len(parts) >= 4 {
+			sid, _ := strconv.ParseInt(parts[3], 10, 64)
+			sendFindPage(log, bot, st, chatID, msgID, sid, page)
+			return
+		}
+		sendUsedPage(log, bot, st, chatID, msgID, page)
+
+	case "find":
+		// find:<searchid>:<page>
+		if len(parts) < 3 {
+			return
+		}
+		sid, _ := strconv.ParseInt(parts[1], 10, 64)
+		page := 0
+		_ = tryAtoi(parts[2], &page)
+		sendFindPage(log, bot, st, chatID, msgID, sid, page)
+
+	case "fopen":
+		// fopen:<searchid>:<page>:<vkfullid>
+		if len(parts) < 4 {
+			return
+		}
+		sid, _ := strconv.ParseInt(parts[1], 10, 64)
+		page := 0
+		_ = tryAtoi(parts[2], &page)
+
+		p, err := chatPost(log, st, chatID, parts[3])
+		if err != nil || p == nil {
+			reply(log, bot, chatID, "Не нашёл этот пост в БД.")
+			return
+		}
+		sendFindDetails(log, bot, st, chatID, msgID, sid, page, p, role)
+
+	case "fpub":
+		// fpub:<vkfullid>[:force]
+		if len(parts) < 2 {
+			return
+		}
+		p, err := chatPost(log, st, chatID, parts[1])
+		if err != nil || p == nil {
+			reply(log, bot, chatID, "Не нашёл этот пост в БД.")
+			return
+		}
+		force := len(parts) >= 3 && parts[2] == "force"
+		doPublishConfirm(log, bot, st, chatID, msgID, userID, cfg.archiveTag, p, force, role)
+
+	case "recap":
+		// recap:<vkfullid>
+		if len(parts) < 2 {
+			return
+		}
+		doRecaption(log, bot, st, chatID, userID, parts[1], cfg.archiveTag)
+
+	case "capask":
+		// capask:<vkfullid>
+		if len(parts) < 2 {
+			return
+		}
+		doAskCaption(log, bot, chatID, parts[1])
+
+	case "tagask":
+		// tagask:<vkfullid>
+		if len(parts) < 2 {
+			return
+		}
+		doAskTags(log, bot, st, chatID, parts[1])
+
+	case "undo":
+		// undo:<from_pub_id>:<to_pub_id>[:<pub_chat>]
+		if len(parts) < 3 {
+			return
+		}
+		from, _ := strconv.ParseInt(parts[1], 10, 64)
+		to, _ := strconv.ParseInt(parts[2], 10, 64)
+		pubChat := chatID
+		if len(parts) >= 4 {
+			pubChat, _ = strconv.ParseInt(parts[3], 10, 64)
+		}
+		doUndoRange(log, bot, st, chatID, pubChat, userID, msgID, from, to, cfg.undoWindow)
+
+	case "ban", "unban":
+		// ban:<vkfullid>
+		if len(parts) < 2 {
+			return
+		}
+		// убираем кнопки: статус в карточке уже устарел
+		send(log, bot, tgbotapi.NewEditMessageReplyMarkup(chatID, msgID, tgbotapi.InlineKeyboardMarkup{
+			InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+		}))
+		setBanned(log, bot, st, chatID, userID, parts[1], parts[0] == "ban")
+
+	case "log":
+		// log:<page>:<n>
+		if len(parts) < 3 {
+			return
+		}
+		page, n := 0, defaultLogPage
+		_ = tryAtoi(parts[1], &page)
+		_ = tryAtoi(parts[2], &n)
+		sendLogPage(log, bot, st, chatID, msgID, page, n)
+
+	case "amute":
+		// amute:<alert_id>:<hours>
+		if len(parts) < 3 {
+			return
+		}
+		id, _ := strconv.ParseInt(parts[1], 10, 64)
+		hours := 0
+		if err := tryAtoi(parts[2], &hours); err != nil || hours <= 0 {
 			return
 		}
-		sendUsedPage(bot, st, chatID, msgID, page)
+		doMuteAlert(log, bot, st, chatID, userID, msgID, id, hours)
 
 	default:
-		editMenu(bot, chatID, msgID)
+		editMenu(log, bot, chatID, msgID, role)
 	}
 }
 
-func doSync(bot *tgbotapi.BotAPI, st *store.Store, chatID int64, vkToken, vkOwner string) {
-	reply(bot, chatID, "🔄 Синхронизирую с VK...")
+func doSync(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, vkToken, vkOwner string) {
+	reply(log, bot, chatID, "🔄 Синхронизирую с VK...")
+	start := time.Now()
+
+	// сводка правок и удалений считается от прошлого sync (включая фоновые сверки)
+	var since int64
+	prev, err := st.LastSyncRun()
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if prev != nil {
+		since = prev.At
+	}
 
 	c := vk.New(vkToken, vkOwner)
 	items, err := c.FetchWall(200)
 	if err != nil {
-		reply(bot, chatID, fmt.Sprintf("Ошибка VK: %v", err))
+		observeSync(start, err)
+		audit(log, st, userID, chatID, "sync", "", "", err)
+		ops.alert(log, "sync", "", err)
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка VK: %v", err))
 		return
 	}
 
-	parsed := c.ExtractPosts(items)
-	posts := make([]store.Post, 0, len(parsed))
-	for _, p := range parsed {
-		posts = append(posts, store.Post{
-			VKOwnerID: p.VKOwnerID,
-			VKPostID:  p.VKPostID,
-			VKFullID:  p.VKFullID,
-			Link:      p.Link,
-			Text:      p.Text,
-			MediaURLs: p.MediaURLs,
-		})
+	posts, skipped, err := st.FilterPosts(toStorePosts(c.ExtractPosts(items)))
+	if err != nil {
+		observeSync(start, err)
+		ops.alert(log, "sync", "", err)
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
 	}
 
 	ins, err := st.UpsertPosts(posts)
+	observeSync(start, err)
+	audit(log, st, userID, chatID, "sync", "", fmt.Sprintf("+%d", ins), err)
+	if err != nil {
+		ops.alert(log, "sync", "", err)
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+
+	// хэши превью для поиска дублей — качать долго, не держим ответ
+	go hashThumbs(st)
+
+	// имя стены для {{.SourceName}} в шаблонах подписи
+	if name, err := c.OwnerName(vkOwner); err == nil {
+		if err := st.SetSourceName(vkOwner, name); err != nil {
+			log.Warn("save source name", "owner", vkOwner, "err", err)
+		}
+	} else {
+		log.Warn("vk owner name", "owner", vkOwner, "err", err)
+	}
+
+	edited, deleted, err := st.ChangesSince(since)
 	if err != nil {
-		reply(bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
 		return
 	}
+	if err := st.RecordSyncRun(store.SyncRun{Inserted: ins, Edited: edited, Deleted: deleted}); err != nil {
+		log.Warn("record sync run", "err", err)
+	}
 
-	stats, _ := st.Stats()
-	reply(bot, chatID, fmt.Sprintf("✅ Добавлено %d новых.\n%s", ins, formatStats(stats)))
+	stats := loadStats(log, st)
+	txt := fmt.Sprintf("✅ Добавлено %d новых.\n%s", ins, formatStats(stats))
+	if prev != nil {
+		txt += "\nС прошлого sync: " + formatChanges(edited, deleted)
+	}
+	if len(skipped) > 0 {
+		txt += "\n\n🚫 Отсеяно правилами: " + formatSkipped(skipped)
+	}
+	reply(log, bot, chatID, txt)
 }
 
-func doNext(bot *tgbotapi.BotAPI, st *store.Store, chatID int64, archiveTag string, n int) {
+// doNext: n постов от sel в чат to, отчёт — в chatID
+func doNext(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, to, userID int64, archiveTag string, sel store.Selector, n int) {
 	if n < 1 {
 		n = 1
 	}
@@ -261,47 +651,203 @@ func doNext(bot *tgbotapi.BotAPI, st *store.Store, chatID int64, archiveTag stri
 	}
 
 	sent := 0
+	var firstPub, lastPub int64
+	var notes []string
 	for i := 0; i < n; i++ {
-		p, err := st.PickRandomNew()
+		p, by, err := sel.Pick()
 		if err != nil {
-			reply(bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
 			break
 		}
 		if p == nil {
 			break
 		}
 
-		caption := buildCaptionHTML(p.Text, p.Link, archiveTag)
-
-		if err := sendAlbum(bot, chatID, p.MediaURLs, caption); err != nil {
-			reply(bot, chatID, fmt.Sprintf("Ошибка отправки: %v", err))
+		pubID, ok := publishTo(log, bot, st, chatID, to, userID, archiveTag, p)
+		if !ok {
 			break
 		}
-
-		if err := st.SetStatus(p.VKFullID, "used"); err != nil {
-			reply(bot, chatID, fmt.Sprintf("Ошибка БД (не смог пометить used): %v", err))
-			break
+		if firstPub == 0 {
+			firstPub = pubID
 		}
+		lastPub = pubID
+		notes = append(notes, fmt.Sprintf("• %s — %s", p.VKFullID, by))
 
 		sent++
 	}
 
-	stats, _ := st.Stats()
+	stats := loadChatStats(log, st, to)
 	if sent == 0 {
-		reply(bot, chatID, "⚠️ Нечего отправлять.\n"+formatStats(stats))
+		reply(log, bot, chatID, "⚠️ Нечего отправлять.\n"+formatStats(stats))
+		return
+	}
+	txt := fmt.Sprintf("✅ Отправлено: %d\n%s", sent, formatStats(stats))
+	if to != chatID {
+		where := strconv.FormatInt(to, 10)
+		if d, err := st.DestinationByChat(to); err == nil && d != nil {
+			where = d.Name
+		}
+		txt = fmt.Sprintf("✅ Отправлено в %s: %d\n%s", where, sent, formatStats(stats))
+	}
+	if len(notes) > 0 {
+		txt += "\n\n" + strings.Join(notes, "\n")
+	}
+	replyWithUndo(log, bot, chatID, to, txt, firstPub, lastPub)
+}
+
+// nextSelector: override > стратегия чата (/strategy) > NEXT_MODE;
+// если чат — назначение, выбирает из его очереди
+func nextSelector(log *slog.Logger, st store.Repository, cfg settings, chatID int64, override string) store.Selector {
+	name := override
+	if name == "" {
+		var err error
+		if name, err = st.ChatSelector(chatID); err != nil {
+			log.Warn("chat selector", "err", err)
+		}
+	}
+	if name == "" {
+		name = cfg.nextMode
+	}
+	dest := chatQueue(log, st, chatID)
+	sel, err := st.DestSelector(name, cfg.todayWindow, dest)
+	if err != nil {
+		log.Warn("selector", "name", name, "err", err)
+		// random собирается без обращения к базе и ошибки не даёт
+		if sel, err = st.DestSelector(store.SelectRandom, cfg.todayWindow, dest); err != nil {
+			log.Warn("selector", "name", store.SelectRandom, "err", err)
+		}
+	}
+	return sel
+}
+
+// parseNextArgs: аргументы /next и /next5 — #тег и @назначение (по умолчанию этот чат).
+// ok=false — уже ответили, почему нельзя.
+func parseNextArgs(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, args string) (to int64, tag string, ok bool) {
+	to = chatID
+	for _, a := range strings.Fields(args) {
+		switch {
+		case strings.HasPrefix(a, "#"):
+			tag = store.NormalizeTag(a)
+		case strings.HasPrefix(a, "@"):
+			d, err := findDestination(st, a)
+			if err != nil {
+				reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+				return 0, "", false
+			}
+			if d == nil {
+				reply(log, bot, chatID, "Нет такого назначения. Список: /dest")
+				return 0, "", false
+			}
+			if !d.Enabled {
+				reply(log, bot, chatID, fmt.Sprintf("Назначение %s выключено: /dest on %s", d.Name, d.Name))
+				return 0, "", false
+			}
+			to = d.ChatID
+		}
+	}
+	return to, tag, true
+}
+
+// nextTagSelector: с тегом — случайный пост с ним из очереди чата to, без тега — nextSelector
+func nextTagSelector(log *slog.Logger, st store.Repository, cfg settings, to int64, tag string) store.Selector {
+	if tag == "" {
+		return nextSelector(log, st, cfg, to, "")
+	}
+	return st.DestTagSelector(tag, chatQueue(log, st, to))
+}
+
+// /strategy [name|reset] — стратегия /next для этого чата
+func doStrategy(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, cfg settings, arg string) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+	if arg != "" {
+		name := arg
+		if arg == "reset" {
+			name = ""
+		}
+		err := st.SetChatSelector(chatID, name)
+		audit(log, st, userID, chatID, "strategy", "", arg, err)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Не получилось: %v\nВарианты: %s", err, strings.Join(store.SelectorNames, ", ")))
+			return
+		}
+	}
+
+	cur, err := st.ChatSelector(chatID)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
 		return
 	}
-	reply(bot, chatID, fmt.Sprintf("✅ Отправлено: %d\n%s", sent, formatStats(stats)))
+	if cur == "" {
+		cur = cfg.nextMode + " (по умолчанию, NEXT_MODE)"
+	}
+	reply(log, bot, chatID, fmt.Sprintf("🎯 Стратегия /next в этом чате: %s\n\nВарианты: %s\n/strategy <name> — сменить, /strategy reset — по умолчанию",
+		cur, strings.Join(store.SelectorNames, ", ")))
+}
+
+// publishPost: отправляет пост, помечает used и пишет в историю публикаций.
+// Ошибки сообщает в чат сам.
+func publishPost(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, archiveTag string, p *store.Post) (int64, bool) {
+	return publishTo(log, bot, st, chatID, chatID, userID, archiveTag, p)
 }
 
-func sendUsedPage(bot *tgbotapi.BotAPI, st *store.Store, chatID int64, msgID int, page int) {
+// publishTo: как publishPost, но в чат to, а ошибки — в replyTo (0 — только журнал и ops-чат)
+func publishTo(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, replyTo, to, userID int64, archiveTag string, p *store.Post) (int64, bool) {
+	caption := renderCaption(log, st, p, to, archiveTag)
+
+	msgIDs, err := sendPostAlbum(log, bot, st, to, p, caption)
+	if err != nil {
+		audit(log, st, userID, to, "publish", p.VKFullID, "", err)
+		ops.alert(log, "publish", p.VKFullID, err)
+		if replyTo != 0 {
+			reply(log, bot, replyTo, fmt.Sprintf("Ошибка отправки: %v", err))
+		}
+		return 0, false
+	}
+
+	pubID, err := st.MarkPublished(store.Publication{
+		VKFullID:    p.VKFullID,
+		ChatID:      to,
+		MessageIDs:  msgIDs,
+		PublishedBy: userID,
+		Caption:     caption,
+	})
+	audit(log, st, userID, to, "publish", p.VKFullID, fmt.Sprintf("pub #%d", pubID), err)
+	if err != nil {
+		ops.alert(log, "publish", p.VKFullID, fmt.Errorf("mark published: %w", err))
+		if replyTo != 0 {
+			reply(log, bot, replyTo, fmt.Sprintf("Ошибка БД (не смог пометить used): %v", err))
+		}
+		return 0, false
+	}
+	return pubID, true
+}
+
+// doPublish: публикация конкретного поста (не случайного)
+func doPublish(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, archiveTag string, p *store.Post) {
+	pubID, ok := publishPost(log, bot, st, chatID, userID, archiveTag, p)
+	if !ok {
+		return
+	}
+	stats := loadChatStats(log, st, chatID)
+	replyWithUndo(log, bot, chatID, chatID, fmt.Sprintf("✅ Отправлен %s\n%s", p.VKFullID, formatStats(stats)), pubID, pubID)
+}
+
+func sendUsedPage(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, msgID int, page int) {
 	if page < 0 {
 		page = 0
 	}
 
-	total, err := st.CountByStatus("used")
+	// в чате-назначении — его used
+	dest := chatQueue(log, st, chatID)
+	var total int
+	var err error
+	if dest != 0 {
+		total, err = st.CountByDestStatus(dest, "used")
+	} else {
+		total, err = st.CountByStatus("used")
+	}
 	if err != nil {
-		reply(bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
 		return
 	}
 
@@ -314,9 +860,14 @@ func sendUsedPage(bot *tgbotapi.BotAPI, st *store.Store, chatID int64, msgID int
 	}
 
 	offset := page * perPageUsed
-	items, err := st.ListByStatusPage("used", perPageUsed, offset)
+	var items []store.Post
+	if dest != 0 {
+		items, err = st.ListByDestStatusPage(dest, "used", perPageUsed, offset)
+	} else {
+		items, err = st.ListByStatusPage("used", perPageUsed, offset)
+	}
 	if err != nil {
-		reply(bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
 		return
 	}
 
@@ -326,7 +877,7 @@ func sendUsedPage(bot *tgbotapi.BotAPI, st *store.Store, chatID int64, msgID int
 		b.WriteString("Пусто.")
 	} else {
 		for i, p := range items {
-			b.WriteString(fmt.Sprintf("%d) %s | photos=%d | %s\n", i+1, p.VKFullID, len(p.MediaURLs), p.Link))
+			b.WriteString(fmt.Sprintf("%d) %s | photos=%d | %s\n", i+1, p.VKFullID, len(p.Media), p.Link))
 		}
 	}
 
@@ -335,25 +886,45 @@ func sendUsedPage(bot *tgbotapi.BotAPI, st *store.Store, chatID int64, msgID int
 	if msgID != 0 {
 		edit := tgbotapi.NewEditMessageText(chatID, msgID, b.String())
 		edit.ReplyMarkup = &markup
-		_, _ = bot.Send(edit)
+		send(log, bot, edit)
 	} else {
 		msg := tgbotapi.NewMessage(chatID, b.String())
 		msg.ReplyMarkup = markup
-		_, _ = bot.Send(msg)
+		send(log, bot, msg)
 	}
 }
 
-func sendUsedDetails(bot *tgbotapi.BotAPI, chatID int64, msgID int, page int, p *store.Post) {
-	txt := buildDetailsText(p)
+func sendUsedDetails(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, msgID int, page int, p *store.Post, role string) {
+	markup := detailsKeyboard(p, role, fmt.Sprintf("used:%d", page), fmt.Sprintf("setnew:%s:%d", p.VKFullID, page), false)
+	editDetails(log, bot, st, chatID, msgID, p, markup)
+}
 
-	markup := detailsKeyboard(page, p)
+func editDetails(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, msgID int, p *store.Post, markup tgbotapi.InlineKeyboardMarkup) {
+	txt := postDetailsText(log, st, p)
 
 	edit := tgbotapi.NewEditMessageText(chatID, msgID, txt)
 	edit.ReplyMarkup = &markup
-	_, _ = bot.Send(edit)
+	send(log, bot, edit)
+}
+
+// postDetailsText: buildDetailsText с историей публикаций, тегами и журналом из БД
+func postDetailsText(log *slog.Logger, st store.Repository, p *store.Post) string {
+	pubs, err := st.ListPublications(p.VKFullID)
+	if err != nil {
+		log.Warn("post publications", "vk_full_id", p.VKFullID, "err", err)
+	}
+	tags, err := st.PostTags(p.VKFullID)
+	if err != nil {
+		log.Warn("post tags", "vk_full_id", p.VKFullID, "err", err)
+	}
+	actions, err := st.PostAuditLog(p.VKFullID, 5)
+	if err != nil {
+		log.Warn("post audit log", "vk_full_id", p.VKFullID, "err", err)
+	}
+	return buildDetailsText(p, pubs, tags, actions)
 }
 
-func buildDetailsText(p *store.Post) string {
+func buildDetailsText(p *store.Post, pubs []store.Publication, tags []string, actions []store.AuditEntry) string {
 	used := "—"
 	if p.UsedAt > 0 {
 		used = time.Unix(p.UsedAt, 0).Format("2006-01-02 15:04:05")
@@ -362,16 +933,69 @@ func buildDetailsText(p *store.Post) string {
 	if len(t) > 800 {
 		t = t[:800] + "…"
 	}
+	vkDate := "—"
+	if p.VKDate > 0 {
+		vkDate = time.Unix(p.VKDate, 0).Format("2006-01-02 15:04")
+	}
+	if p.VKEditedAt > 0 {
+		vkDate += " (ред. " + time.Unix(p.VKEditedAt, 0).Format("2006-01-02 15:04") + ")"
+	}
+	if p.DeletedAt > 0 {
+		vkDate += "\n🗑 удалён в VK (замечено " + time.Unix(p.DeletedAt, 0).Format("2006-01-02 15:04") + ")"
+	}
 	return fmt.Sprintf(
-		"🔎 Пост\n\nvk_full_id: %s\nstatus: %s\nphotos: %d\nused_at: %s\nlink: %s\n\ntext:\n%s",
-		p.VKFullID, p.Status, len(p.MediaURLs), used, p.Link, t,
+		"🔎 Пост\n\nvk_full_id: %s\nstatus: %s\nphotos: %d\ntags: %s\nvk_date: %s\n❤️ %d  🔁 %d  👁 %d  💬 %d\nused_at: %s\nlink: %s%s%s\n\ntext:\n%s",
+		p.VKFullID, p.Status, len(p.Media), formatTags(tags, "—"), vkDate, p.Likes, p.Reposts, p.Views, p.Comments, used, p.Link, formatPublications(pubs), formatPostActions(actions), t,
 	)
 }
 
+// formatPublications: последние отправки поста (не больше 5)
+func formatPublications(pubs []store.Publication) string {
+	if len(pubs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("\n\nпубликации: %d", len(pubs)))
+	for i, pub := range pubs {
+		if i == 5 {
+			b.WriteString("\n…")
+			break
+		}
+		ids := make([]string, 0, len(pub.MessageIDs))
+		for _, id := range pub.MessageIDs {
+			ids = append(ids, strconv.Itoa(id))
+		}
+		b.WriteString(fmt.Sprintf("\n• %s → chat %d, msg %s, by %d",
+			time.Unix(pub.PublishedAt, 0).Format("2006-01-02 15:04"), pub.ChatID, strings.Join(ids, ","), pub.PublishedBy))
+		if pub.UndoneAt > 0 {
+			b.WriteString(" (отменена)")
+		}
+	}
+	return b.String()
+}
+
+// formatPostActions: кто и что последним делал с постом (из audit_log)
+func formatPostActions(actions []store.AuditEntry) string {
+	if len(actions) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\nдействия:")
+	for _, e := range actions {
+		b.WriteString("\n" + formatAuditEntry(e, false))
+	}
+	return b.String()
+}
+
 func usedKeyboard(page, maxPage int, items []store.Post) tgbotapi.InlineKeyboardMarkup {
+	return listKeyboard("used:", "uopen:", page, maxPage, items)
+}
+
+// listKeyboard: навигация <pagePrefix><page>, карточки <openPrefix><page>:<vkfullid>
+func listKeyboard(pagePrefix, openPrefix string, page, maxPage int, items []store.Post) tgbotapi.InlineKeyboardMarkup {
 	// навигация
-	prev := tgbotapi.NewInlineKeyboardButtonData("⬅️ Prev", fmt.Sprintf("used:%d", page-1))
-	next := tgbotapi.NewInlineKeyboardButtonData("Next ➡️", fmt.Sprintf("used:%d", page+1))
+	prev := tgbotapi.NewInlineKeyboardButtonData("⬅️ Prev", fmt.Sprintf("%s%d", pagePrefix, page-1))
+	next := tgbotapi.NewInlineKeyboardButtonData("Next ➡️", fmt.Sprintf("%s%d", pagePrefix, page+1))
 	menu := tgbotapi.NewInlineKeyboardButtonData("🏠 Menu", "menu")
 
 	if page <= 0 {
@@ -388,7 +1012,7 @@ func usedKeyboard(page, maxPage int, items []store.Post) tgbotapi.InlineKeyboard
 	if len(items) > 0 {
 		row := []tgbotapi.InlineKeyboardButton{}
 		for i, p := range items {
-			btn := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d", i+1), fmt.Sprintf("uopen:%d:%s", page, p.VKFullID))
+			btn := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d", i+1), fmt.Sprintf("%s%d:%s", openPrefix, page, p.VKFullID))
 			row = append(row, btn)
 			if len(row) == 5 {
 				rows = append(rows, row)
@@ -403,26 +1027,66 @@ func usedKeyboard(page, maxPage int, items []store.Post) tgbotapi.InlineKeyboard
 	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
 }
 
-func detailsKeyboard(page int, p *store.Post) tgbotapi.InlineKeyboardMarkup {
+// detailsKeyboard: backData — куда вернуться, setNewData — callback "вернуть в new"
+func detailsKeyboard(p *store.Post, role, backData, setNewData string, publish bool) tgbotapi.InlineKeyboardMarkup {
 	open := tgbotapi.NewInlineKeyboardButtonURL("🔗 Оригинал", p.Link)
-	back := tgbotapi.NewInlineKeyboardButtonData("⬅️ Back", fmt.Sprintf("used:%d", page))
+	back := tgbotapi.NewInlineKeyboardButtonData("⬅️ Back", backData)
 
-	toNew := tgbotapi.NewInlineKeyboardButtonData("↩️ вернуть в new", fmt.Sprintf("setnew:%s:%d", p.VKFullID, page))
-
-	return tgbotapi.NewInlineKeyboardMarkup(
+	rows := [][]tgbotapi.InlineKeyboardButton{
 		tgbotapi.NewInlineKeyboardRow(open),
-		tgbotapi.NewInlineKeyboardRow(toNew),
-		tgbotapi.NewInlineKeyboardRow(back),
-	)
+	}
+	if publish && p.Status != "banned" && allowed(role, "fpub") {
+		pub := tgbotapi.NewInlineKeyboardButtonData("📤 Опубликовать", fmt.Sprintf("fpub:%s", p.VKFullID))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(pub))
+	}
+	if p.Status == "used" && allowed(role, "recap") {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ Обновить подпись", fmt.Sprintf("recap:%s", p.VKFullID)),
+			tgbotapi.NewInlineKeyboardButtonData("✍️ Своя подпись", fmt.Sprintf("capask:%s", p.VKFullID)),
+		))
+	}
+	if allowed(role, "tagask") {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🏷 Теги", fmt.Sprintf("tagask:%s", p.VKFullID)),
+		))
+	}
+	if (p.Status == "used" || p.Status == "duplicate") && allowed(role, "setnew") {
+		toNew := tgbotapi.NewInlineKeyboardButtonData("↩️ вернуть в new", setNewData)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(toNew))
+	}
+	if allowed(role, "ban") {
+		ban := tgbotapi.NewInlineKeyboardButtonData("🚫 Бан", fmt.Sprintf("ban:%s", p.VKFullID))
+		if p.Status == "banned" {
+			ban = tgbotapi.NewInlineKeyboardButtonData("✅ Разбанить", fmt.Sprintf("unban:%s", p.VKFullID))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(ban))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(back))
+
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
 }
 
-func mainMenu() tgbotapi.InlineKeyboardMarkup {
+// mainMenu: кнопки, на которые у роли нет прав, не показываем
+func mainMenu(role string) tgbotapi.InlineKeyboardMarkup {
+	if allowed(role, "next") {
+		return tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🔄 Sync VK", "sync"),
+				tgbotapi.NewInlineKeyboardButtonData("🎲 Next", "next"),
+				tgbotapi.NewInlineKeyboardButtonData("🎲×5", "next:5"),
+				tgbotapi.NewInlineKeyboardButtonData("📅 Today", "today"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("📊 Stats", "stats"),
+				tgbotapi.NewInlineKeyboardButtonData("📜 Used", "used:0"),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🙋 whoami", "whoami"),
+				tgbotapi.NewInlineKeyboardButtonData("🏠 Menu", "menu"),
+			),
+		)
+	}
 	return tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔄 Sync VK", "sync"),
-			tgbotapi.NewInlineKeyboardButtonData("🎲 Next", "next"),
-			tgbotapi.NewInlineKeyboardButtonData("🎲×5", "next:5"),
-		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("📊 Stats", "stats"),
 			tgbotapi.NewInlineKeyboardButtonData("📜 Used", "used:0"),
@@ -434,44 +1098,106 @@ func mainMenu() tgbotapi.InlineKeyboardMarkup {
 	)
 }
 
-func sendMenu(bot *tgbotapi.BotAPI, chatID int64) {
+func sendMenu(log *slog.Logger, bot *tgbotapi.BotAPI, chatID int64, role string) {
+	msg := tgbotapi.NewMessage(chatID, "Панель управления:")
+	m := mainMenu(role)
+	msg.ReplyMarkup = m
+	send(log, bot, msg)
+}
+
+// sendNextMenu: меню после /next; с тегом — ещё и кнопки «ещё с этим тегом»
+func sendNextMenu(log *slog.Logger, bot *tgbotapi.BotAPI, chatID int64, role, tag string) {
+	m := mainMenu(role)
+	// callback_data — не длиннее 64 байт
+	if tag != "" && allowed(role, "next") && len("next:5:"+tag) <= 64 {
+		row := tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎲 #"+tag, "next:1:"+tag),
+			tgbotapi.NewInlineKeyboardButtonData("🎲×5 #"+tag, "next:5:"+tag),
+		)
+		m.InlineKeyboard = append([][]tgbotapi.InlineKeyboardButton{row}, m.InlineKeyboard...)
+	}
 	msg := tgbotapi.NewMessage(chatID, "Панель управления:")
-	m := mainMenu()
 	msg.ReplyMarkup = m
-	_, _ = bot.Send(msg)
+	send(log, bot, msg)
 }
 
-func editMenu(bot *tgbotapi.BotAPI, chatID int64, msgID int) {
+func editMenu(log *slog.Logger, bot *tgbotapi.BotAPI, chatID int64, msgID int, role string) {
 	edit := tgbotapi.NewEditMessageText(chatID, msgID, "Панель управления:")
-	m := mainMenu()
+	m := mainMenu(role)
 	edit.ReplyMarkup = &m
-	_, _ = bot.Send(edit)
+	send(log, bot, edit)
+}
+
+// sendPostAlbum: фото поста по file_id, если бот их уже отправлял, иначе по URL.
+// Telegram не принял file_id — забываем их и шлём по URL; новые file_id сохраняем.
+func sendPostAlbum(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, p *store.Post, captionHTML string) ([]int, error) {
+	msgIDs, fileIDs, err := sendAlbum(bot, chatID, p.Media, captionHTML)
+	if err != nil && hasFileIDs(p.Media) {
+		log.Warn("send by file_id failed, retry by url", "vk_full_id", p.VKFullID, "err", err)
+		if cerr := st.ClearMediaFileIDs(p.VKFullID); cerr != nil {
+			log.Warn("clear file_id", "vk_full_id", p.VKFullID, "err", cerr)
+		}
+		media := slices.Clone(p.Media)
+		for i := range media {
+			media[i].TGFileID = ""
+		}
+		msgIDs, fileIDs, err = sendAlbum(bot, chatID, media, captionHTML)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := st.SetMediaFileIDs(p.VKFullID, fileIDs); err != nil {
+		log.Warn("save file_id", "vk_full_id", p.VKFullID, "err", err)
+	}
+	return msgIDs, nil
 }
 
-func sendAlbum(bot *tgbotapi.BotAPI, chatID int64, photoURLs []string, captionHTML string) error {
-	if len(photoURLs) == 0 {
-		return fmt.Errorf("no photos")
+func hasFileIDs(media []store.Media) bool {
+	for _, m := range media {
+		if m.TGFileID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// sendAlbum: 1 фото — обычное фото, 2..10 — media group. Возвращает id сообщений
+// и file_id отправленных фото по порядку.
+func sendAlbum(bot *tgbotapi.BotAPI, chatID int64, photos []store.Media, captionHTML string) ([]int, []string, error) {
+	if len(photos) == 0 {
+		return nil, nil, fmt.Errorf("no photos")
+	}
+
+	file := func(m store.Media) tgbotapi.RequestFileData {
+		if m.TGFileID != "" {
+			return tgbotapi.FileID(m.TGFileID)
+		}
+		return tgbotapi.FileURL(m.URL)
 	}
 
 	// 1 фото -> обычное фото
-	if len(photoURLs) == 1 {
-		msg := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(photoURLs[0]))
+	if len(photos) == 1 {
+		msg := tgbotapi.NewPhoto(chatID, file(photos[0]))
 		if captionHTML != "" {
 			msg.Caption = captionHTML
 			msg.ParseMode = "HTML"
 		}
-		_, err := bot.Send(msg)
-		return err
+		sent, err := bot.Send(msg)
+		countSend("sendPhoto", err)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []int{sent.MessageID}, []string{photoFileID(sent)}, nil
 	}
 
 	// 2..10 фото -> media group
-	if len(photoURLs) > 10 {
-		photoURLs = photoURLs[:10]
+	if len(photos) > 10 {
+		photos = photos[:10]
 	}
 
-	media := make([]interface{}, 0, len(photoURLs))
-	for i, u := range photoURLs {
-		m := tgbotapi.NewInputMediaPhoto(tgbotapi.FileURL(u))
+	media := make([]interface{}, 0, len(photos))
+	for i, p := range photos {
+		m := tgbotapi.NewInputMediaPhoto(file(p))
 		if i == 0 && captionHTML != "" {
 			m.Caption = captionHTML
 			m.ParseMode = "HTML"
@@ -480,8 +1206,26 @@ func sendAlbum(bot *tgbotapi.BotAPI, chatID int64, photoURLs []string, captionHT
 	}
 
 	cfg := tgbotapi.NewMediaGroup(chatID, media)
-	_, err := bot.SendMediaGroup(cfg)
-	return err
+	sent, err := bot.SendMediaGroup(cfg)
+	countSend("sendMediaGroup", err)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int, 0, len(sent))
+	fileIDs := make([]string, 0, len(sent))
+	for _, m := range sent {
+		ids = append(ids, m.MessageID)
+		fileIDs = append(fileIDs, photoFileID(m))
+	}
+	return ids, fileIDs, nil
+}
+
+// photoFileID: file_id самого большого размера фото в сообщении
+func photoFileID(m tgbotapi.Message) string {
+	if len(m.Photo) == 0 {
+		return ""
+	}
+	return m.Photo[len(m.Photo)-1].FileID
 }
 
 func buildCaptionHTML(text, link, archiveTag string) string {
@@ -496,11 +1240,22 @@ func buildCaptionHTML(text, link, archiveTag string) string {
 }
 
 func formatStats(m map[string]int) string {
-	return fmt.Sprintf("Статы: new=%d used=%d", m["new"], m["used"])
+	txt := fmt.Sprintf("Статы: new=%d used=%d", m["new"], m["used"])
+	if m["duplicate"] > 0 {
+		txt += fmt.Sprintf(" duplicate=%d", m["duplicate"])
+	}
+	if m["banned"] > 0 {
+		txt += fmt.Sprintf(" banned=%d", m["banned"])
+	}
+	return txt
 }
 
-func reply(bot *tgbotapi.BotAPI, chatID int64, text string) {
-	_, _ = bot.Send(tgbotapi.NewMessage(chatID, text))
+func reply(log *slog.Logger, bot *tgbotapi.BotAPI, chatID int64, text string) {
+	_, err := bot.Send(tgbotapi.NewMessage(chatID, text))
+	countSend("sendMessage", err)
+	if err != nil {
+		log.Warn("reply", "to", chatID, "err", err)
+	}
 }
 
 func parseAdminIDs(s string) map[int64]struct{} {
@@ -517,18 +1272,10 @@ func parseAdminIDs(s string) map[int64]struct{} {
 	return out
 }
 
-func isAdmin(admins map[int64]struct{}, userID int64) bool {
-	if len(admins) == 0 {
-		return false // если админов не задали — никто не админ
-	}
-	_, ok := admins[userID]
-	return ok
-}
-
 func mustEnv(k string) string {
 	v := os.Getenv(k)
 	if v == "" {
-		log.Fatalf("missing env %s", k)
+		fatal("missing env", "key", k)
 	}
 	return v
 }
@@ -561,12 +1308,13 @@ func tryAtoi(s string, out *int) error {
 	return nil
 }
 
-func answerCallback(bot *tgbotapi.BotAPI, callbackID, text string, alert bool) error {
+func answerCallback(log *slog.Logger, bot *tgbotapi.BotAPI, callbackID, text string, alert bool) {
 	cfg := tgbotapi.CallbackConfig{
 		CallbackQueryID: callbackID,
 		Text:            text,
 		ShowAlert:       alert,
 	}
-	_, err := bot.Request(cfg)
-	return err
+	if _, err := bot.Request(cfg); err != nil {
+		log.Warn("answer callback", "err", err)
+	}
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/metrics"
+	"github.com/G1P0/pushdalek/internal/store"
+	"github.com/G1P0/pushdalek/internal/vk"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// метрики бота; отдаются на HTTP_ADDR/metrics, если HTTP_ADDR задан
+var (
+	registry = metrics.NewRegistry()
+
+	mPosts        = registry.Gauge("pushdalek_posts", "Posts by status.", "status")
+	mSyncDuration = registry.Histogram("pushdalek_sync_duration_seconds", "Duration of /sync runs.", []float64{1, 2, 5, 10, 20, 30, 60, 120})
+	mSyncRuns     = registry.Counter("pushdalek_sync_runs_total", "Sync runs by result.", "result")
+	mVKCalls      = registry.Counter("pushdalek_vk_api_calls_total", "VK API calls by method and error code (ok, VK error code or error).", "method", "code")
+	mTGSends      = registry.Counter("pushdalek_telegram_sends_total", "Telegram sends by method and outcome.", "method", "outcome")
+	mQueue        = registry.Gauge("pushdalek_updates_queue_length", "Telegram updates received but not yet handled.")
+	mLastPoll     = registry.Gauge("pushdalek_telegram_last_poll_timestamp_seconds", "Unix time of the last successful getUpdates.")
+)
+
+// healthPollTimeout: сколько без удачного getUpdates считаем бота мёртвым
+// (long polling отвечает минимум раз в u.Timeout = 60s)
+const healthPollTimeout = 3 * time.Minute
+
+// health: состояние для /healthz и /readyz
+type health struct {
+	st       store.Repository
+	lastPoll atomic.Int64 // unix, последний удачный getUpdates
+	queue    func() int
+}
+
+func newHealth(st store.Repository) *health {
+	h := &health{st: st, queue: func() int { return 0 }}
+	vk.OnCall = func(method, code string) { mVKCalls.Inc(method, code) }
+	registry.OnScrape(func() {
+		stats, err := st.Stats()
+		if err != nil {
+			// старые значения остаются — по логу видно, что они не обновляются
+			slog.Warn("metrics: stats", "err", err)
+		}
+		for status, n := range stats {
+			mPosts.Set(float64(n), status)
+		}
+		mQueue.Set(float64(h.queue()))
+	})
+	return h
+}
+
+func (h *health) polled() {
+	now := time.Now().Unix()
+	h.lastPoll.Store(now)
+	mLastPoll.Set(float64(now))
+}
+
+// check: база отвечает и Telegram опрашивается; для /healthz
+func (h *health) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if err := h.st.Ping(ctx); err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	last := h.lastPoll.Load()
+	if last == 0 {
+		return errors.New("telegram: no successful poll yet")
+	}
+	if ago := time.Since(time.Unix(last, 0)); ago > healthPollTimeout {
+		return fmt.Errorf("telegram: last successful poll %s ago", ago.Round(time.Second))
+	}
+	return nil
+}
+
+// serveHTTP: /healthz, /readyz и /metrics на addr; пустой addr — не слушаем
+func serveHTTP(addr string, h *health) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	// healthz: жив ли бот — база отвечает, getUpdates проходит
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.check(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "ok, last poll %ds ago\n", int(time.Since(time.Unix(h.lastPoll.Load(), 0)).Seconds()))
+	})
+	// readyz: готов ли принимать команды — схема мигрирована и Telegram уже ответил
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if h.lastPoll.Load() == 0 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("/metrics", registry.Handler())
+
+	slog.Info("http listening", "addr", addr)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.ListenAndServe(); err != nil {
+		slog.Error("http", "err", err)
+	}
+}
+
+// pollUpdates: как bot.GetUpdatesChan, но отмечает каждый удачный getUpdates для /healthz
+func pollUpdates(bot *tgbotapi.BotAPI, u tgbotapi.UpdateConfig, h *health) tgbotapi.UpdatesChannel {
+	ch := make(chan tgbotapi.Update, bot.Buffer)
+	h.queue = func() int { return len(ch) }
+	go func() {
+		for {
+			updates, err := bot.GetUpdates(u)
+			if err != nil {
+				slog.Warn("getUpdates failed, retry in 3s", "err", err)
+				time.Sleep(3 * time.Second)
+				continue
+			}
+			h.polled()
+			for _, upd := range updates {
+				if upd.UpdateID >= u.Offset {
+					u.Offset = upd.UpdateID + 1
+					ch <- upd
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// countSend: исход отправки в Telegram для pushdalek_telegram_sends_total
+func countSend(method string, err error) {
+	outcome := "ok"
+	var tgErr *tgbotapi.Error
+	switch {
+	case err == nil:
+	case errors.As(err, &tgErr) && tgErr.Code == http.StatusTooManyRequests:
+		outcome = "rate_limited"
+	default:
+		outcome = "error"
+	}
+	mTGSends.Inc(method, outcome)
+}
+
+// observeSync: длительность и исход /sync
+func observeSync(start time.Time, err error) {
+	mSyncDuration.Observe(time.Since(start).Seconds())
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	mSyncRuns.Inc(result)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	"github.com/G1P0/pushdalek/internal/vk"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// /post <vk_full_id | ссылка на пост>
+func doPostByID(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, arg, vkToken, vkOwner, role string) {
+	vkFull, ok := vk.ParseFullID(arg)
+	if !ok {
+		reply(log, bot, chatID, "Формат: /post <vk_full_id | https://vk.com/wall-123_456>")
+		return
+	}
+
+	p, err := chatPost(log, st, chatID, vkFull)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+
+	// в базе нет — подтягиваем из VK на лету
+	if p == nil {
+		c := vk.New(vkToken, vkOwner)
+		items, err := c.FetchByIDs(vkFull)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка VK: %v", err))
+			return
+		}
+		parsed := c.ExtractPosts(items)
+		if len(parsed) == 0 {
+			reply(log, bot, chatID, "В VK нет такого поста с фото.")
+			return
+		}
+		if _, err := st.UpsertPosts(toStorePosts(parsed)); err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+		if p, err = chatPost(log, st, chatID, parsed[0].VKFullID); err != nil || p == nil {
+			reply(log, bot, chatID, "Не нашёл этот пост в БД.")
+			return
+		}
+	}
+
+	markup := publishKeyboard(p, role, false)
+	msg := tgbotapi.NewMessage(chatID, postDetailsText(log, st, p))
+	msg.ReplyMarkup = markup
+	send(log, bot, msg)
+}
+
+// fpub:<vkfullid>[:force] — уже опубликованный пост требует подтверждения
+func doPublishConfirm(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, msgID int, userID int64, archiveTag string, p *store.Post, force bool, role string) {
+	if p.Status == "banned" {
+		reply(log, bot, chatID, "🚫 Пост забанен. Сначала /unban "+p.VKFullID)
+		return
+	}
+	if (p.Status == "used" || p.Status == "duplicate") && !force {
+		txt := fmt.Sprintf("⚠️ Этот пост уже публиковался (%s). Опубликовать ещё раз?\n\n%s",
+			time.Unix(p.UsedAt, 0).Format("2006-01-02 15:04"), postDetailsText(log, st, p))
+		if p.Status == "duplicate" {
+			txt = "⚠️ Похожий пост уже публиковался. Всё равно опубликовать?\n\n" + postDetailsText(log, st, p)
+		}
+		markup := publishKeyboard(p, role, true)
+		edit := tgbotapi.NewEditMessageText(chatID, msgID, txt)
+		edit.ReplyMarkup = &markup
+		send(log, bot, edit)
+		return
+	}
+
+	// убираем кнопки, чтобы не опубликовать дважды
+	send(log, bot, tgbotapi.NewEditMessageReplyMarkup(chatID, msgID, tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+	}))
+	doPublish(log, bot, st, chatID, userID, archiveTag, p)
+	sendMenu(log, bot, chatID, role)
+}
+
+func publishKeyboard(p *store.Post, role string, confirm bool) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL("🔗 Оригинал", p.Link)),
+	}
+	if p.Status != "banned" && allowed(role, "fpub") {
+		pub := tgbotapi.NewInlineKeyboardButtonData("📤 Опубликовать", fmt.Sprintf("fpub:%s", p.VKFullID))
+		if confirm {
+			pub = tgbotapi.NewInlineKeyboardButtonData("📤 Да, опубликовать повторно", fmt.Sprintf("fpub:%s:force", p.VKFullID))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(pub))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✖️ Отмена", "menu")))
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+func toStorePosts(parsed []vk.Post) []store.Post {
+	posts := make([]store.Post, 0, len(parsed))
+	for _, p := range parsed {
+		posts = append(posts, store.Post{
+			VKOwnerID: p.VKOwnerID,
+			VKPostID:  p.VKPostID,
+			VKFullID:  p.VKFullID,
+			Link:      p.Link,
+			Text:      p.Text,
+			Media:     photoMedia(p.Photos),
+			Links:     p.Links,
+
+			VKDate:     p.Date,
+			VKEditedAt: p.EditedAt,
+			Likes:      p.Likes,
+			Reposts:    p.Reposts,
+			Views:      p.Views,
+			Comments:   p.Comments,
+		})
+	}
+	return posts
+}
+
+// photoMedia: фото из VK -> строки таблицы media
+func photoMedia(photos []vk.PostPhoto) []store.Media {
+	out := make([]store.Media, 0, len(photos))
+	for _, ph := range photos {
+		out = append(out, store.Media{
+			Type:      store.MediaPhoto,
+			VKPhotoID: ph.ID,
+			URL:       ph.URL,
+			Width:     ph.Width,
+			Height:    ph.Height,
+			ThumbURL:  ph.ThumbURL,
+			Status:    store.MediaOK,
+		})
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	"github.com/G1P0/pushdalek/internal/vk"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// wall.getById принимает не больше 100 постов за раз
+const reconcileBatch = 100
+
+// reconcile: сверяет все живые посты в базе с VK.
+// Пропавшие из VK помечаются удалёнными, поправленные обновляются (старая версия — в post_revisions).
+func reconcile(st store.Repository, c *vk.Client) (checked, edited, deleted int, err error) {
+	start := time.Now().Unix()
+
+	ids, err := st.LivePostIDs()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	for i := 0; i < len(ids); i += reconcileBatch {
+		batch := ids[i:min(i+reconcileBatch, len(ids))]
+		if i > 0 {
+			time.Sleep(400 * time.Millisecond) // лимит VK ~3 запроса в секунду
+		}
+
+		items, err := c.FetchByIDs(batch...)
+		if err != nil {
+			return checked, 0, 0, err
+		}
+
+		// живым считаем любой пост, который VK вернул, даже если ExtractPosts его отсеет
+		seen := map[string]bool{}
+		for _, it := range items {
+			seen[fmt.Sprintf("%d_%d", it.OwnerID, it.ID)] = true
+		}
+		var gone []string
+		for _, id := range batch {
+			if !seen[id] {
+				gone = append(gone, id)
+			}
+		}
+		if _, err := st.MarkDeleted(gone); err != nil {
+			return checked, 0, 0, err
+		}
+		if _, err := st.UpsertPosts(toStorePosts(c.ExtractPosts(items))); err != nil {
+			return checked, 0, 0, err
+		}
+		checked += len(batch)
+	}
+
+	edited, deleted, err = st.ChangesSince(start)
+	return checked, edited, deleted, err
+}
+
+// runReconciler: периодическая сверка в фоне, every <= 0 — выключена.
+// Если что-то изменилось — сводка в ops-чат, без OPS_CHAT_ID — владельцам.
+func runReconciler(bot *tgbotapi.BotAPI, st store.Repository, cfg settings, owners map[int64]struct{}) {
+	if cfg.reconcileEvery <= 0 {
+		return
+	}
+	log := slog.With("task", "reconcile")
+	c := vk.New(cfg.vkToken, cfg.vkOwner)
+	for range time.Tick(cfg.reconcileEvery) {
+		checked, edited, deleted, err := reconcile(st, c)
+		if err != nil {
+			ops.alert(log, "reconcile", "", err)
+			continue
+		}
+		log.Info("reconcile", "checked", checked, "edited", edited, "deleted", deleted)
+		if edited+deleted > 0 {
+			txt := fmt.Sprintf("🔍 Сверка с VK, проверено %d: %s", checked, formatChanges(edited, deleted))
+			for _, id := range reportChats(owners) {
+				send(log, bot, tgbotapi.NewMessage(id, txt))
+			}
+		}
+		hashThumbs(st)
+	}
+}
+
+// reportChats: куда слать отчёты фоновых задач — ops-чат, а если его нет, владельцам
+func reportChats(owners map[int64]struct{}) []int64 {
+	if ops != nil && ops.chatID != 0 {
+		return []int64{ops.chatID}
+	}
+	out := make([]int64, 0, len(owners))
+	for id := range owners {
+		out = append(out, id)
+	}
+	return out
+}
+
+// /reconcile — сверить базу с VK прямо сейчас
+func doReconcile(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, vkToken, vkOwner string) {
+	reply(log, bot, chatID, "🔍 Сверяю базу с VK...")
+
+	checked, edited, deleted, err := reconcile(st, vk.New(vkToken, vkOwner))
+	audit(log, st, userID, chatID, "reconcile", "", fmt.Sprintf("%d проверено, %d изменено, %d удалено", checked, edited, deleted), err)
+	if err != nil {
+		ops.alert(log, "reconcile", "", err)
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка сверки: %v", err))
+		return
+	}
+	reply(log, bot, chatID, fmt.Sprintf("✅ Проверено %d: %s", checked, formatChanges(edited, deleted)))
+	go hashThumbs(st)
+}
+
+// formatChanges: "3 изменено, 1 удалено"
+func formatChanges(edited, deleted int) string {
+	return fmt.Sprintf("✏️ %d изменено, 🗑 %d удалено", edited, deleted)
+}
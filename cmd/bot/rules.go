@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	"github.com/G1P0/pushdalek/internal/vk"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const rulesHelp = `Правила исключения для sync:
+/rules — список
+/rules add keyword <слово>
+/rules add regex <регулярка>
+/rules add minphotos <N> — меньше N фото
+/rules add extlink — ссылки не на VK
+/rules add contest — конкурсы и розыгрыши
+/rules del|on|off <id>
+/rules dryrun — что исключили бы правила среди new
+/rules apply — забанить new-посты, попавшие под правила`
+
+// /rules [add|del|on|off|dryrun|apply ...]
+func doRules(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, arg string) {
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		sendRules(log, bot, st, chatID)
+		return
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "add":
+		if len(fields) < 2 {
+			reply(log, bot, chatID, rulesHelp)
+			return
+		}
+		// значение — всё после вида правила, как есть (в регулярке важны пробелы)
+		value := strings.TrimSpace(strings.SplitN(strings.TrimSpace(arg), fields[1], 2)[1])
+		r, err := st.AddRule(fields[1], value, userID)
+		audit(log, st, userID, chatID, "rules", "", "add "+fields[1]+" "+value, err)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("⚠️ %v", err))
+			return
+		}
+		reply(log, bot, chatID, fmt.Sprintf("✅ Правило #%d: %s", r.ID, r))
+
+	case "del", "on", "off":
+		if len(fields) < 2 {
+			reply(log, bot, chatID, rulesHelp)
+			return
+		}
+		id, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			reply(log, bot, chatID, rulesHelp)
+			return
+		}
+		switch strings.ToLower(fields[0]) {
+		case "del":
+			err = st.DeleteRule(id)
+		case "on":
+			err = st.SetRuleEnabled(id, true)
+		default:
+			err = st.SetRuleEnabled(id, false)
+		}
+		audit(log, st, userID, chatID, "rules", "", strings.ToLower(fields[0])+" "+fields[1], err)
+		if errors.Is(err, store.ErrRuleNotFound) {
+			reply(log, bot, chatID, fmt.Sprintf("Нет правила #%d.", id))
+			return
+		}
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+		sendRules(log, bot, st, chatID)
+
+	case "dryrun":
+		hits, err := st.DryRunRules()
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+		if len(hits) == 0 {
+			reply(log, bot, chatID, "Правил нет.")
+			return
+		}
+		var b strings.Builder
+		b.WriteString("🧪 Dry-run по new-постам:\n")
+		for _, h := range hits {
+			fmt.Fprintf(&b, "\n%s — %d", formatRule(h.Rule), h.Count)
+			if len(h.Examples) > 0 {
+				fmt.Fprintf(&b, "\n   %s", strings.Join(h.Examples, ", "))
+			}
+		}
+		reply(log, bot, chatID, b.String())
+
+	case "apply":
+		n, err := st.ApplyRules()
+		audit(log, st, userID, chatID, "rules", "", fmt.Sprintf("apply: забанено %d", n), err)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+		stats := loadStats(log, st)
+		reply(log, bot, chatID, fmt.Sprintf("🚫 Забанено %d.\n%s", n, formatStats(stats)))
+
+	default:
+		reply(log, bot, chatID, rulesHelp)
+	}
+}
+
+func sendRules(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64) {
+	rules, err := st.ListRules()
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if len(rules) == 0 {
+		reply(log, bot, chatID, "Правил нет.\n\n"+rulesHelp)
+		return
+	}
+	lines := make([]string, 0, len(rules))
+	for _, r := range rules {
+		lines = append(lines, fmt.Sprintf("%s (%s)", formatRule(r), time.Unix(r.CreatedAt, 0).Format("2006-01-02")))
+	}
+	reply(log, bot, chatID, "🚫 Правила sync:\n"+strings.Join(lines, "\n"))
+}
+
+func formatRule(r store.Rule) string {
+	mark := "✅"
+	if !r.Enabled {
+		mark = "⏸"
+	}
+	return fmt.Sprintf("%s #%d %s", mark, r.ID, r)
+}
+
+// formatSkipped: {3: 2, 5: 1} -> "#3×2, #5×1"
+func formatSkipped(m map[int64]int) string {
+	ids := make([]int64, 0, len(m))
+	total := 0
+	for id, n := range m {
+		ids = append(ids, id)
+		total += n
+	}
+	slices.Sort(ids)
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, fmt.Sprintf("#%d×%d", id, m[id]))
+	}
+	return fmt.Sprintf("%d (%s)", total, strings.Join(parts, ", "))
+}
+
+// /ban <vk_full_id | ссылка>, /unban ...
+func doBan(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, arg string, ban bool) {
+	vkFull, ok := vk.ParseFullID(arg)
+	if !ok {
+		reply(log, bot, chatID, "Формат: /ban <vk_full_id | https://vk.com/wall-123_456>")
+		return
+	}
+	setBanned(log, bot, st, chatID, userID, vkFull, ban)
+}
+
+func setBanned(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, vkFull string, ban bool) {
+	var err error
+	action := "unban"
+	if ban {
+		action = "ban"
+		err = st.BanPost(vkFull)
+	} else {
+		err = st.UnbanPost(vkFull)
+	}
+	audit(log, st, userID, chatID, action, vkFull, "", err)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if ban {
+		reply(log, bot, chatID, fmt.Sprintf("🚫 %s забанен, sync его не вернёт.", vkFull))
+		return
+	}
+	reply(log, bot, chatID, fmt.Sprintf("✅ %s разбанен.", vkFull))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	perPageFind = 10
+)
+
+// /find <query>
+func doFind(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, query string) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		reply(log, bot, chatID, "Формат: /find <текст>")
+		return
+	}
+
+	sid, err := st.SaveSearchQuery(chatID, query)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	sendFindPage(log, bot, st, chatID, 0, sid, 0)
+}
+
+func sendFindPage(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, msgID int, sid int64, page int) {
+	if page < 0 {
+		page = 0
+	}
+
+	query, err := st.SearchQuery(sid)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if query == "" {
+		reply(log, bot, chatID, "Поиск устарел, повтори /find")
+		return
+	}
+
+	total, err := st.CountSearch(query, "")
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+
+	maxPage := 0
+	if total > 0 {
+		maxPage = (total - 1) / perPageFind
+	}
+	if page > maxPage {
+		page = maxPage
+	}
+
+	items, err := st.Search(query, "", perPageFind, page*perPageFind)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🔍 «%s»: страница %d/%d (всего %d)\n\n", query, page+1, maxPage+1, total))
+	if len(items) == 0 {
+		b.WriteString("Ничего не нашлось.")
+	} else {
+		for i, p := range items {
+			b.WriteString(fmt.Sprintf("%d) %s | %s | photos=%d\n   %s\n", i+1, p.VKFullID, p.Status, len(p.Media), snippet(p.Text, 80)))
+		}
+	}
+
+	prefix := fmt.Sprintf("find:%d:", sid)
+	markup := listKeyboard(prefix, fmt.Sprintf("fopen:%d:", sid), page, maxPage, items)
+
+	if msgID != 0 {
+		edit := tgbotapi.NewEditMessageText(chatID, msgID, b.String())
+		edit.ReplyMarkup = &markup
+		send(log, bot, edit)
+	} else {
+		msg := tgbotapi.NewMessage(chatID, b.String())
+		msg.ReplyMarkup = markup
+		send(log, bot, msg)
+	}
+}
+
+func sendFindDetails(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, msgID int, sid int64, page int, p *store.Post, role string) {
+	back := fmt.Sprintf("find:%d:%d", sid, page)
+	setNew := fmt.Sprintf("setnew:%s:%d:%d", p.VKFullID, page, sid)
+	markup := detailsKeyboard(p, role, back, setNew, true)
+	editDetails(log, bot, st, chatID, msgID, p, markup)
+}
+
+// snippet: текст в одну строку, не длиннее n символов
+func snippet(text string, n int) string {
+	t := strings.Join(strings.Fields(text), " ")
+	r := []rune(t)
+	if len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	if t == "" {
+		return "—"
+	}
+	return t
+}
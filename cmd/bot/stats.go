@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// statsDays: за сколько дней считаем темп публикаций и рисуем график
+const statsDays = 30
+
+// /stats — статусы, темп публикаций, источники, фото, кто публикует; и график по дням
+func doStats(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -(statsDays - 1))
+
+	statuses, err := st.Stats()
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	r, err := st.Report(from.Unix(), 5)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	days := fillDays(r.Daily, from, statsDays)
+	reply(log, bot, chatID, formatReport(statuses, r, days)+formatDestinationsStats(log, st))
+
+	if r.Publications == 0 {
+		return
+	}
+	img, err := renderDailyChart(days)
+	if err != nil {
+		log.Warn("stats chart", "err", err)
+		return
+	}
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: "stats.png", Bytes: img})
+	photo.Caption = fmt.Sprintf("📈 Публикации по дням за %d дней", statsDays)
+	_, err = bot.Send(photo)
+	countSend("sendPhoto", err)
+	if err != nil {
+		log.Warn("stats chart", "err", err)
+	}
+}
+
+// fillDays: n дней подряд с from, дни без публикаций — с нулём
+func fillDays(daily []store.DayCount, from time.Time, n int) []store.DayCount {
+	byDay := make(map[string]int, len(daily))
+	for _, d := range daily {
+		byDay[d.Day] = d.Count
+	}
+	out := make([]store.DayCount, 0, n)
+	for i := range n {
+		day := from.AddDate(0, 0, i).Format("2006-01-02")
+		out = append(out, store.DayCount{Day: day, Count: byDay[day]})
+	}
+	return out
+}
+
+func formatReport(statuses map[string]int, r *store.Report, days []store.DayCount) string {
+	var b strings.Builder
+	b.WriteString("📊 " + formatStats(statuses) + "\n")
+
+	// темп: сегодня, неделя, четыре недели по 7 дней (старые слева)
+	today, week := 0, 0
+	if len(days) > 0 {
+		today = days[len(days)-1].Count
+	}
+	weeks := make([]string, 0, 4)
+	for w := 3; w >= 0; w-- {
+		sum := 0
+		for i := len(days) - 7*(w+1); i < len(days)-7*w; i++ {
+			if i >= 0 {
+				sum += days[i].Count
+			}
+		}
+		if w == 0 {
+			week = sum
+		}
+		weeks = append(weeks, fmt.Sprint(sum))
+	}
+	fmt.Fprintf(&b, "\n📤 Публикации за %d дней: %d (постов %d)\n", statsDays, r.Publications, r.PublishedPosts)
+	fmt.Fprintf(&b, "• сегодня %d, за 7 дней %d\n", today, week)
+	fmt.Fprintf(&b, "• по неделям: %s\n", strings.Join(weeks, " · "))
+	b.WriteString("• " + formatBurnDown(statuses["new"], r.PublishedPosts) + "\n")
+	if r.Publications > 0 {
+		fmt.Fprintf(&b, "• средняя подпись: %.0f символов\n", r.AvgCaptionLen)
+	}
+
+	if len(r.TopPublishers) > 0 {
+		b.WriteString("\n👤 Кто публикует:\n")
+		for _, p := range r.TopPublishers {
+			fmt.Fprintf(&b, "• %s — %d\n", formatActor(p.UserID), p.Count)
+		}
+	}
+
+	if len(r.Sources) > 0 {
+		b.WriteString("\n📚 Источники:\n")
+		for i, src := range r.Sources {
+			if i == 10 {
+				fmt.Fprintf(&b, "• … ещё %d\n", len(r.Sources)-i)
+				break
+			}
+			name := src.OwnerID
+			if src.Name != "" {
+				name = fmt.Sprintf("%s (%s)", src.Name, src.OwnerID)
+			}
+			fmt.Fprintf(&b, "• %s: %d, new %d, used %d\n", name, src.Total, src.New, src.Used)
+		}
+	}
+
+	if len(r.Photos) > 0 {
+		parts := make([]string, 0, len(r.Photos))
+		for _, pc := range r.Photos {
+			parts = append(parts, fmt.Sprintf("%d фото — %d", pc.Photos, pc.Posts))
+		}
+		b.WriteString("\n🖼 Фото в посте: " + strings.Join(parts, ", ") + "\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// formatBurnDown: на сколько дней хватит new, если публиковать как за последние statsDays
+func formatBurnDown(newCount, publishedPosts int) string {
+	if newCount == 0 {
+		return "new закончились"
+	}
+	if publishedPosts == 0 {
+		return fmt.Sprintf("за %d дней ничего не опубликовано — new (%d) не убывают", statsDays, newCount)
+	}
+	rate := float64(publishedPosts) / statsDays
+	left := int(math.Ceil(float64(newCount) / rate))
+	return fmt.Sprintf("в среднем %.1f поста в день — new хватит на ~%d дн. (до %s)",
+		rate, left, time.Now().AddDate(0, 0, left).Format("02.01.2006"))
+}
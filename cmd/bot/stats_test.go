@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+)
+
+func TestFillDays(t *testing.T) {
+	from := time.Date(2026, 2, 27, 0, 0, 0, 0, time.UTC)
+	daily := []store.DayCount{
+		{Day: "2026-02-26", Count: 9}, // до окна
+		{Day: "2026-02-28", Count: 2},
+		{Day: "2026-03-02", Count: 5},
+	}
+	want := []store.DayCount{
+		{Day: "2026-02-27", Count: 0},
+		{Day: "2026-02-28", Count: 2},
+		{Day: "2026-03-01", Count: 0},
+		{Day: "2026-03-02", Count: 5},
+	}
+	if got := fillDays(daily, from, 4); !slices.Equal(got, want) {
+		t.Fatalf("fillDays: %v, want %v", got, want)
+	}
+	if got := fillDays(daily, from, 0); len(got) != 0 {
+		t.Fatalf("fillDays n=0: %v", got)
+	}
+}
+
+func TestFormatBurnDown(t *testing.T) {
+	if got := formatBurnDown(0, 10); got != "new закончились" {
+		t.Errorf("new=0: %q", got)
+	}
+	if got := formatBurnDown(7, 0); !strings.Contains(got, "ничего не опубликовано") || !strings.Contains(got, "(7)") {
+		t.Errorf("без публикаций: %q", got)
+	}
+
+	// пост в день: 10 new хватит на 10 дней; два в день: 11 new — на 6 дней (округление вверх)
+	for _, c := range []struct {
+		newCount, published int
+		rate                string
+		days                int
+	}{
+		{10, statsDays, "1.0", 10},
+		{11, 2 * statsDays, "2.0", 6},
+	} {
+		before := time.Now()
+		got := formatBurnDown(c.newCount, c.published)
+		after := time.Now()
+		prefix := fmt.Sprintf("в среднем %s поста в день — new хватит на ~%d дн. (до ", c.rate, c.days)
+		ok := false
+		for _, now := range []time.Time{before, after} { // вызов мог попасть на полночь
+			if got == prefix+now.AddDate(0, 0, c.days).Format("02.01.2006")+")" {
+				ok = true
+			}
+		}
+		if !ok {
+			t.Errorf("formatBurnDown(%d, %d) = %q", c.newCount, c.published, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// как и с подписью: ответ узнаём по тексту нашего сообщения
+const tagsPromptPrefix = "🏷 Теги поста "
+
+var tagsPromptRe = regexp.MustCompile(`^` + tagsPromptPrefix + `(-?\d+_\d+)`)
+
+// formatTags: ["кот","мем"] -> "#кот #мем"
+func formatTags(tags []string, empty string) string {
+	if len(tags) == 0 {
+		return empty
+	}
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		out = append(out, "#"+t)
+	}
+	return strings.Join(out, " ")
+}
+
+// tagask:<vkfullid>
+func doAskTags(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, vkFull string) {
+	tags, err := st.PostTags(vkFull)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	msg := tgbotapi.NewMessage(chatID, tagsPromptPrefix+vkFull+
+		"\nСейчас: "+formatTags(tags, "—")+
+		"\nОтветь на это сообщение: +тег чтобы добавить, -тег чтобы убрать (можно несколько).")
+	msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true, Selective: true}
+	send(log, bot, msg)
+}
+
+func tagsReplyTarget(bot *tgbotapi.BotAPI, m *tgbotapi.Message) (string, bool) {
+	r := m.ReplyToMessage
+	if r == nil || r.From == nil || r.From.ID != bot.Self.ID {
+		return "", false
+	}
+	sm := tagsPromptRe.FindStringSubmatch(r.Text)
+	if sm == nil {
+		return "", false
+	}
+	return sm[1], true
+}
+
+// doEditTags: "+кот -мем #новый" (без знака — добавить)
+func doEditTags(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, vkFull, text string) {
+	for _, f := range strings.Fields(text) {
+		var err error
+		if strings.HasPrefix(f, "-") {
+			err = st.RemovePostTag(vkFull, strings.TrimPrefix(f, "-"))
+		} else {
+			err = st.AddPostTag(vkFull, strings.TrimPrefix(f, "+"))
+		}
+		audit(log, st, userID, chatID, "tags", vkFull, f, err)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+	}
+
+	tags, err := st.PostTags(vkFull)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	reply(log, bot, chatID, fmt.Sprintf("🏷 %s: %s", vkFull, formatTags(tags, "без тегов")))
+}
+
+// /captags on|off — теги поста в подписи рядом с тегом архива (для этого чата)
+func doCaptionTags(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, arg string) {
+	switch a := strings.ToLower(strings.TrimSpace(arg)); a {
+	case "on", "off":
+		err := st.SetChatCaptionTags(chatID, a == "on")
+		audit(log, st, userID, chatID, "captags", "", a, err)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+	case "":
+	default:
+		reply(log, bot, chatID, "Формат: /captags on|off")
+		return
+	}
+
+	on, err := st.ChatCaptionTags(chatID)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	state := "выключены"
+	if on {
+		state = "включены"
+	}
+	reply(log, bot, chatID, fmt.Sprintf("🏷 Теги поста в подписи: %s", state))
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// captionData: всё, кроме PhotoCount, уже экранировано под parse_mode=HTML
+type captionData struct {
+	Text       string
+	Link       string
+	Tag        string
+	Date       string
+	SourceName string
+	Tags       string // "#кот #мем", без тега архива
+	PhotoCount int
+}
+
+const captionTemplateHelp = `Переменные: {{.Text}} {{.Link}} {{.Tag}} {{.Tags}} {{.Date}} {{.SourceName}} {{.PhotoCount}}
+Пример:
+{{if .Text}}{{.Text}}
+
+{{end}}{{.Tag}} · {{.Date}}
+<a href="{{.Link}}">{{.SourceName}}</a>`
+
+func newCaptionData(log *slog.Logger, st store.Repository, p *store.Post, archiveTag string) captionData {
+	name, err := st.SourceName(p.VKOwnerID)
+	if err != nil {
+		log.Warn("source name", "owner", p.VKOwnerID, "err", err)
+	}
+	if name == "" {
+		name = p.VKOwnerID
+	}
+	// дата оригинального поста в VK; у старых записей до пересинка её нет
+	date := ""
+	switch {
+	case p.VKDate > 0:
+		date = time.Unix(p.VKDate, 0).Format("02.01.2006")
+	case p.CreatedAt > 0:
+		date = time.Unix(p.CreatedAt, 0).Format("02.01.2006")
+	}
+	return captionData{
+		Text:       html.EscapeString(strings.TrimSpace(p.Text)),
+		Link:       html.EscapeString(p.Link),
+		Tag:        html.EscapeString(archiveTag),
+		Date:       date,
+		SourceName: html.EscapeString(name),
+		Tags:       html.EscapeString(postTagsLine(log, st, p, archiveTag)),
+		PhotoCount: len(p.Media),
+	}
+}
+
+// postTagsLine: теги поста через пробел, кроме совпадающего с тегом архива
+func postTagsLine(log *slog.Logger, st store.Repository, p *store.Post, archiveTag string) string {
+	tags, err := st.PostTags(p.VKFullID)
+	if err != nil {
+		log.Warn("post tags", "vk_full_id", p.VKFullID, "err", err)
+	}
+	arch := store.NormalizeTag(archiveTag)
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != arch {
+			out = append(out, t)
+		}
+	}
+	return formatTags(out, "")
+}
+
+func parseCaptionTemplate(body string) (*template.Template, error) {
+	return template.New("caption").Option("missingkey=error").Parse(body)
+}
+
+func executeCaptionTemplate(t *template.Template, d captionData) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// validateCaptionTemplate: синтаксис + пробный прогон на примере
+func validateCaptionTemplate(body string) error {
+	t, err := parseCaptionTemplate(body)
+	if err != nil {
+		return err
+	}
+	out, err := executeCaptionTemplate(t, captionData{
+		Text:       "Пример текста",
+		Link:       "https://vk.com/wall-1_1",
+		Tag:        "#архив",
+		Date:       "01.01.2020",
+		SourceName: "Группа",
+		Tags:       "#кот #мем",
+		PhotoCount: 3,
+	})
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		return errors.New("шаблон даёт пустую подпись")
+	}
+	return nil
+}
+
+// renderCaption: шаблон назначения (/dest template) > шаблон чата > шаблон источника > default >
+// встроенный buildCaptionHTML
+func renderCaption(log *slog.Logger, st store.Repository, p *store.Post, chatID int64, archiveTag string) string {
+	scopes := []string{
+		store.TemplateScopeChat + strconv.FormatInt(chatID, 10),
+		store.TemplateScopeSource + p.VKOwnerID,
+		store.TemplateScopeDefault,
+	}
+	if d, err := st.DestinationByChat(chatID); err != nil {
+		log.Warn("destination by chat", "chat", chatID, "err", err)
+	} else if d != nil && d.Template != "" {
+		scopes = append([]string{d.Template}, scopes...)
+	}
+	for _, scope := range scopes {
+		tpl, err := st.GetTemplate(scope)
+		if err != nil {
+			log.Warn("caption template", "scope", scope, "err", err)
+			continue
+		}
+		if tpl == nil || tpl.Body == "" {
+			continue
+		}
+		out, err := renderTemplateBody(log, st, tpl.Body, p, archiveTag)
+		if err != nil {
+			log.Warn("caption template", "scope", scope, "err", err)
+			break
+		}
+		return out
+	}
+
+	// встроенный формат: теги поста рядом с тегом архива, если включено /captags
+	tag := archiveTag
+	on, err := st.ChatCaptionTags(chatID)
+	if err != nil {
+		log.Warn("chat caption tags", "err", err)
+	}
+	if on {
+		if tags := postTagsLine(log, st, p, archiveTag); tags != "" {
+			tag += " " + tags
+		}
+	}
+	return buildCaptionHTML(p.Text, p.Link, tag)
+}
+
+func renderTemplateBody(log *slog.Logger, st store.Repository, body string, p *store.Post, archiveTag string) (string, error) {
+	t, err := parseCaptionTemplate(body)
+	if err != nil {
+		return "", err
+	}
+	return executeCaptionTemplate(t, newCaptionData(log, st, p, archiveTag))
+}
+
+// normalizeTemplateScope: default | source:<owner_id> | chat:<chat_id> | here (текущий чат)
+func normalizeTemplateScope(s string, chatID int64) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case s == store.TemplateScopeDefault:
+		return s, true
+	case s == "here":
+		return store.TemplateScopeChat + strconv.FormatInt(chatID, 10), true
+	case strings.HasPrefix(s, store.TemplateScopeSource), strings.HasPrefix(s, store.TemplateScopeChat):
+		i := strings.Index(s, ":")
+		if _, err := strconv.ParseInt(s[i+1:], 10, 64); err != nil {
+			return "", false
+		}
+		return s, true
+	}
+	return "", false
+}
+
+// /template [list | set <scope> <шаблон> | preview <scope> | activate <scope> | reset <scope>]
+func doTemplate(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, args, archiveTag string) {
+	args = strings.TrimSpace(args)
+	sub, rest := args, ""
+	if i := strings.IndexAny(args, " \n"); i >= 0 {
+		sub, rest = args[:i], strings.TrimSpace(args[i+1:])
+	}
+
+	if sub == "" || sub == "list" {
+		sendTemplateList(log, bot, st, chatID)
+		return
+	}
+
+	scopeArg, body, _ := strings.Cut(rest, "\n")
+	// scope и шаблон могут быть и в одной строке
+	if f := strings.Fields(scopeArg); len(f) > 1 {
+		scopeArg = f[0]
+		body = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(rest), f[0]))
+	}
+	scope, ok := normalizeTemplateScope(scopeArg, chatID)
+	if !ok {
+		reply(log, bot, chatID, "Scope: default | source:<owner_id> | chat:<chat_id> | here")
+		return
+	}
+
+	switch sub {
+	case "set":
+		body = strings.TrimSpace(body)
+		if body == "" {
+			reply(log, bot, chatID, "Формат: /template set <scope>\n<шаблон>\n\n"+captionTemplateHelp)
+			return
+		}
+		if err := validateCaptionTemplate(body); err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("❌ Шаблон не сохранён: %v", err))
+			return
+		}
+		err := st.SaveTemplateDraft(scope, body, userID)
+		audit(log, st, userID, chatID, "template", "", "set "+scope, err)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+		reply(log, bot, chatID, fmt.Sprintf("💾 Черновик для %s сохранён.\nПроверь: /template preview %s\nВключи: /template activate %s", scope, scope, scope))
+
+	case "preview":
+		doTemplatePreview(log, bot, st, chatID, scope, archiveTag)
+
+	case "activate":
+		err := st.ActivateTemplate(scope, userID)
+		audit(log, st, userID, chatID, "template", "", "activate "+scope, err)
+		if errors.Is(err, store.ErrNoDraft) {
+			reply(log, bot, chatID, "Нет черновика. Сначала /template set")
+			return
+		}
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+		reply(log, bot, chatID, fmt.Sprintf("✅ Шаблон %s включён.", scope))
+
+	case "reset":
+		err := st.DeleteTemplate(scope)
+		audit(log, st, userID, chatID, "template", "", "reset "+scope, err)
+		if err != nil {
+			reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+			return
+		}
+		reply(log, bot, chatID, fmt.Sprintf("🗑 Шаблон %s удалён.", scope))
+
+	default:
+		reply(log, bot, chatID, "Формат: /template [list | set | preview | activate | reset] <scope>")
+	}
+}
+
+func sendTemplateList(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64) {
+	list, err := st.ListTemplates()
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("🧩 Шаблоны подписи\n\n")
+	if len(list) == 0 {
+		b.WriteString("Нет, используется встроенный.\n")
+	}
+	for _, t := range list {
+		state := "выключен"
+		if t.Body != "" {
+			state = "активен"
+		}
+		if t.Draft != "" {
+			state += ", есть черновик"
+		}
+		b.WriteString(fmt.Sprintf("• %s — %s\n", t.Scope, state))
+	}
+	b.WriteString("\n/template set <scope> <шаблон>\n/template preview|activate|reset <scope>\n\n")
+	b.WriteString(captionTemplateHelp)
+	reply(log, bot, chatID, b.String())
+}
+
+// doTemplatePreview: черновик (или активный шаблон) на последнем опубликованном посте, в этот чат
+func doTemplatePreview(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID int64, scope, archiveTag string) {
+	tpl, err := st.GetTemplate(scope)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if tpl == nil || (tpl.Draft == "" && tpl.Body == "") {
+		reply(log, bot, chatID, "Для этого scope шаблона нет.")
+		return
+	}
+	body := tpl.Draft
+	if body == "" {
+		body = tpl.Body
+	}
+
+	p, err := samplePost(st)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if p == nil {
+		reply(log, bot, chatID, "В базе нет постов для примера. Сначала /sync")
+		return
+	}
+
+	caption, err := renderTemplateBody(log, st, body, p, archiveTag)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("❌ Ошибка шаблона: %v", err))
+		return
+	}
+	if _, err := sendPostAlbum(log, bot, st, chatID, p, caption); err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка отправки (проверь HTML в шаблоне): %v", err))
+		return
+	}
+	reply(log, bot, chatID, fmt.Sprintf("👀 Превью %s на посте %s (статус не менялся).", scope, p.VKFullID))
+}
+
+// samplePost: последний опубликованный, если нет — последний new
+func samplePost(st store.Repository) (*store.Post, error) {
+	for _, status := range []string{"used", "new"} {
+		items, err := st.ListByStatusPage(status, 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) > 0 {
+			return &items[0], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestNormalizeTemplateScope(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"default", "default", true},
+		{" Default ", "default", true},
+		{"here", "chat:-100123", true},
+		{"chat:42", "chat:42", true},
+		{"CHAT:-100500", "chat:-100500", true},
+		{"source:-1", "source:-1", true},
+		{"source:", "", false},
+		{"source:abc", "", false},
+		{"chat:1:2", "", false},
+		{"chat", "", false},
+		{"everywhere", "", false},
+		{"", "", false},
+	} {
+		got, ok := normalizeTemplateScope(c.in, -100123)
+		if got != c.want || ok != c.ok {
+			t.Errorf("normalizeTemplateScope(%q) = %q, %v; want %q, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// replyWithUndo: сообщение об успехе с кнопкой отмены публикаций [fromPub, toPub] в чате pubChat
+func replyWithUndo(log *slog.Logger, bot *tgbotapi.BotAPI, chatID, pubChat int64, text string, fromPub, toPub int64) {
+	data := fmt.Sprintf("undo:%d:%d", fromPub, toPub)
+	if pubChat != chatID {
+		data += fmt.Sprintf(":%d", pubChat)
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↩️ Отменить", data),
+		),
+	)
+	send(log, bot, msg)
+}
+
+// /undo — отменить последнюю публикацию в этом чате
+func doUndoLast(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, window time.Duration) {
+	pub, err := st.LastPublication(chatID)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if pub == nil {
+		reply(log, bot, chatID, "Нечего отменять.")
+		return
+	}
+	txt, _ := undoPublications(log, bot, st, chatID, userID, []store.Publication{*pub}, window)
+	reply(log, bot, chatID, txt)
+}
+
+// undo:<from>:<to>[:<pub_chat>] — кнопка под сообщением об успехе; pubChat — куда публиковали
+func doUndoRange(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, pubChat, userID int64, msgID int, from, to int64, window time.Duration) {
+	pubs, err := st.ActivePublicationsInRange(pubChat, from, to)
+	if err != nil {
+		reply(log, bot, chatID, fmt.Sprintf("Ошибка БД: %v", err))
+		return
+	}
+	if len(pubs) == 0 {
+		reply(log, bot, chatID, "Уже отменено.")
+		return
+	}
+
+	res, left := undoPublications(log, bot, st, chatID, userID, pubs, window)
+
+	// кнопка больше не нужна; если что-то не удалилось — оставляем, чтобы повторить
+	if left == 0 {
+		send(log, bot, tgbotapi.NewEditMessageReplyMarkup(chatID, msgID, tgbotapi.InlineKeyboardMarkup{
+			InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+		}))
+	}
+	reply(log, bot, chatID, res)
+}
+
+// undoPublications: удаляет отправленные сообщения и возвращает посты в new.
+// Публикацию отменяем, только если из чата ушли все её сообщения: иначе пост
+// там виден, и статус остаётся used. left — сколько таких осталось (повторить можно).
+func undoPublications(log *slog.Logger, bot *tgbotapi.BotAPI, st store.Repository, chatID, userID int64, pubs []store.Publication, window time.Duration) (txt string, left int) {
+	undone, deleted, expired := 0, 0, 0
+	for _, pub := range pubs {
+		if time.Since(time.Unix(pub.PublishedAt, 0)) > window {
+			expired++
+			continue
+		}
+
+		// без id сообщений удалять нечего — а пост в чате, скорее всего, остался
+		if len(pub.MessageIDs) == 0 {
+			left++
+			audit(log, st, userID, chatID, "undo", pub.VKFullID, fmt.Sprintf("pub #%d", pub.ID),
+				errors.New("нет id сообщений публикации"))
+			continue
+		}
+
+		failed := 0
+		for _, id := range pub.MessageIDs {
+			if _, err := bot.Request(tgbotapi.NewDeleteMessage(pub.ChatID, id)); err != nil && !messageGone(err) {
+				log.Warn("undo: delete message", "chat", pub.ChatID, "msg", id, "err", err)
+				failed++
+				continue
+			}
+			deleted++
+		}
+		if failed > 0 {
+			left++
+			audit(log, st, userID, chatID, "undo", pub.VKFullID, fmt.Sprintf("pub #%d", pub.ID),
+				fmt.Errorf("не удалено сообщений: %d из %d", failed, len(pub.MessageIDs)))
+			continue
+		}
+
+		err := st.UndoPublication(pub.ID)
+		audit(log, st, userID, chatID, "undo", pub.VKFullID, fmt.Sprintf("pub #%d", pub.ID), err)
+		if err != nil {
+			return fmt.Sprintf("Ошибка БД: %v", err), left
+		}
+		undone++
+	}
+
+	stats := loadChatStats(log, st, pubs[0].ChatID)
+	txt = fmt.Sprintf("↩️ Отменено публикаций: %d (удалено сообщений: %d)", undone, deleted)
+	if left > 0 {
+		txt += fmt.Sprintf("\n⚠️ Не отменены: %d — не все сообщения удалились, пост остался в чате и в used. "+
+			"Повтори отмену (кнопка или /undo) или удали вручную и верни пост в new", left)
+	}
+	if expired > 0 {
+		txt += fmt.Sprintf("\nСтарше %s, не отменены: %d — телеграм уже не даст удалить, используй «вернуть в new»", window, expired)
+	}
+	return txt + "\n" + formatStats(stats), left
+}
+
+// messageGone: сообщения уже нет (удалили руками) — для отмены это то же, что удалить
+func messageGone(err error) bool {
+	var tgErr *tgbotapi.Error
+	return errors.As(err, &tgErr) && strings.Contains(tgErr.Message, "message to delete not found")
+}
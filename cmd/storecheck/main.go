@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/G1P0/pushdalek/internal/store"
+	"github.com/G1P0/pushdalek/internal/store/storetest"
+)
+
+// storecheck: общий набор проверок store.Repository.
+//
+//	storecheck                                   — SQLite во временном каталоге
+//	storecheck -dsn postgres://user@host/db      — PostgreSQL; каждая проверка в своей схеме, после — DROP
+func main() {
+	log.SetFlags(0)
+	dsn := flag.String("dsn", os.Getenv("DATABASE_URL"), "PostgreSQL (postgres://…); пусто — SQLite во временном каталоге")
+	flag.Parse()
+
+	var open storetest.Opener
+	backend := "sqlite"
+	if *dsn != "" {
+		if !store.IsPostgresDSN(*dsn) {
+			log.Fatalf("-dsn: нужен postgres://… или postgresql://…")
+		}
+		open = storetest.Postgres(*dsn)
+		backend = "postgres"
+	} else {
+		dir, err := os.MkdirTemp("", "storecheck-")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		open = storetest.SQLite(dir)
+	}
+
+	failed := 0
+	for _, r := range storetest.Run(open) {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %v\n", r.Name, r.Err)
+			continue
+		}
+		fmt.Printf("ok   %s\n", r.Name)
+	}
+	fmt.Printf("%s: %d/%d ok\n", backend, len(storetest.Checks)-failed, len(storetest.Checks))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 
+	"github.com/G1P0/pushdalek/internal/phash"
 	"github.com/G1P0/pushdalek/internal/store"
 	"github.com/G1P0/pushdalek/internal/vk"
 )
@@ -16,17 +18,26 @@ func main() {
 	if dbPath == "" {
 		dbPath = "bot.db"
 	}
+	// DATABASE_URL=postgres://… — PostgreSQL вместо файла SQLite
+	if u := os.Getenv("DATABASE_URL"); u != "" {
+		dbPath = u
+	}
 
 	if vkToken == "" || vkOwner == "" {
 		log.Fatal("need VK_TOKEN and VK_OWNER_ID")
 	}
 
-	st, err := store.Open(dbPath)
+	st, err := store.OpenRepository(dbPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer st.Close()
 
+	prev, err := st.LastSyncRun()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	c := vk.New(vkToken, vkOwner)
 	items, err := c.FetchWall(100)
 	if err != nil {
@@ -43,16 +54,72 @@ func main() {
 			VKFullID:  p.VKFullID,
 			Link:      p.Link,
 			Text:      p.Text,
-			MediaURLs: p.MediaURLs,
+			Media:     photoMedia(p.Photos),
+			Links:     p.Links,
+
+			VKDate:     p.Date,
+			VKEditedAt: p.EditedAt,
+			Likes:      p.Likes,
+			Reposts:    p.Reposts,
+			Views:      p.Views,
+			Comments:   p.Comments,
 		})
 	}
 
-	ins, err := st.UpsertPosts(posts)
+	kept, skipped, err := st.FilterPosts(posts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ins, err := st.UpsertPosts(kept)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// хэши превью для поиска дублей
+	hashed, failed, err := st.HashPendingThumbs(phash.NewFetcher().Hash)
 	if err != nil {
 		log.Fatal(err)
 	}
+	fmt.Printf("phash: hashed=%d failed=%d\n", hashed, failed)
 
-	stats, _ := st.Stats()
-	fmt.Printf("sync ok: wall=%d parsed=%d inserted=%d stats=%v db=%s\n",
-		len(items), len(posts), ins, stats, dbPath)
+	var since int64
+	if prev != nil {
+		since = prev.At
+	}
+	edited, deleted, err := st.ChangesSince(since)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := st.RecordSyncRun(store.SyncRun{Inserted: ins, Edited: edited, Deleted: deleted}); err != nil {
+		log.Fatal(err)
+	}
+
+	stats, err := st.Stats()
+	if err != nil {
+		slog.Warn("stats", "err", err)
+	}
+	fmt.Printf("since last sync: edited=%d deleted=%d\n", edited, deleted)
+	fmt.Printf("sync ok: wall=%d parsed=%d excluded=%d inserted=%d stats=%v db=%s\n",
+		len(items), len(posts), len(posts)-len(kept), ins, stats, dbPath)
+	for id, n := range skipped {
+		fmt.Printf("  rule #%d: %d\n", id, n)
+	}
+}
+
+// photoMedia: фото из VK -> строки таблицы media
+func photoMedia(photos []vk.PostPhoto) []store.Media {
+	out := make([]store.Media, 0, len(photos))
+	for _, ph := range photos {
+		out = append(out, store.Media{
+			Type:      store.MediaPhoto,
+			VKPhotoID: ph.ID,
+			URL:       ph.URL,
+			Width:     ph.Width,
+			Height:    ph.Height,
+			ThumbURL:  ph.ThumbURL,
+			Status:    store.MediaOK,
+		})
+	}
+	return out
 }
@@ -36,8 +36,8 @@ func main() {
 	fmt.Println("  vk_full_id:", p.VKFullID)
 	fmt.Println("  link:", p.Link)
 	fmt.Println("  text_len:", len(p.Text))
-	fmt.Println("  photos:", len(p.MediaURLs))
-	if len(p.MediaURLs) > 0 {
-		fmt.Println("  first_photo_url:", p.MediaURLs[0])
+	fmt.Println("  photos:", len(p.Photos))
+	if len(p.Photos) > 0 {
+		fmt.Println("  first_photo_url:", p.Photos[0].URL)
 	}
 }
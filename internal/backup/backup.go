@@ -0,0 +1,151 @@
+// Package backup: снимки базы по расписанию с ротацией и gzip.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+)
+
+const prefix = "pushdalek-"
+
+// maxUnpacked: больше этого распакованный бэкап не пишем — 20 МБ gzip-бомбы
+// хватит, чтобы забить диск до того, как CheckBackup его отвергнет
+var maxUnpacked int64 = 1 << 30
+
+type Config struct {
+	Dir  string
+	Keep int  // сколько последних копий хранить, <= 0 — все
+	Gzip bool // сжимать копию
+}
+
+// Run: VACUUM INTO в Dir/pushdalek-YYYYMMDD-HHMMSS.db[.gz] и ротация старых копий
+func Run(st store.Repository, cfg Config) (string, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return "", err
+	}
+
+	name := prefix + time.Now().Format("20060102-150405") + ".db"
+	path := filepath.Join(cfg.Dir, name)
+	if err := st.Backup(path); err != nil {
+		return "", err
+	}
+
+	if cfg.Gzip {
+		gz, err := gzipFile(path)
+		_ = os.Remove(path)
+		if err != nil {
+			return "", err
+		}
+		path = gz
+	}
+
+	if err := rotate(cfg.Dir, cfg.Keep); err != nil {
+		return path, fmt.Errorf("rotate: %w", err)
+	}
+	return path, nil
+}
+
+func gzipFile(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	outPath := path + ".gz"
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(path)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(outPath)
+		return "", err
+	}
+	return outPath, nil
+}
+
+// rotate: оставляет keep самых свежих копий (имя содержит время, сортируем по имени)
+func rotate(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, e := range entries {
+		n := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(n, prefix) && (strings.HasSuffix(n, ".db") || strings.HasSuffix(n, ".db.gz")) {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Unpack: gzip (по сигнатуре, а не по имени) распаковывает во временный файл рядом,
+// не больше maxUnpacked. cleanup удаляет временный файл; для несжатого — ничего не делает.
+func Unpack(path string) (dbPath string, cleanup func(), err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(2)
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return path, func() {}, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "unpack-*.db")
+	if err != nil {
+		return "", nil, err
+	}
+	n, err := io.Copy(tmp, io.LimitReader(zr, maxUnpacked+1))
+	if err == nil && n > maxUnpacked {
+		err = fmt.Errorf("распакованный бэкап больше %d МБ", maxUnpacked>>20)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", nil, err
+	}
+	return tmp.Name(), func() { _ = os.Remove(tmp.Name()) }, nil
+}
@@ -0,0 +1,173 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/G1P0/pushdalek/internal/store"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Name())
+	}
+	return out
+}
+
+func TestRotateKeepsNewest(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{
+		"pushdalek-20260101-000000.db",
+		"pushdalek-20260102-000000.db.gz",
+		"pushdalek-20260103-000000.db",
+		"pushdalek-20260104-000000.db.gz",
+		"pushdalek-20260105-000000.db",
+		"notes.txt",                        // чужое не трогаем
+		"pushdalek-20250101-000000.db-wal", // и не наше расширение
+	} {
+		writeFile(t, filepath.Join(dir, n), []byte("x"))
+	}
+
+	if err := rotate(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"notes.txt",
+		"pushdalek-20250101-000000.db-wal",
+		"pushdalek-20260104-000000.db.gz",
+		"pushdalek-20260105-000000.db",
+	}
+	if got := dirNames(t, dir); !slices.Equal(got, want) {
+		t.Fatalf("после rotate(2): %v, want %v", got, want)
+	}
+
+	// keep <= 0 — хранить все
+	if err := rotate(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := dirNames(t, dir); len(got) != len(want) {
+		t.Fatalf("rotate(0) удалил файлы: %v", got)
+	}
+}
+
+func TestRunGzipAndRotate(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	dir := t.TempDir()
+	// две старые копии: после Run с Keep=2 остаются самая свежая из них и новая
+	writeFile(t, filepath.Join(dir, "pushdalek-20000101-000000.db"), []byte("old"))
+	writeFile(t, filepath.Join(dir, "pushdalek-20000102-000000.db"), []byte("old"))
+
+	path, err := Run(st, Config{Dir: dir, Keep: 2, Gzip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := dirNames(t, dir)
+	want := []string{"pushdalek-20000102-000000.db", filepath.Base(path)}
+	if !slices.Equal(got, want) {
+		t.Fatalf("в каталоге %v, want %v", got, want)
+	}
+
+	db, cleanup, err := Unpack(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if _, err := store.CheckBackup(db); err != nil {
+		t.Fatalf("распакованная копия: %v", err)
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("sqlite"), 1000)
+
+	plain := filepath.Join(dir, "plain.db")
+	writeFile(t, plain, data)
+	p, cleanup, err := Unpack(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if p != plain {
+		t.Fatalf("несжатый файл: Unpack вернул %s", p)
+	}
+
+	gz := filepath.Join(dir, "backup.bin") // сжатие — по сигнатуре, не по имени
+	writeFile(t, gz, gzipBytes(t, data))
+	p, cleanup, err = Unpack(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("распаковано %d байт, want %d", len(got), len(data))
+	}
+	cleanup()
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("cleanup не удалил %s", p)
+	}
+}
+
+func TestUnpackLimit(t *testing.T) {
+	prev := maxUnpacked
+	maxUnpacked = 1000
+	defer func() { maxUnpacked = prev }()
+
+	dir := t.TempDir()
+	bomb := filepath.Join(dir, "bomb.db.gz")
+	writeFile(t, bomb, gzipBytes(t, make([]byte, 100_000)))
+
+	if _, _, err := Unpack(bomb); err == nil {
+		t.Fatal("Unpack распаковал больше лимита")
+	}
+	// временный файл не остаётся
+	if got := dirNames(t, dir); !slices.Equal(got, []string{"bomb.db.gz"}) {
+		t.Fatalf("в каталоге %v", got)
+	}
+
+	ok := filepath.Join(dir, "ok.db.gz")
+	writeFile(t, ok, gzipBytes(t, make([]byte, 1000)))
+	_, cleanup, err := Unpack(ok)
+	if err != nil {
+		t.Fatalf("ровно лимит: %v", err)
+	}
+	cleanup()
+}
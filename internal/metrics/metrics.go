@@ -0,0 +1,214 @@
+// Package metrics: счётчики, gauge и гистограммы в текстовом формате Prometheus
+// (exposition format 0.0.4). Без клиента prometheus — боту хватает пары типов.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry: набор метрик одного процесса
+type Registry struct {
+	mu       sync.Mutex
+	metrics  []metric
+	onScrape []func()
+}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+func NewRegistry() *Registry { return &Registry{} }
+
+// OnScrape: f вызывается перед каждой выдачей — для значений, которые дешевле
+// посчитать по запросу (посты по статусам, длина очереди)
+func (r *Registry) OnScrape(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onScrape = append(r.onScrape, f)
+}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write: все метрики в порядке регистрации
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	hooks := slices.Clone(r.onScrape)
+	list := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	for _, f := range hooks {
+		f()
+	}
+	for _, m := range list {
+		m.write(w)
+	}
+}
+
+// Handler: GET /metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// vec: значения по наборам меток; общее у Counter и Gauge
+type vec struct {
+	name, help, typ string
+	labels          []string
+
+	mu     sync.Mutex
+	values map[string]*series
+}
+
+type series struct {
+	labels []string
+	v      float64
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{name: name, help: help, typ: typ, labels: labels, values: map[string]*series{}}
+}
+
+func (v *vec) series(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s: want %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.values[key]
+	if !ok {
+		s = &series{labels: slices.Clone(values)}
+		v.values[key] = s
+	}
+	return s
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		s := v.values[k]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.labels), formatValue(s.v))
+	}
+}
+
+// Counter: только растёт
+type Counter struct{ *vec }
+
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{newVec(name, help, "counter", labels)}
+	r.add(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+func (c *Counter) Add(d float64, labelValues ...string) {
+	if d < 0 {
+		panic("metrics: counter " + c.name + " decreased")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series(labelValues).v += d
+}
+
+// Gauge: текущее значение
+type Gauge struct{ *vec }
+
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newVec(name, help, "gauge", labels)}
+	r.add(g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series(labelValues).v = v
+}
+
+// Histogram: распределение по верхним границам buckets (по возрастанию), без меток
+type Histogram struct {
+	name, help string
+	buckets    []float64
+
+	mu     sync.Mutex
+	counts []uint64 // по бакетам, не накопительно
+	sum    float64
+	count  uint64
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{name: name, help: help, buckets: slices.Clone(buckets), counts: make([]uint64, len(buckets))}
+	r.add(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	var cum uint64
+	for i, b := range h.buckets {
+		cum += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatValue(b), cum)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatValue(h.sum), h.name, h.count)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = n + `="` + escapeLabel(values[i]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
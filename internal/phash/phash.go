@@ -0,0 +1,100 @@
+// Package phash: перцептивный хэш картинок (dHash) без внешних зависимостей.
+package phash
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+	"net/http"
+	"time"
+)
+
+// DHash: 64-битный difference hash.
+// Картинка сжимается до 9×8 в оттенках серого, бит = «левый пиксель ярче правого».
+// Пересжатие, смена размера и лёгкая цветокоррекция хэш почти не меняют.
+func DHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	gray := resizeGray(img, w, h)
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if gray[y*w+x] > gray[y*w+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance: расстояние Хэмминга между хэшами, 0 — одинаковые картинки
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// resizeGray: усреднение яркости по блокам исходной картинки
+func resizeGray(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	out := make([]float64, w*h)
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return out
+	}
+
+	for ty := 0; ty < h; ty++ {
+		y0 := b.Min.Y + ty*b.Dy()/h
+		y1 := max(b.Min.Y+(ty+1)*b.Dy()/h, y0+1)
+		for tx := 0; tx < w; tx++ {
+			x0 := b.Min.X + tx*b.Dx()/w
+			x1 := max(b.Min.X+(tx+1)*b.Dx()/w, x0+1)
+
+			var sum float64
+			n := 0
+			for y := y0; y < y1 && y < b.Max.Y; y++ {
+				for x := x0; x < x1 && x < b.Max.X; x++ {
+					r, g, bl, _ := img.At(x, y).RGBA()
+					// яркость по BT.601
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+					n++
+				}
+			}
+			if n > 0 {
+				out[ty*w+tx] = sum / float64(n)
+			}
+		}
+	}
+	return out
+}
+
+// Fetcher: качает превью и считает хэш
+type Fetcher struct {
+	HTTP *http.Client
+}
+
+func NewFetcher() *Fetcher {
+	return &Fetcher{HTTP: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// превью VK — десятки килобайт; больше не читаем
+const maxImageBytes = 5 << 20
+
+func (f *Fetcher) Hash(url string) (uint64, error) {
+	resp, err := f.HTTP.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("phash: %s: http %d", url, resp.StatusCode)
+	}
+
+	img, _, err := image.Decode(io.LimitReader(resp.Body, maxImageBytes))
+	if err != nil {
+		return 0, fmt.Errorf("phash: %s: %w", url, err)
+	}
+	return DHash(img), nil
+}
@@ -0,0 +1,128 @@
+package phash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// gradient: яркость меняется слева направо от from до to
+func gradient(w, h int, from, to float64) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := from + (to-from)*float64(x)/float64(w-1)
+			img.SetGray(x, y, color.Gray{Y: uint8(v)})
+		}
+	}
+	return img
+}
+
+// waves: гладкий цветной узор, масштаб задаёт размер картинки
+func waves(w, h int, phase float64) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := 0.5 + 0.25*math.Sin(9*fx+phase) + 0.25*math.Cos(7*fy*fx+2*phase)
+			img.Set(x, y, color.RGBA{R: uint8(255 * v), G: uint8(200 * v), B: uint8(255 * (1 - v)), A: 255})
+		}
+	}
+	return img
+}
+
+func reencodeJPEG(t *testing.T, img image.Image, quality int) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestDHashKnown(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		img  image.Image
+		want uint64
+	}{
+		{"однотонная", gradient(30, 20, 128, 128), 0},
+		{"светлее слева", gradient(90, 80, 255, 0), math.MaxUint64},
+		{"светлее справа", gradient(90, 80, 0, 255), 0},
+		{"пустая", image.NewGray(image.Rect(0, 0, 0, 0)), 0},
+	} {
+		if got := DHash(c.img); got != c.want {
+			t.Errorf("%s: DHash=%016x, want %016x", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDHashStable(t *testing.T) {
+	orig := waves(320, 240, 0)
+	h := DHash(orig)
+
+	for _, c := range []struct {
+		name string
+		img  image.Image
+	}{
+		{"меньше", waves(160, 120, 0)},
+		{"больше и другие пропорции", waves(640, 400, 0)},
+		{"JPEG q=60", reencodeJPEG(t, orig, 60)},
+	} {
+		if d := Distance(h, DHash(c.img)); d > 6 {
+			t.Errorf("%s: расстояние %d", c.name, d)
+		}
+	}
+
+	if d := Distance(h, DHash(waves(320, 240, 2))); d < 16 {
+		t.Errorf("другая картинка: расстояние всего %d", d)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	if d := Distance(0, math.MaxUint64); d != 64 {
+		t.Fatalf("Distance(0, ^0)=%d", d)
+	}
+	if d := Distance(0xF0, 0xF1); d != 1 {
+		t.Fatalf("Distance(F0, F1)=%d", d)
+	}
+}
+
+func TestFetcherHash(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, gradient(90, 80, 255, 0)); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok.png":
+			_, _ = w.Write(buf.Bytes())
+		case "/junk.png":
+			_, _ = w.Write([]byte("not an image"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := NewFetcher()
+	if h, err := f.Hash(srv.URL + "/ok.png"); err != nil || h != math.MaxUint64 {
+		t.Fatalf("ok.png: %016x, %v", h, err)
+	}
+	if _, err := f.Hash(srv.URL + "/junk.png"); err == nil {
+		t.Fatal("junk.png: нет ошибки")
+	}
+	if _, err := f.Hash(srv.URL + "/missing.png"); err == nil {
+		t.Fatal("404: нет ошибки")
+	}
+}
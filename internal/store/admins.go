@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// роли админов (по возрастанию прав)
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+var ErrInviteNotFound = errors.New("invite not found, used or expired")
+
+type Admin struct {
+	UserID    int64
+	Role      string
+	AddedBy   int64
+	CreatedAt int64
+}
+
+// RoleLevel: viewer < editor < owner, 0 — не роль
+func RoleLevel(role string) int {
+	switch role {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleOwner:
+		return 3
+	}
+	return 0
+}
+
+func ValidRole(role string) bool { return RoleLevel(role) > 0 }
+
+func (s *Store) ensureAdminsSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS admins (
+  user_id    INTEGER PRIMARY KEY,
+  role       TEXT NOT NULL,
+  added_by   INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS admin_invites (
+  token      TEXT PRIMARY KEY,
+  role       TEXT NOT NULL,
+  created_by INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL DEFAULT 0,
+  expires_at INTEGER NOT NULL DEFAULT 0,
+  used_by    INTEGER NOT NULL DEFAULT 0,
+  used_at    INTEGER NOT NULL DEFAULT 0
+);
+`)
+	return err
+}
+
+// AdminRole: роль пользователя из БД, "" если не админ
+func (s *Store) AdminRole(userID int64) (string, error) {
+	var role string
+	err := s.db.QueryRow(`SELECT role FROM admins WHERE user_id=?;`, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !ValidRole(role) {
+		return "", nil
+	}
+	return role, nil
+}
+
+func (s *Store) SetAdmin(userID int64, role string, addedBy int64) error {
+	if !ValidRole(role) {
+		return fmt.Errorf("unsupported role: %s", role)
+	}
+	_, err := s.db.Exec(`
+INSERT INTO admins (user_id, role, added_by, created_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT(user_id) DO UPDATE SET role=excluded.role, added_by=excluded.added_by;
+`, userID, role, addedBy, time.Now().Unix())
+	return err
+}
+
+// RemoveAdmin: false, если такого админа не было
+func (s *Store) RemoveAdmin(userID int64) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM admins WHERE user_id=?;`, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *Store) ListAdmins() ([]Admin, error) {
+	rows, err := s.db.Query(`
+SELECT user_id, role, added_by, created_at
+FROM admins
+ORDER BY created_at, user_id;
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Admin{}
+	for rows.Next() {
+		var a Admin
+		if err := rows.Scan(&a.UserID, &a.Role, &a.AddedBy, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// CreateInvite: одноразовый токен для deep link /start invite_<token>
+func (s *Store) CreateInvite(role string, createdBy int64, ttl time.Duration) (string, error) {
+	if !ValidRole(role) {
+		return "", fmt.Errorf("unsupported role: %s", role)
+	}
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	now := time.Now()
+	_, err := s.db.Exec(`
+INSERT INTO admin_invites (token, role, created_by, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?);
+`, token, role, createdBy, now.Unix(), now.Add(ttl).Unix())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// UseInvite: гасит приглашение и выдаёт роль. Повторно токен не сработает.
+func (s *Store) UseInvite(token string, userID int64) (role string, err error) {
+	now := time.Now().Unix()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// проверка и погашение одним UPDATE: из двух одновременных /start с одним токеном пройдёт один
+	err = tx.QueryRow(`
+UPDATE admin_invites SET used_by=?, used_at=?
+WHERE token=? AND used_at=0 AND expires_at>?
+RETURNING role;
+`, userID, now, token, now).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrInviteNotFound
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// приглашение не понижает уже существующую роль
+	var cur string
+	e := tx.QueryRow(`SELECT role FROM admins WHERE user_id=?;`, userID).Scan(&cur)
+	if e != nil && !errors.Is(e, sql.ErrNoRows) {
+		err = e
+		return "", err
+	}
+	if RoleLevel(cur) >= RoleLevel(role) {
+		role = cur
+	} else {
+		_, err = tx.Exec(`
+INSERT INTO admins (user_id, role, added_by, created_at)
+SELECT CAST(? AS BIGINT), role, created_by, CAST(? AS BIGINT) FROM admin_invites WHERE token=?
+ON CONFLICT(user_id) DO UPDATE SET role=excluded.role, added_by=excluded.added_by;
+`, userID, now, token)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = tx.Commit()
+	return role, err
+}
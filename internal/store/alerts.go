@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Alert: один сбой (публикация, sync, сверка, бэкап…). Пишем каждый;
+// Sent — ушёл ли он в ops-чат или был подавлен (повтор, лимит, mute).
+type Alert struct {
+	ID       int64
+	At       int64
+	Op       string // publish, sync, reconcile, backup, …
+	Kind     string // op + ошибка без чисел — по нему глушим и сводим в дайджест
+	VKFullID string
+	Error    string
+	Sent     bool
+}
+
+// AlertGroup: сбои одного вида за период, для дайджеста
+type AlertGroup struct {
+	Kind    string
+	Op      string
+	Count   int
+	Sent    int
+	Posts   int // разных постов
+	LastAt  int64
+	Example string
+}
+
+func (s *Store) ensureAlertsSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS alerts (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  at         INTEGER NOT NULL,
+  op         TEXT NOT NULL,
+  kind       TEXT NOT NULL,
+  vk_full_id TEXT NOT NULL DEFAULT '',
+  error      TEXT NOT NULL DEFAULT '',
+  sent       INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_kind ON alerts(kind, vk_full_id, at);
+CREATE INDEX IF NOT EXISTS idx_alerts_at ON alerts(at);
+
+CREATE TABLE IF NOT EXISTS alert_mutes (
+  kind  TEXT PRIMARY KEY,
+  until INTEGER NOT NULL
+);
+`)
+	return err
+}
+
+func (s *Store) RecordAlert(a Alert) (int64, error) {
+	if a.At == 0 {
+		a.At = time.Now().Unix()
+	}
+	sent := 0
+	if a.Sent {
+		sent = 1
+	}
+	var id int64
+	err := s.db.WriteRow(`
+INSERT INTO alerts (at, op, kind, vk_full_id, error, sent)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id;
+`, a.At, a.Op, a.Kind, a.VKFullID, a.Error, sent).Scan(&id)
+	return id, err
+}
+
+// GetAlert: nil, nil если нет (или уже удалён PruneAlerts)
+func (s *Store) GetAlert(id int64) (*Alert, error) {
+	var a Alert
+	var sent int
+	err := s.db.QueryRow(`
+SELECT id, at, op, kind, vk_full_id, error, sent
+FROM alerts
+WHERE id=?;
+`, id).Scan(&a.ID, &a.At, &a.Op, &a.Kind, &a.VKFullID, &a.Error, &sent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.Sent = sent == 1
+	return &a, nil
+}
+
+// LastAlertSent: когда такой же сбой (вид + пост) последний раз уходил в чат, 0 — не уходил
+func (s *Store) LastAlertSent(kind, vkFullID string) (int64, error) {
+	var at int64
+	err := s.db.QueryRow(`
+SELECT COALESCE(MAX(at), 0)
+FROM alerts
+WHERE kind=? AND vk_full_id=? AND sent=1;
+`, kind, vkFullID).Scan(&at)
+	return at, err
+}
+
+// CountAlertsSent: сколько алертов ушло в чат с since — для лимита в час
+func (s *Store) CountAlertsSent(since int64) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM alerts WHERE sent=1 AND at >= ?;`, since).Scan(&n)
+	return n, err
+}
+
+// MuteAlerts: не слать сбои этого вида до until (unix); в дайджест они всё равно попадут
+func (s *Store) MuteAlerts(kind string, until int64) error {
+	_, err := s.db.Exec(`
+INSERT INTO alert_mutes (kind, until)
+VALUES (?, ?)
+ON CONFLICT(kind) DO UPDATE SET until=excluded.until;
+`, kind, until)
+	return err
+}
+
+// AlertMutedUntil: до какого времени заглушен вид, 0 — не заглушен
+func (s *Store) AlertMutedUntil(kind string) (int64, error) {
+	var until int64
+	err := s.db.QueryRow(`SELECT until FROM alert_mutes WHERE kind=?;`, kind).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return until, err
+}
+
+// AlertSummary: сбои с since по видам, частые сверху
+func (s *Store) AlertSummary(since int64) ([]AlertGroup, error) {
+	rows, err := s.db.Query(`
+SELECT kind, MIN(op), COUNT(*), SUM(sent), COUNT(DISTINCT NULLIF(vk_full_id, '')), MAX(at), MAX(error)
+FROM alerts
+WHERE at >= ?
+GROUP BY kind
+ORDER BY COUNT(*) DESC, kind;
+`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []AlertGroup{}
+	for rows.Next() {
+		var g AlertGroup
+		if err := rows.Scan(&g.Kind, &g.Op, &g.Count, &g.Sent, &g.Posts, &g.LastAt, &g.Example); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// PruneAlerts: удаляет сбои старше before и истёкшие mute
+func (s *Store) PruneAlerts(before int64) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM alerts WHERE at < ?;`, before)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM alert_mutes WHERE until < ?;`, time.Now().Unix()); err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// AuditOK: Result успешного действия; иначе в Result — текст ошибки
+const AuditOK = "ok"
+
+// AuditEntry: одно действие админа, меняющее состояние (публикация, sync, бан, …)
+type AuditEntry struct {
+	ID       int64
+	At       int64
+	ActorID  int64  // user_id; 0 — сам бот (по расписанию)
+	ChatID   int64  // где нажали/написали
+	Action   string // команда или кнопка: publish, setnew, sync, rules, …
+	VKFullID string // пост, если действие про пост
+	Details  string // аргументы: "add keyword кот", "pub #12", …
+	Result   string // AuditOK или текст ошибки
+}
+
+func (s *Store) ensureAuditSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS audit_log (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  at         INTEGER NOT NULL,
+  actor_id   INTEGER NOT NULL DEFAULT 0,
+  chat_id    INTEGER NOT NULL DEFAULT 0,
+  action     TEXT NOT NULL,
+  vk_full_id TEXT NOT NULL DEFAULT '',
+  details    TEXT NOT NULL DEFAULT '',
+  result     TEXT NOT NULL DEFAULT 'ok'
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_post ON audit_log(vk_full_id, id);
+`)
+	return err
+}
+
+func (s *Store) LogAction(e AuditEntry) error {
+	if e.At == 0 {
+		e.At = time.Now().Unix()
+	}
+	if e.Result == "" {
+		e.Result = AuditOK
+	}
+	_, err := s.db.Exec(`
+INSERT INTO audit_log (at, actor_id, chat_id, action, vk_full_id, details, result)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+`, e.At, e.ActorID, e.ChatID, e.Action, e.VKFullID, e.Details, e.Result)
+	return err
+}
+
+// AuditLog: страница журнала, новые сверху
+func (s *Store) AuditLog(limit, offset int) ([]AuditEntry, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.queryAudit(`
+SELECT id, at, actor_id, chat_id, action, vk_full_id, details, result
+FROM audit_log
+ORDER BY id DESC
+LIMIT ? OFFSET ?;
+`, limit, offset)
+}
+
+func (s *Store) CountAuditLog() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM audit_log;`).Scan(&n)
+	return n, err
+}
+
+// PostAuditLog: последние действия с постом, новые сверху
+func (s *Store) PostAuditLog(vkFullID string, limit int) ([]AuditEntry, error) {
+	if limit <= 0 {
+		limit = 5
+	}
+	return s.queryAudit(`
+SELECT id, at, actor_id, chat_id, action, vk_full_id, details, result
+FROM audit_log
+WHERE vk_full_id=?
+ORDER BY id DESC
+LIMIT ?;
+`, vkFullID, limit)
+}
+
+func (s *Store) queryAudit(q string, args ...any) ([]AuditEntry, error) {
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.At, &e.ActorID, &e.ChatID, &e.Action, &e.VKFullID, &e.Details, &e.Result); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,296 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SchemaVersion: версия схемы в PRAGMA user_version.
+// Поднимаем, когда меняется схема; /restore не примет бэкап новее текущей версии.
+// Совпадение с миграциями проверяет TestSchemaVersion.
+const SchemaVersion = 9
+
+// schemaHistory: что менялось в каждой версии; SchemaVersion == len(schemaHistory)-1
+var schemaHistory = []string{
+	0: "до user_version",
+	1: "user_version, бэкапы",
+	2: "media вместо posts.media_json",
+	3: "audit_log",
+	4: "alerts, alert_mutes",
+	5: "destinations, post_destinations",
+	6: "destinations.last_slot",
+	7: "внешний ключ media -> posts",
+	8: "post_tags.source='removed'",
+	9: "индексы media по кускам phash",
+}
+
+// ErrBackupUnsupported: Backup/Restore — только для SQLite, PostgreSQL бэкапится своими средствами
+var ErrBackupUnsupported = errors.New("backup is supported for SQLite only, use pg_dump")
+
+// BackupInfo: что внутри файла бэкапа
+type BackupInfo struct {
+	Version int // 0 — база до появления user_version
+	Posts   int
+}
+
+// Backup: онлайн-копия базы через VACUUM INTO. Файла path быть не должно.
+func (s *Store) Backup(path string) error {
+	if s.db.pg {
+		return ErrBackupUnsupported
+	}
+	_, err := s.db.Exec(`VACUUM INTO ?;`, path)
+	return err
+}
+
+// CheckBackup: файл — целая SQLite-база нашей схемы, не новее текущей версии
+func CheckBackup(path string) (BackupInfo, error) {
+	var info BackupInfo
+
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return info, err
+	}
+	defer db.Close()
+
+	var ok string
+	if err := db.QueryRow(`PRAGMA integrity_check;`).Scan(&ok); err != nil {
+		return info, fmt.Errorf("не SQLite-база: %w", err)
+	}
+	if ok != "ok" {
+		return info, fmt.Errorf("integrity_check: %s", ok)
+	}
+	if err := db.QueryRow(`PRAGMA user_version;`).Scan(&info.Version); err != nil {
+		return info, err
+	}
+	if info.Version > SchemaVersion {
+		return info, fmt.Errorf("бэкап схемы v%d новее текущей v%d — сначала обнови бота", info.Version, SchemaVersion)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM posts;`).Scan(&info.Posts); err != nil {
+		return info, fmt.Errorf("нет таблицы posts: %w", err)
+	}
+	return info, nil
+}
+
+// Restore: заменяет содержимое базы данными из бэкапа, не закрывая её.
+// Бэкап сначала мигрируется до текущей схемы (на временной копии), потом
+// все таблицы переливаются одной транзакцией на соединении-писателе —
+// другие записи ждут, читатели до коммита видят старую базу (WAL), после — новую.
+func (s *Store) Restore(path string) (BackupInfo, error) {
+	if s.db.pg {
+		return BackupInfo{}, ErrBackupUnsupported
+	}
+	info, err := CheckBackup(path)
+	if err != nil {
+		return info, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "restore-*.db")
+	if err != nil {
+		return info, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	src, err := os.Open(path)
+	if err != nil {
+		tmp.Close()
+		return info, err
+	}
+	_, err = io.Copy(tmp, src)
+	src.Close()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return info, err
+	}
+
+	// миграции старого бэкапа до текущей схемы
+	migrated, err := Open(tmpPath)
+	if err != nil {
+		return info, fmt.Errorf("миграция бэкапа: %w", err)
+	}
+	if err := migrated.Close(); err != nil {
+		return info, err
+	}
+
+	return info, s.copyFrom(context.Background(), tmpPath)
+}
+
+func (s *Store) copyFrom(ctx context.Context, path string) (err error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS bk;`, path); err != nil {
+		return err
+	}
+	defer func() { _, _ = conn.ExecContext(ctx, `DETACH DATABASE bk;`) }()
+
+	// таблицы переливаются по алфавиту: DELETE FROM posts после media каскадом снёс бы
+	// только что залитые фото. Внутри транзакции прагма не меняется — снимаем до неё.
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys=OFF;`); err != nil {
+		return err
+	}
+	defer func() { _, _ = conn.ExecContext(ctx, `PRAGMA foreign_keys=ON;`) }()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// триггеры (fts) на время переливки снимаем: построчный DELETE по fts — это O(n²)
+	var triggers []string
+	var names []string
+	rows, err := tx.QueryContext(ctx, `SELECT name, sql FROM main.sqlite_master WHERE type='trigger';`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name, ddl string
+		if err = rows.Scan(&name, &ddl); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+		triggers = append(triggers, ddl)
+	}
+	rows.Close()
+	for _, name := range names {
+		if _, err = tx.ExecContext(ctx, `DROP TRIGGER main.`+name+`;`); err != nil {
+			return err
+		}
+	}
+
+	tables, err := plainTables(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		cols, e := commonColumns(ctx, tx, t)
+		if e != nil {
+			err = e
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, `DELETE FROM main.`+t+`;`); err != nil {
+			return err
+		}
+		if len(cols) == 0 {
+			continue
+		}
+		list := strings.Join(cols, ", ")
+		if _, err = tx.ExecContext(ctx, `INSERT INTO main.`+t+` (`+list+`) SELECT `+list+` FROM bk.`+t+`;`); err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+	}
+
+	for _, ddl := range triggers {
+		if _, err = tx.ExecContext(ctx, ddl); err != nil {
+			return err
+		}
+	}
+	if err = rebuildSearchIndex(ctx, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// plainTables: обычные таблицы main без служебных и без виртуальных (fts) с их теневыми таблицами
+func plainTables(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+SELECT name, COALESCE(sql, '')
+FROM main.sqlite_master
+WHERE type='table' AND name NOT LIKE 'sqlite_%'
+ORDER BY name;
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []string
+	var virtual []string
+	for rows.Next() {
+		var name, ddl string
+		if err := rows.Scan(&name, &ddl); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(strings.ToUpper(ddl), "CREATE VIRTUAL") {
+			virtual = append(virtual, name)
+			continue
+		}
+		all = append(all, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := all[:0]
+	for _, t := range all {
+		shadow := false
+		for _, v := range virtual {
+			if strings.HasPrefix(t, v+"_") {
+				shadow = true
+				break
+			}
+		}
+		if !shadow {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// commonColumns: колонки, которые есть в таблице и в main, и в bk
+func commonColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	colsOf := func(schema string) ([]string, error) {
+		rows, err := tx.QueryContext(ctx, `SELECT name FROM pragma_table_info(?, ?);`, table, schema)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var out []string
+		for rows.Next() {
+			var n string
+			if err := rows.Scan(&n); err != nil {
+				return nil, err
+			}
+			out = append(out, n)
+		}
+		return out, rows.Err()
+	}
+
+	mainCols, err := colsOf("main")
+	if err != nil {
+		return nil, err
+	}
+	bkCols, err := colsOf("bk")
+	if err != nil {
+		return nil, err
+	}
+	inBk := map[string]bool{}
+	for _, c := range bkCols {
+		inBk[c] = true
+	}
+	var out []string
+	for _, c := range mainCols {
+		if inBk[c] {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
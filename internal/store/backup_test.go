@@ -0,0 +1,218 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func testPost(id, text string) Post {
+	return Post{
+		VKFullID:  id,
+		VKOwnerID: "-1",
+		VKPostID:  id[3:],
+		Link:      "https://vk.com/wall" + id,
+		Text:      text,
+		Media:     MediaFromURLs([]string{"https://sun9-1.userapi.com/" + id + ".jpg"}),
+	}
+}
+
+// snapshot: то, что должно пережить бэкап и восстановление
+func snapshot(t *testing.T, st *Store) string {
+	t.Helper()
+	stats, err := st.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := fmt.Sprintf("stats=%v", stats)
+	for _, id := range []string{"-1_1", "-1_2", "-1_3"} {
+		p, err := st.GetByVKFullID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p == nil {
+			out += "\n" + id + " нет"
+			continue
+		}
+		tags, err := st.PostTags(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out += fmt.Sprintf("\n%s %s %q media=%v tags=%v", id, p.Status, p.Text, p.MediaURLs(), tags)
+	}
+	dests, err := st.ListDestinations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range dests {
+		out += fmt.Sprintf("\ndest %s %d", d.Name, d.ChatID)
+	}
+	found, err := st.Search("котик", "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range found {
+		out += "\nsearch " + p.VKFullID
+	}
+	return out
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	st := openTest(t)
+	if _, err := st.UpsertPosts([]Post{testPost("-1_1", "котик #кот"), testPost("-1_2", "пёс")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.MarkPublished(Publication{VKFullID: "-1_2", ChatID: 10, MessageIDs: []int{5}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.AddPostTag("-1_2", "ручной"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.AddDestination(Destination{ChatID: -100, Name: "main"}); err != nil {
+		t.Fatal(err)
+	}
+	want := snapshot(t, st)
+
+	path := filepath.Join(t.TempDir(), "bk.db")
+	if err := st.Backup(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := CheckBackup(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != SchemaVersion || info.Posts != 2 {
+		t.Fatalf("CheckBackup: %+v", info)
+	}
+
+	// всё меняем после бэкапа
+	if err := st.SetStatus("-1_1", "banned"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.UpsertPosts([]Post{testPost("-1_3", "новый котик"), testPost("-1_2", "пёс исправлен")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RemovePostTag("-1_2", "ручной"); err != nil {
+		t.Fatal(err)
+	}
+	dests, err := st.ListDestinations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteDestination(dests[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot(t, st) == want {
+		t.Fatal("изменения после бэкапа не видны")
+	}
+
+	if _, err := st.Restore(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshot(t, st); got != want {
+		t.Fatalf("после Restore:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestRestoreOldSchema: бэкап исходной схемы (media_json в posts, без user_version)
+// проходит CheckBackup и доезжает до текущей схемы миграциями
+func TestRestoreOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`
+CREATE TABLE posts (
+  vk_full_id  TEXT PRIMARY KEY,
+  vk_owner_id TEXT NOT NULL,
+  vk_post_id  TEXT NOT NULL,
+  link        TEXT NOT NULL,
+  text        TEXT NOT NULL,
+  media_json  TEXT NOT NULL DEFAULT '[]',
+  status      TEXT NOT NULL DEFAULT 'new',
+  created_at  INTEGER NOT NULL DEFAULT 0,
+  updated_at  INTEGER NOT NULL DEFAULT 0,
+  used_at     INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO posts (vk_full_id, vk_owner_id, vk_post_id, link, text, media_json, status, used_at)
+VALUES ('-1_1', '-1', '1', 'https://vk.com/wall-1_1', 'старый котик', '["https://sun9-1.userapi.com/a.jpg","https://sun9-1.userapi.com/b.jpg"]', 'used', 100),
+       ('-1_2', '-1', '2', 'https://vk.com/wall-1_2', 'пёс', '[]', 'new', 0);
+`)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := CheckBackup(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != 0 || info.Posts != 2 {
+		t.Fatalf("CheckBackup: %+v", info)
+	}
+
+	st := openTest(t)
+	if _, err := st.UpsertPosts([]Post{testPost("-1_3", "будет заменён")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Restore(path); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := st.GetByVKFullID("-1_1")
+	if err != nil || p == nil {
+		t.Fatalf("-1_1: %v, %v", p, err)
+	}
+	if p.Status != "used" || p.UsedAt != 100 {
+		t.Fatalf("-1_1: статус %s, used_at %d", p.Status, p.UsedAt)
+	}
+	if urls := p.MediaURLs(); !slices.Equal(urls, []string{"https://sun9-1.userapi.com/a.jpg", "https://sun9-1.userapi.com/b.jpg"}) {
+		t.Fatalf("фото из media_json: %v", urls)
+	}
+	if p, err := st.GetByVKFullID("-1_3"); err != nil || p != nil {
+		t.Fatalf("-1_3 пережил Restore: %v, %v", p, err)
+	}
+	found, err := st.Search("котик", "", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].VKFullID != "-1_1" {
+		t.Fatalf("поиск после Restore: %v", found)
+	}
+}
+
+func TestCheckBackupRejects(t *testing.T) {
+	dir := t.TempDir()
+
+	newer := filepath.Join(dir, "newer.db")
+	st, err := Open(newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.db.Exec(fmt.Sprintf(`PRAGMA user_version = %d;`, SchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckBackup(newer); err == nil {
+		t.Fatal("бэкап новее текущей схемы принят")
+	}
+
+	// живая база не трогается, если бэкап не прошёл проверку
+	live := openTest(t)
+	if _, err := live.UpsertPosts([]Post{testPost("-1_1", "живой")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.Restore(newer); err == nil {
+		t.Fatal("Restore принял бэкап новее текущей схемы")
+	}
+	if p, err := live.GetByVKFullID("-1_1"); err != nil || p == nil {
+		t.Fatalf("после отказа Restore: %v, %v", p, err)
+	}
+}
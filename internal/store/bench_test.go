@@ -0,0 +1,222 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// замеры на SQLite-базе в 100k постов:
+//
+//	go test ./internal/store -run '^$' -bench . -benchtime 2s
+//
+// база заполняется один раз на весь прогон (несколько секунд) и лежит во временном каталоге
+
+const benchPosts = 100_000
+
+var bench struct {
+	once sync.Once
+	dir  string
+	path string
+	st   *Store
+	err  error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if bench.st != nil {
+		_ = bench.st.Close()
+	}
+	if bench.dir != "" {
+		_ = os.RemoveAll(bench.dir)
+	}
+	os.Exit(code)
+}
+
+// benchStore: общая база для бенчмарков
+func benchStore(b *testing.B) *Store {
+	b.Helper()
+	bench.once.Do(func() {
+		if bench.dir, bench.err = os.MkdirTemp("", "storebench-"); bench.err != nil {
+			return
+		}
+		bench.path = filepath.Join(bench.dir, "bench.db")
+		if bench.st, bench.err = Open(bench.path); bench.err != nil {
+			return
+		}
+		bench.err = seedBench(bench.st, benchPosts)
+	})
+	if bench.err != nil {
+		b.Fatal(bench.err)
+	}
+	return bench.st
+}
+
+// seedBench: n постов; used идут сплошными кусками разной длины вперемешку с new —
+// на равномерном «каждый третий» перекос выборки по rowid не виден
+func seedBench(st *Store, n int) error {
+	const batch = 1000
+	posts := make([]Post, 0, batch)
+	for i := 0; i < n; i++ {
+		posts = append(posts, benchPost(i))
+		if len(posts) == batch || i == n-1 {
+			if _, err := st.UpsertPosts(posts); err != nil {
+				return err
+			}
+			posts = posts[:0]
+		}
+	}
+
+	// первые 20% — used подряд, дальше блоки по 1000: used-хвосты длиной 0..900 через один
+	mark := func(from, to int) error {
+		_, err := st.db.Exec(`
+UPDATE posts SET status='used', used_at=updated_at
+WHERE rowid IN (SELECT rowid FROM posts ORDER BY rowid LIMIT ? OFFSET ?);
+`, to-from, from)
+		return err
+	}
+	if err := mark(0, n/5); err != nil {
+		return err
+	}
+	for start, k := n/5, 0; start < n; start, k = start+batch, k+1 {
+		if k%2 == 1 {
+			continue
+		}
+		if err := mark(start, min(start+(k%10)*100, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func benchPost(i int) Post {
+	owner := strconv.Itoa(-1 - i%20)
+	id := strconv.Itoa(i)
+	full := owner + "_" + id
+	photo := "https://sun9-1.userapi.com/bench/" + full + ".jpg"
+	return Post{
+		VKOwnerID: owner,
+		VKPostID:  id,
+		VKFullID:  full,
+		Link:      "https://vk.com/wall" + full,
+		Text:      fmt.Sprintf("пост %d #тег%d", i, i%50),
+		Media:     []Media{{Type: MediaPhoto, URL: photo, ThumbURL: photo + "?size=s"}},
+		VKDate:    time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC).Unix() + int64(i)*3600,
+		Likes:     i % 100,
+		Views:     i % 1000,
+	}
+}
+
+// benchWriter: второй Store на тот же файл пишет, как cmd/sync рядом с ботом —
+// страница из 100 известных постов со свежими лайками, между страницами запрос к VK
+func benchWriter(b *testing.B) (stop func()) {
+	b.Helper()
+	w, err := Open(bench.path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	quit, done := make(chan struct{}), make(chan struct{})
+	var werr error
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-quit:
+				return
+			default:
+			}
+			page := make([]Post, 0, 100)
+			for j := 0; j < 100; j++ {
+				p := benchPost((i*100 + j) % benchPosts)
+				p.Likes += i
+				page = append(page, p)
+			}
+			if _, err := w.UpsertPosts(page); err != nil {
+				werr = err
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+		_ = w.Close()
+		if werr != nil {
+			b.Fatalf("второй писатель: %v", werr)
+		}
+	}
+}
+
+func BenchmarkListByStatusPage(b *testing.B) {
+	st := benchStore(b)
+	stats, err := st.Stats()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		status string
+		offset int
+	}{
+		{"new/first", "new", 0},
+		{"new/deep", "new", stats["new"] / 2},
+		{"used/first", "used", 0},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := st.ListByStatusPage(c.status, 10, c.offset); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	b.Run("new/first/writer", func(b *testing.B) {
+		stop := benchWriter(b)
+		defer stop()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := st.ListByStatusPage("new", 10, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkPickRandomNew(b *testing.B) {
+	st := benchStore(b)
+
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := st.PickRandomNew(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := st.PickRandomNew(); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+	b.Run("writer", func(b *testing.B) {
+		stop := benchWriter(b)
+		defer stop()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := st.PickRandomNew(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
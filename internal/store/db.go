@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// conn: *sql.DB, который для PostgreSQL переписывает плейсхолдеры ? -> $1, $2, ...
+// Запросы в store пишем один раз, с ?, и по возможности на общем для обеих СУБД SQL.
+//
+// У SQLite два пула: DB — единственное соединение-писатель (Exec, транзакции),
+// rd — читатели для Query/QueryRow. В WAL читатели не ждут писателя и видят
+// последнее закоммиченное состояние. У PostgreSQL rd нет, всё идёт через DB.
+type conn struct {
+	*sql.DB
+	rd *sql.DB
+	pg bool
+}
+
+func (c *conn) reader() *sql.DB {
+	if c.rd != nil {
+		return c.rd
+	}
+	return c.DB
+}
+
+func (c *conn) Close() error {
+	if c.rd != nil {
+		_ = c.rd.Close()
+	}
+	return c.DB.Close()
+}
+
+// Tx: то же для транзакции
+type Tx struct {
+	*sql.Tx
+	pg bool
+}
+
+func rebind(pg bool, q string) string {
+	if !pg || !strings.Contains(q, "?") {
+		return q
+	}
+	var b strings.Builder
+	b.Grow(len(q) + 8)
+	n := 0
+	inStr := false
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case c == '\'':
+			inStr = !inStr
+			b.WriteByte(c)
+		case c == '?' && !inStr:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func (c *conn) Exec(q string, args ...any) (sql.Result, error) {
+	return c.DB.Exec(rebind(c.pg, q), args...)
+}
+
+func (c *conn) ExecContext(ctx context.Context, q string, args ...any) (sql.Result, error) {
+	return c.DB.ExecContext(ctx, rebind(c.pg, q), args...)
+}
+
+// pgSchema: схема пишется один раз, на SQL SQLite. В PostgreSQL INTEGER 32-битный —
+// берём BIGINT (в SQLite INTEGER и так 64 бита), автоинкремент — BIGSERIAL.
+var pgSchema = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+	"INTEGER", "BIGINT",
+)
+
+// ExecSchema: ExecContext для CREATE/ALTER из ensure*Schema, с поправкой типов под PostgreSQL
+func (c *conn) ExecSchema(ctx context.Context, q string) (sql.Result, error) {
+	if c.pg {
+		q = pgSchema.Replace(q)
+	}
+	return c.DB.ExecContext(ctx, q)
+}
+
+func (c *conn) Query(q string, args ...any) (*sql.Rows, error) {
+	return c.reader().Query(rebind(c.pg, q), args...)
+}
+
+func (c *conn) QueryContext(ctx context.Context, q string, args ...any) (*sql.Rows, error) {
+	return c.reader().QueryContext(ctx, rebind(c.pg, q), args...)
+}
+
+func (c *conn) QueryRow(q string, args ...any) *sql.Row {
+	return c.reader().QueryRow(rebind(c.pg, q), args...)
+}
+
+func (c *conn) QueryRowContext(ctx context.Context, q string, args ...any) *sql.Row {
+	return c.reader().QueryRowContext(ctx, rebind(c.pg, q), args...)
+}
+
+// WriteRow: QueryRow на писателе — для INSERT … RETURNING
+func (c *conn) WriteRow(q string, args ...any) *sql.Row {
+	return c.DB.QueryRow(rebind(c.pg, q), args...)
+}
+
+func (c *conn) Begin() (*Tx, error) {
+	return c.BeginTx(context.Background(), nil)
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := c.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, pg: c.pg}, nil
+}
+
+func (t *Tx) Exec(q string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(rebind(t.pg, q), args...)
+}
+
+func (t *Tx) ExecContext(ctx context.Context, q string, args ...any) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, rebind(t.pg, q), args...)
+}
+
+func (t *Tx) Query(q string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(rebind(t.pg, q), args...)
+}
+
+func (t *Tx) QueryRow(q string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(rebind(t.pg, q), args...)
+}
+
+func (t *Tx) Prepare(q string) (*sql.Stmt, error) {
+	return t.Tx.Prepare(rebind(t.pg, q))
+}
@@ -0,0 +1,500 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDestinationNotFound = errors.New("destination not found")
+	ErrDestinationExists   = errors.New("destination with this chat or name already exists")
+)
+
+var destNameRe = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Destination: чат, куда публикуем из общего архива. У каждого назначения своя
+// очередь: пост, отправленный в одно, остаётся new для остальных (post_destinations).
+type Destination struct {
+	ID        int64
+	ChatID    int64
+	Name      string // латиница, цифры, _ и -; по нему назначение зовут в командах
+	Template  string // scope шаблона подписи вперёд обычного порядка; "" — chat > source > default
+	Schedule  string // "09:00,18:30" — автопубликация по TZ; "" — только вручную
+	Enabled   bool   // выключенное не публикуется по расписанию и через /next @name
+	LastSlot  string // последний отработанный слот расписания, "2006-01-02 15:04" (TZ)
+	CreatedBy int64
+	CreatedAt int64
+}
+
+// статусы поста в назначении; banned и duplicate поста действуют во всех назначениях
+func validDestStatus(status string) bool {
+	return status == "new" || status == "used" || status == "banned"
+}
+
+// NormalizeSchedule: "18:30, 9:00" -> "09:00,18:30"; пустая строка — без расписания
+func NormalizeSchedule(s string) (string, error) {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		t, err := time.Parse("15:04", part)
+		if err != nil {
+			return "", fmt.Errorf("schedule: %q is not HH:MM", part)
+		}
+		out = append(out, t.Format("15:04"))
+	}
+	slices.Sort(out)
+	return strings.Join(slices.Compact(out), ","), nil
+}
+
+// slotLayout: слот расписания — дата и время; строки сравниваются как время
+const slotLayout = "2006-01-02 15:04"
+
+// ScheduleSlot: последний слот расписания не позже now, "" — расписания нет.
+// Если сегодня время ещё не подошло ни разу — последний слот вчера.
+func ScheduleSlot(schedule string, now time.Time) string {
+	if schedule == "" {
+		return ""
+	}
+	hm := now.Format("15:04")
+	times := strings.Split(schedule, ",")
+	for i := len(times) - 1; i >= 0; i-- {
+		if times[i] <= hm {
+			return now.Format("2006-01-02") + " " + times[i]
+		}
+	}
+	return now.AddDate(0, 0, -1).Format("2006-01-02") + " " + times[len(times)-1]
+}
+
+func (d *Destination) normalize() error {
+	d.Name = strings.ToLower(strings.TrimSpace(d.Name))
+	if !destNameRe.MatchString(d.Name) {
+		return fmt.Errorf("destination name %q: want 1-32 of a-z, 0-9, _ and -", d.Name)
+	}
+	d.Template = strings.TrimSpace(d.Template)
+	sched, err := NormalizeSchedule(d.Schedule)
+	if err != nil {
+		return err
+	}
+	d.Schedule = sched
+	return nil
+}
+
+func (s *Store) ensureDestinationsSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS destinations (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  chat_id    INTEGER NOT NULL UNIQUE,
+  name       TEXT NOT NULL UNIQUE,
+  template   TEXT NOT NULL DEFAULT '',
+  schedule   TEXT NOT NULL DEFAULT '',
+  enabled    INTEGER NOT NULL DEFAULT 1,
+  last_slot  TEXT NOT NULL DEFAULT '',
+  created_by INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS post_destinations (
+  vk_full_id     TEXT NOT NULL,
+  destination_id INTEGER NOT NULL,
+  status         TEXT NOT NULL,
+  used_at        INTEGER NOT NULL DEFAULT 0,
+  updated_at     INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (vk_full_id, destination_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_destinations_dest ON post_destinations(destination_id, status, used_at DESC);
+`)
+	if err != nil {
+		return err
+	}
+
+	cols, err := s.tableColumns(ctx, "destinations")
+	if err != nil {
+		return err
+	}
+	if !cols["last_slot"] {
+		_, err = s.db.ExecSchema(ctx, `ALTER TABLE destinations ADD COLUMN last_slot TEXT NOT NULL DEFAULT '';`)
+	}
+	return err
+}
+
+const destinationCols = `id, chat_id, name, template, schedule, enabled, last_slot, created_by, created_at`
+
+func scanDestination(sc interface{ Scan(...any) error }) (Destination, error) {
+	var d Destination
+	var en int
+	err := sc.Scan(&d.ID, &d.ChatID, &d.Name, &d.Template, &d.Schedule, &en, &d.LastSlot, &d.CreatedBy, &d.CreatedAt)
+	d.Enabled = en != 0
+	return d, err
+}
+
+func (s *Store) oneDestination(row *sql.Row) (*Destination, error) {
+	d, err := scanDestination(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// AddDestination: новое назначение, включённое. Уже действующие публикации в этот чат
+// сразу засчитываются в его очередь — заведённый задним числом канал не получит повторов.
+func (s *Store) AddDestination(d Destination) (_ *Destination, err error) {
+	if d.ChatID == 0 {
+		return nil, errors.New("destination chat_id is empty")
+	}
+	if err := d.normalize(); err != nil {
+		return nil, err
+	}
+	d.Enabled = true
+	if d.CreatedAt == 0 {
+		d.CreatedAt = time.Now().Unix()
+	}
+	// слоты до заведения назначения не догоняем
+	d.LastSlot = time.Unix(d.CreatedAt, 0).Format(slotLayout)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var n int
+	if err = tx.QueryRow(`SELECT COUNT(*) FROM destinations WHERE chat_id=? OR name=?;`, d.ChatID, d.Name).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		err = ErrDestinationExists
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+INSERT INTO destinations (chat_id, name, template, schedule, enabled, last_slot, created_by, created_at)
+VALUES (?, ?, ?, ?, 1, ?, ?, ?)
+RETURNING id;
+`, d.ChatID, d.Name, d.Template, d.Schedule, d.LastSlot, d.CreatedBy, d.CreatedAt).Scan(&d.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec(`
+INSERT INTO post_destinations (vk_full_id, destination_id, status, used_at, updated_at)
+SELECT vk_full_id, ?, 'used', MAX(published_at), ?
+FROM publications
+WHERE chat_id=? AND undone_at=0
+GROUP BY vk_full_id;
+`, d.ID, d.CreatedAt, d.ChatID); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// UpdateDestination: имя, шаблон, расписание и enabled по d.ID; chat_id не меняется.
+// Новое расписание или включение начинают отсчёт слотов с текущей минуты —
+// прошедшие сегодня слоты не догоняются.
+func (s *Store) UpdateDestination(d Destination) error {
+	if err := d.normalize(); err != nil {
+		return err
+	}
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM destinations WHERE name=? AND id<>?;`, d.Name, d.ID).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrDestinationExists
+	}
+	en := 0
+	if d.Enabled {
+		en = 1
+	}
+	res, err := s.db.Exec(`
+UPDATE destinations
+SET name=?, template=?,
+    last_slot=CASE WHEN schedule<>? OR enabled<>? THEN ? ELSE last_slot END,
+    schedule=?, enabled=?
+WHERE id=?;
+`, d.Name, d.Template, d.Schedule, en, time.Now().Format(slotLayout), d.Schedule, en, d.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDestinationNotFound
+	}
+	return nil
+}
+
+// DeleteDestination: удаляет назначение и его статусы; публикации остаются
+func (s *Store) DeleteDestination(id int64) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	res, err := tx.Exec(`DELETE FROM destinations WHERE id=?;`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		err = ErrDestinationNotFound
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM post_destinations WHERE destination_id=?;`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClaimScheduleSlot: забирает слот расписания назначения; true — слот наш и публиковать
+// нам. Условный UPDATE: из нескольких реплик (или после рестарта) слот достаётся одной,
+// а старый слот после более нового не сработает.
+func (s *Store) ClaimScheduleSlot(destID int64, slot string) (bool, error) {
+	res, err := s.db.Exec(`UPDATE destinations SET last_slot=? WHERE id=? AND last_slot<?;`, slot, destID, slot)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetDestination: nil, nil если нет
+func (s *Store) GetDestination(id int64) (*Destination, error) {
+	return s.oneDestination(s.db.QueryRow(`SELECT `+destinationCols+` FROM destinations WHERE id=?;`, id))
+}
+
+// DestinationByChat: назначение этого чата, nil, nil если чат не назначение
+func (s *Store) DestinationByChat(chatID int64) (*Destination, error) {
+	return s.oneDestination(s.db.QueryRow(`SELECT `+destinationCols+` FROM destinations WHERE chat_id=?;`, chatID))
+}
+
+func (s *Store) ListDestinations() ([]Destination, error) {
+	rows, err := s.db.Query(`SELECT ` + destinationCols + ` FROM destinations ORDER BY id;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Destination{}
+	for rows.Next() {
+		d, err := scanDestination(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// newCond: условие «можно публиковать» для строки posts. Без назначения — status='new';
+// в назначении — не banned/duplicate и в post_destinations для него ещё ничего нет.
+func newCond(dest int64) (string, []any) {
+	if dest == 0 {
+		return `status='new'`, nil
+	}
+	return `posts.status IN ('new','used') AND NOT EXISTS (
+  SELECT 1 FROM post_destinations pd WHERE pd.vk_full_id=posts.vk_full_id AND pd.destination_id=?)`, []any{dest}
+}
+
+// destStatusExpr: статус поста в назначении (нужен LEFT JOIN post_destinations pd):
+// отметка в назначении > banned/duplicate поста > new
+const destStatusExpr = `COALESCE(pd.status, CASE WHEN posts.status IN ('banned','duplicate') THEN posts.status ELSE 'new' END)`
+
+const destJoin = `posts LEFT JOIN post_destinations pd ON pd.vk_full_id=posts.vk_full_id AND pd.destination_id=?`
+
+// SetDestStatus: статус поста только в этом назначении (new, used, banned).
+// new снимает отметку — пост снова в очереди назначения, если он не banned/duplicate целиком.
+func (s *Store) SetDestStatus(vkFullID string, destID int64, status string) error {
+	if !validDestStatus(status) {
+		return fmt.Errorf("unsupported destination status: %s", status)
+	}
+	if status == "new" {
+		_, err := s.db.Exec(`DELETE FROM post_destinations WHERE vk_full_id=? AND destination_id=?;`, vkFullID, destID)
+		return err
+	}
+	now := time.Now().Unix()
+	usedAt := int64(0)
+	if status == "used" {
+		usedAt = now
+	}
+	_, err := s.db.Exec(`
+INSERT INTO post_destinations (vk_full_id, destination_id, status, used_at, updated_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(vk_full_id, destination_id) DO UPDATE SET status=excluded.status, used_at=excluded.used_at, updated_at=excluded.updated_at;
+`, vkFullID, destID, status, usedAt, now)
+	return err
+}
+
+// DestStats: как Stats, но статусы в назначении
+func (s *Store) DestStats(destID int64) (map[string]int, error) {
+	rows, err := s.db.Query(`
+SELECT `+destStatusExpr+` AS st, COUNT(*)
+FROM `+destJoin+`
+GROUP BY st;
+`, destID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]int{
+		"new":       0,
+		"used":      0,
+		"banned":    0,
+		"duplicate": 0,
+	}
+	for rows.Next() {
+		var st string
+		var c int
+		if err := rows.Scan(&st, &c); err != nil {
+			return nil, err
+		}
+		if validStatus(st) {
+			out[st] += c
+		}
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CountByDestStatus(destID int64, status string) (int, error) {
+	if !validStatus(status) {
+		return 0, fmt.Errorf("unsupported status: %s", status)
+	}
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM `+destJoin+` WHERE `+destStatusExpr+`=?;`, destID, status).Scan(&n)
+	return n, err
+}
+
+// ListByDestStatusPage: как ListByStatusPage, но по статусу в назначении;
+// Status у постов — тоже в назначении
+func (s *Store) ListByDestStatusPage(destID int64, status string, limit, offset int) ([]Post, error) {
+	if !validStatus(status) {
+		return nil, fmt.Errorf("unsupported status: %s", status)
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	order := "posts.created_at DESC"
+	if status == "used" {
+		order = "pd.used_at DESC"
+	}
+
+	rows, err := s.db.Query(`
+SELECT `+postColumns("posts")+`
+FROM `+destJoin+`
+WHERE `+destStatusExpr+`=?
+ORDER BY `+order+`
+LIMIT ? OFFSET ?;
+`, destID, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Post{}
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		p.Status = status
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, s.attachMedia(out)
+}
+
+// GetDestPost: пост со статусом и used_at в назначении destID; nil, nil если поста нет
+func (s *Store) GetDestPost(destID int64, vkFullID string) (*Post, error) {
+	p, err := s.GetByVKFullID(vkFullID)
+	if p == nil || err != nil {
+		return nil, err
+	}
+	var status string
+	var usedAt int64
+	err = s.db.QueryRow(`
+SELECT status, used_at FROM post_destinations WHERE vk_full_id=? AND destination_id=?;
+`, vkFullID, destID).Scan(&status, &usedAt)
+	switch {
+	case err == nil:
+		p.Status, p.UsedAt = status, usedAt
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	case p.Status != "banned" && p.Status != "duplicate":
+		p.Status, p.UsedAt = "new", 0
+	}
+	return p, nil
+}
+
+// isDestChatTx: чат — назначение (своя очередь, а не общая)
+func isDestChatTx(tx *Tx, chatID int64) (bool, error) {
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM destinations WHERE chat_id=?;`, chatID).Scan(&n)
+	return n > 0, err
+}
+
+// markDestUsedTx: публикация в чат-назначение отмечает пост used в нём
+func markDestUsedTx(tx *Tx, vkFullID string, chatID, at int64) error {
+	_, err := tx.Exec(`
+INSERT INTO post_destinations (vk_full_id, destination_id, status, used_at, updated_at)
+SELECT ?, id, 'used', ?, ?
+FROM destinations
+WHERE chat_id=?
+ON CONFLICT(vk_full_id, destination_id) DO UPDATE SET status='used', used_at=excluded.used_at, updated_at=excluded.updated_at;
+`, vkFullID, at, at, chatID)
+	return err
+}
+
+// undoDestUsedTx: после отмены публикации в чат-назначение — used_at по оставшимся
+// публикациям в этот чат, а если их нет — пост снова new в назначении.
+// Отметку banned отмена не трогает.
+func undoDestUsedTx(tx *Tx, vkFullID string, chatID, now int64) error {
+	var lastAt int64
+	if err := tx.QueryRow(`
+SELECT COALESCE(MAX(published_at), 0) FROM publications
+WHERE vk_full_id=? AND chat_id=? AND undone_at=0;
+`, vkFullID, chatID).Scan(&lastAt); err != nil {
+		return err
+	}
+	if lastAt == 0 {
+		_, err := tx.Exec(`
+DELETE FROM post_destinations
+WHERE vk_full_id=? AND status='used' AND destination_id IN (SELECT id FROM destinations WHERE chat_id=?);
+`, vkFullID, chatID)
+		return err
+	}
+	_, err := tx.Exec(`
+UPDATE post_destinations
+SET used_at=?, updated_at=?
+WHERE vk_full_id=? AND status='used' AND destination_id IN (SELECT id FROM destinations WHERE chat_id=?);
+`, lastAt, now, vkFullID, chatID)
+	return err
+}
@@ -0,0 +1,33 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleSlot(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		tm, err := time.ParseInLocation(slotLayout, s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	const sched = "09:00,18:00"
+	for _, c := range []struct {
+		sched, now, want string
+	}{
+		{"", "2026-03-10 12:00", ""},
+		{sched, "2026-03-10 12:00", "2026-03-10 09:00"},
+		{sched, "2026-03-10 09:00", "2026-03-10 09:00"}, // ровно в слот
+		{sched, "2026-03-10 23:59", "2026-03-10 18:00"},
+		{sched, "2026-03-10 08:59", "2026-03-09 18:00"}, // до первого — вчерашний последний
+		{sched, "2027-01-01 00:30", "2026-12-31 18:00"},
+		{"12:00", "2026-03-01 11:00", "2026-02-28 12:00"},
+	} {
+		if got := ScheduleSlot(c.sched, at(c.now)); got != c.want {
+			t.Errorf("ScheduleSlot(%q, %s) = %q, want %q", c.sched, c.now, got, c.want)
+		}
+	}
+}
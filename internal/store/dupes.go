@@ -0,0 +1,518 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DupeMaxDistance: сколько бит dHash из 64 могут отличаться у одной и той же картинки.
+// Не больше 7 — на этом держится hashIndex.
+const DupeMaxDistance = 6
+
+// MediaThumb: превью фото поста, которому ещё нужен хэш
+type MediaThumb struct {
+	VKFullID string
+	Idx      int
+	URL      string
+}
+
+// DupeCluster: посты с похожими фото
+type DupeCluster struct {
+	Posts []Post
+}
+
+func (s *Store) ensureDupesSchema(ctx context.Context) error {
+	cols, err := s.tableColumns(ctx, "posts")
+	if err != nil {
+		return err
+	}
+	if !cols["duplicate_of"] {
+		if _, err := s.db.ExecSchema(ctx, `ALTER TABLE posts ADD COLUMN duplicate_of TEXT NOT NULL DEFAULT '';`); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.db.ExecSchema(ctx, `CREATE INDEX IF NOT EXISTS idx_posts_duplicate_of ON posts(duplicate_of);`); err != nil {
+		return err
+	}
+	// индексы по 16-битным кускам phash: кандидаты в дубли ищутся, как в hashIndex
+	for k := range 4 {
+		if _, err := s.db.ExecSchema(ctx, fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS idx_media_phash%d ON media((%s));`, k, phashPart(k))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// phashPart: SQL-выражение k-го 16-битного куска phash, то же, что в индексе idx_media_phash<k>
+func phashPart(k int) string {
+	return fmt.Sprintf("(phash >> %d) & 65535", 16*k)
+}
+
+// nearParts: k-й кусок h и все куски, отличающиеся от него на 1 бит
+func nearParts(h uint64, k int) [17]uint16 {
+	part := uint16(h >> (16 * k))
+	out := [17]uint16{part}
+	for flip := range 16 {
+		out[flip+1] = part ^ 1<<flip
+	}
+	return out
+}
+
+// PendingThumbs: превью без хэша (и без неудачной попытки скачать)
+func (s *Store) PendingThumbs(limit int) ([]MediaThumb, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := s.db.Query(`
+SELECT vk_full_id, idx, thumb_url
+FROM media
+WHERE phash IS NULL AND status='ok' AND thumb_url != ''
+ORDER BY rowid
+LIMIT ?;
+`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []MediaThumb{}
+	for rows.Next() {
+		var m MediaThumb
+		if err := rows.Scan(&m.VKFullID, &m.Idx, &m.URL); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) SetMediaHash(vkFullID string, idx int, hash uint64) error {
+	_, err := s.db.Exec(`
+UPDATE media SET phash=?, status='ok', updated_at=?
+WHERE vk_full_id=? AND idx=?;
+`, int64(hash), time.Now().Unix(), vkFullID, idx)
+	return err
+}
+
+// SetMediaHashFailed: превью не скачалось/не разобралось — не пробуем снова, пока VK не даст другое фото
+func (s *Store) SetMediaHashFailed(vkFullID string, idx int) error {
+	_, err := s.db.Exec(`
+UPDATE media SET status='broken', updated_at=?
+WHERE vk_full_id=? AND idx=?;
+`, time.Now().Unix(), vkFullID, idx)
+	return err
+}
+
+type mediaHash struct {
+	vkFullID string
+	hash     uint64
+}
+
+func loadMediaHashes(q interface {
+	Query(string, ...any) (*sql.Rows, error)
+}) ([]mediaHash, error) {
+	rows, err := q.Query(`SELECT vk_full_id, phash FROM media WHERE phash IS NOT NULL;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []mediaHash
+	for rows.Next() {
+		var m mediaHash
+		var h int64
+		if err := rows.Scan(&m.vkFullID, &h); err != nil {
+			return nil, err
+		}
+		m.hash = uint64(h)
+		if m.hash == 0 {
+			continue // однотонная картинка: у всех таких хэш 0, это не дубли
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// markDuplicatesTx: new-посты с похожим фото на vkFullID становятся duplicate.
+// duplicate_of помнит, из-за чего, — чтобы откатить при /undo.
+func markDuplicatesTx(tx *Tx, vkFullID string, now int64) error {
+	own, err := loadPostHashes(tx, vkFullID)
+	if err != nil {
+		return err
+	}
+
+	dupes := map[string]bool{}
+	for _, h := range own {
+		near, err := nearMediaHashes(tx, h)
+		if err != nil {
+			return err
+		}
+		for _, m := range near {
+			if m.vkFullID != vkFullID {
+				dupes[m.vkFullID] = true
+			}
+		}
+	}
+
+	for id := range dupes {
+		if _, err := tx.Exec(`
+UPDATE posts SET status='duplicate', duplicate_of=?, updated_at=?
+WHERE vk_full_id=? AND status='new';
+`, vkFullID, now, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPostHashes: хэши фото одного поста, без однотонных (как loadMediaHashes)
+func loadPostHashes(tx *Tx, vkFullID string) ([]uint64, error) {
+	rows, err := tx.Query(`SELECT phash FROM media WHERE vk_full_id=? AND phash IS NOT NULL;`, vkFullID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []uint64
+	for rows.Next() {
+		var h int64
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		if h != 0 {
+			out = append(out, uint64(h))
+		}
+	}
+	return out, rows.Err()
+}
+
+// nearMediaHashes: фото с хэшем на расстоянии ≤ DupeMaxDistance от h.
+// Кандидаты берутся по индексам кусков phash (см. hashIndex), а не из всей media.
+func nearMediaHashes(tx *Tx, h uint64) ([]mediaHash, error) {
+	q, args := nearHashesQuery(h)
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []mediaHash
+	for rows.Next() {
+		var m mediaHash
+		var ph int64
+		if err := rows.Scan(&m.vkFullID, &ph); err != nil {
+			return nil, err
+		}
+		m.hash = uint64(ph)
+		if m.hash != 0 && bits.OnesCount64(h^m.hash) <= DupeMaxDistance {
+			out = append(out, m)
+		}
+	}
+	return out, rows.Err()
+}
+
+// unmarkDuplicatesTx: обратное markDuplicatesTx, когда публикацию отменили
+func unmarkDuplicatesTx(tx *Tx, vkFullID string, now int64) error {
+	_, err := tx.Exec(`
+UPDATE posts SET status='new', duplicate_of='', updated_at=?
+WHERE duplicate_of=? AND status='duplicate';
+`, now, vkFullID)
+	return err
+}
+
+func nearHashesQuery(h uint64) (string, []any) {
+	var q strings.Builder
+	args := make([]any, 0, 4*17)
+	for k := range 4 {
+		if k > 0 {
+			q.WriteString("\nUNION\n")
+		}
+		fmt.Fprintf(&q, "SELECT vk_full_id, phash FROM media WHERE %s IN (?%s)", phashPart(k), strings.Repeat(", ?", 16))
+		for _, p := range nearParts(h, k) {
+			args = append(args, int64(p))
+		}
+	}
+	return q.String() + ";", args
+}
+
+// hashIndex: хэши, похожие на данный (≤ DupeMaxDistance бит), без сравнения всех
+// со всеми. Хэш режется на 4 куска по 16 бит: если хэши отличаются не больше чем
+// на 6 бит, хотя бы в одном куске отличий ≤ 1 (иначе их ≥ 2·4 = 8). Поэтому
+// кандидаты — в корзинах куска и его 16 соседей на 1 бит: 4·17 корзин вместо всех хэшей.
+type hashIndex struct {
+	hashes  []mediaHash
+	buckets [4]map[uint16][]int
+}
+
+func newHashIndex(hashes []mediaHash) *hashIndex {
+	ix := &hashIndex{hashes: hashes}
+	for k := range ix.buckets {
+		ix.buckets[k] = map[uint16][]int{}
+	}
+	for i, m := range hashes {
+		for k := range ix.buckets {
+			part := uint16(m.hash >> (16 * k))
+			ix.buckets[k][part] = append(ix.buckets[k][part], i)
+		}
+	}
+	return ix
+}
+
+// near: индексы хэшей на расстоянии ≤ DupeMaxDistance от h, каждый один раз
+func (ix *hashIndex) near(h uint64) []int {
+	seen := map[int]bool{}
+	var out []int
+	for k := range ix.buckets {
+		for _, q := range nearParts(h, k) {
+			for _, i := range ix.buckets[k][q] {
+				if seen[i] {
+					continue
+				}
+				seen[i] = true
+				if bits.OnesCount64(h^ix.hashes[i].hash) <= DupeMaxDistance {
+					out = append(out, i)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// DupeClusters: группы постов с похожими фото (любые статусы, кроме banned),
+// самые большие группы сверху. Похожесть транзитивна: A~B и B~C — одна группа.
+func (s *Store) DupeClusters(limit int) ([]DupeCluster, error) {
+	all, err := loadMediaHashes(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	// union-find по постам
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(x string) string {
+		if parent[x] == "" || parent[x] == x {
+			parent[x] = x
+			return x
+		}
+		parent[x] = find(parent[x])
+		return parent[x]
+	}
+	ix := newHashIndex(all)
+	for i, m := range all {
+		for _, j := range ix.near(m.hash) {
+			if j <= i || all[j].vkFullID == m.vkFullID {
+				continue
+			}
+			a, b := find(m.vkFullID), find(all[j].vkFullID)
+			if a != b {
+				parent[a] = b
+			}
+		}
+	}
+
+	groups := map[string][]string{}
+	var ids []string
+	for id := range parent {
+		root := find(id)
+		groups[root] = append(groups[root], id)
+	}
+	for _, g := range groups {
+		if len(g) >= 2 {
+			ids = append(ids, g...)
+		}
+	}
+	posts, err := s.postsByID(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []DupeCluster
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		var c DupeCluster
+		for _, id := range g {
+			if p, ok := posts[id]; ok && p.Status != "banned" {
+				c.Posts = append(c.Posts, p)
+			}
+		}
+		if len(c.Posts) < 2 {
+			continue
+		}
+		sort.Slice(c.Posts, func(i, j int) bool { return c.Posts[i].VKDate < c.Posts[j].VKDate })
+		out = append(out, c)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if len(out[i].Posts) != len(out[j].Posts) {
+			return len(out[i].Posts) > len(out[j].Posts)
+		}
+		return out[i].Posts[0].VKFullID < out[j].Posts[0].VKFullID
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// postsByID: посты с фото пачками по 500, как attachMedia
+func (s *Store) postsByID(ids []string) (map[string]Post, error) {
+	const chunk = 500
+	out := make(map[string]Post, len(ids))
+	for lo := 0; lo < len(ids); lo += chunk {
+		part := ids[lo:min(lo+chunk, len(ids))]
+		args := make([]any, 0, len(part))
+		for _, id := range part {
+			args = append(args, id)
+		}
+		rows, err := s.db.Query(`
+SELECT `+postCols+`
+FROM posts
+WHERE vk_full_id IN (?`+strings.Repeat(", ?", len(args)-1)+`);
+`, args...)
+		if err != nil {
+			return nil, err
+		}
+		var posts []Post
+		for rows.Next() {
+			p, err := scanPost(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if !validStatus(p.Status) {
+				p.Status = "new"
+			}
+			posts = append(posts, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.attachMedia(posts); err != nil {
+			return nil, err
+		}
+		for _, p := range posts {
+			out[p.VKFullID] = p
+		}
+	}
+	return out, nil
+}
+
+// HashPendingThumbs: досчитывает хэши всех превью без хэша и сверяет посты с новыми
+// хэшами с опубликованными (markHashedDuplicates).
+// hash качает и хэширует картинку (phash.Fetcher.Hash); ошибка по одной картинке не останавливает проход.
+func (s *Store) HashPendingThumbs(hash func(url string) (uint64, error)) (hashed, failed int, err error) {
+	touched := map[string]bool{}
+	for {
+		batch, err := s.PendingThumbs(100)
+		if err != nil {
+			return hashed, failed, err
+		}
+		if len(batch) == 0 {
+			return hashed, failed, s.markHashedDuplicates(touched)
+		}
+		for _, m := range batch {
+			h, herr := hash(m.URL)
+			if herr != nil {
+				failed++
+				err = s.SetMediaHashFailed(m.VKFullID, m.Idx)
+			} else {
+				hashed++
+				touched[m.VKFullID] = true
+				err = s.SetMediaHash(m.VKFullID, m.Idx, h)
+			}
+			if err != nil {
+				return hashed, failed, err
+			}
+		}
+	}
+}
+
+// markHashedDuplicates: то же, что markDuplicatesTx при публикации, для постов, чьи
+// хэши посчитаны позже: new-пост, похожий на опубликованный, становится duplicate,
+// а если опубликован сам пост — duplicate становятся похожие на него new.
+// Опубликован — есть действующая публикация в любой чат (как у unmarkDuplicatesTx).
+func (s *Store) markHashedDuplicates(ids map[string]bool) (err error) {
+	if len(ids) == 0 {
+		return nil
+	}
+	all, err := loadMediaHashes(s.db)
+	if err != nil {
+		return err
+	}
+	published := map[string]bool{}
+	status := map[string]string{}
+	rows, err := s.db.Query(`
+SELECT p.vk_full_id, p.status,
+       EXISTS (SELECT 1 FROM publications pb WHERE pb.vk_full_id = p.vk_full_id AND pb.undone_at = 0)
+FROM posts p
+WHERE p.vk_full_id IN (SELECT vk_full_id FROM media WHERE phash IS NOT NULL);
+`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id, st string
+		var pub bool
+		if err := rows.Scan(&id, &st, &pub); err != nil {
+			rows.Close()
+			return err
+		}
+		status[id], published[id] = st, pub
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// дубль -> из-за какого опубликованного
+	dupeOf := map[string]string{}
+	ix := newHashIndex(all)
+	for _, m := range all {
+		if !ids[m.vkFullID] {
+			continue
+		}
+		for _, j := range ix.near(m.hash) {
+			other := all[j].vkFullID
+			switch {
+			case other == m.vkFullID:
+			case published[m.vkFullID] && status[other] == "new" && dupeOf[other] == "":
+				dupeOf[other] = m.vkFullID
+			case published[other] && status[m.vkFullID] == "new" && dupeOf[m.vkFullID] == "":
+				dupeOf[m.vkFullID] = other
+			}
+		}
+	}
+	if len(dupeOf) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	now := time.Now().Unix()
+	for id, of := range dupeOf {
+		if _, err = tx.Exec(`
+UPDATE posts SET status='duplicate', duplicate_of=?, updated_at=?
+WHERE vk_full_id=? AND status='new';
+`, of, now, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// flipBits: h с n случайными разными перевёрнутыми битами
+func flipBits(r *rand.Rand, h uint64, n int) uint64 {
+	for _, b := range r.Perm(64)[:n] {
+		h ^= 1 << b
+	}
+	return h
+}
+
+// TestHashIndexNear: near находит ровно те хэши, что и перебор всех со всеми
+func TestHashIndexNear(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	var hashes []mediaHash
+	base := []uint64{0xF0F0F0F0F0F0F0F0, r.Uint64(), r.Uint64(), r.Uint64()}
+	for _, b := range base {
+		for d := 0; d <= DupeMaxDistance+2; d++ {
+			for range 20 {
+				hashes = append(hashes, mediaHash{hash: flipBits(r, b, d)})
+			}
+		}
+	}
+	// худший случай для кусков: отличия поровну по всем четырём
+	hashes = append(hashes,
+		mediaHash{hash: base[0] ^ 0x0003000300010001},
+		mediaHash{hash: base[0] ^ 0x0003000300030001},
+	)
+	for range 500 {
+		hashes = append(hashes, mediaHash{hash: r.Uint64()})
+	}
+
+	ix := newHashIndex(hashes)
+	for _, q := range append(base, r.Uint64()) {
+		var want []int
+		for i, m := range hashes {
+			if bits.OnesCount64(q^m.hash) <= DupeMaxDistance {
+				want = append(want, i)
+			}
+		}
+		got := ix.near(q)
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Fatalf("near(%016x): %d хэшей, перебором %d", q, len(got), len(want))
+		}
+	}
+}
+
+// TestNearHashesQueryUsesIndex: markDuplicatesTx не просматривает всю media
+func TestNearHashesQueryUsesIndex(t *testing.T) {
+	st := openTest(t)
+	q, args := nearHashesQuery(0xF0F0F0F0F0F0F0F0)
+	rows, err := st.db.Query("EXPLAIN QUERY PLAN "+q, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, detail)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for k := range 4 {
+		if !strings.Contains(strings.Join(plan, "\n"), "idx_media_phash"+strconv.Itoa(k)) {
+			t.Fatalf("план без idx_media_phash%d:\n%s", k, strings.Join(plan, "\n"))
+		}
+	}
+	for _, line := range plan {
+		if strings.HasPrefix(line, "SCAN media") {
+			t.Fatalf("полный просмотр media:\n%s", strings.Join(plan, "\n"))
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package store
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// политика импорта, когда пост уже есть в базе
+const (
+	ConflictKeepLocal = "keep"      // статус и контент остаются локальные, добавляются только теги и публикации
+	ConflictOverwrite = "overwrite" // пост целиком из файла
+	ConflictNewest    = "newest"    // побеждает версия с большим updated_at
+)
+
+var ConflictPolicies = []string{ConflictKeepLocal, ConflictOverwrite, ConflictNewest}
+
+// ExportRecord: одна строка JSON Lines — пост с тегами и историей публикаций
+type ExportRecord struct {
+	VKFullID  string        `json:"vk_full_id"`
+	VKOwnerID string        `json:"vk_owner_id"`
+	VKPostID  string        `json:"vk_post_id"`
+	Link      string        `json:"link"`
+	Text      string        `json:"text"`
+	MediaURLs []string      `json:"media"` // только ссылки — для старых версий и CSV
+	Photos    []ExportMedia `json:"photos,omitempty"`
+	Status    string        `json:"status"`
+	CreatedAt int64         `json:"created_at"`
+	UpdatedAt int64         `json:"updated_at"`
+	UsedAt    int64         `json:"used_at"`
+
+	VKDate     int64 `json:"vk_date"`
+	VKEditedAt int64 `json:"vk_edited_at"`
+	Likes      int   `json:"likes"`
+	Reposts    int   `json:"reposts"`
+	Views      int   `json:"views"`
+	Comments   int   `json:"comments"`
+	DeletedAt  int64 `json:"deleted_at,omitempty"`
+
+	Tags         []ExportTag         `json:"tags,omitempty"`
+	Publications []ExportPublication `json:"publications,omitempty"`
+	Destinations []ExportDestStatus  `json:"destinations,omitempty"`
+}
+
+// ExportMedia: фото поста целиком; phash — 16 hex-цифр, пусто — не посчитан
+type ExportMedia struct {
+	Type      string `json:"type"`
+	VKPhotoID string `json:"vk_photo_id,omitempty"`
+	URL       string `json:"url"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	ThumbURL  string `json:"thumb_url,omitempty"`
+	TGFileID  string `json:"tg_file_id,omitempty"`
+	PHash     string `json:"phash,omitempty"`
+	Status    string `json:"status,omitempty"`
+}
+
+type ExportTag struct {
+	Tag    string `json:"tag"`
+	Source string `json:"source"`
+}
+
+type ExportPublication struct {
+	ChatID      int64  `json:"chat_id"`
+	MessageIDs  []int  `json:"message_ids"`
+	PublishedAt int64  `json:"published_at"`
+	PublishedBy int64  `json:"published_by"`
+	Caption     string `json:"caption"`
+	UndoneAt    int64  `json:"undone_at,omitempty"`
+}
+
+// ExportDestStatus: статус поста в назначении. Назначение — по chat_id: id в другой
+// базе свои; name нужен, чтобы завести назначение, если его там нет.
+type ExportDestStatus struct {
+	ChatID    int64  `json:"chat_id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	UsedAt    int64  `json:"used_at,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// ImportStats: итог импорта
+type ImportStats struct {
+	Read         int
+	Inserted     int
+	Updated      int
+	Unchanged    int
+	Publications int // добавлено публикаций
+	Tags         int // добавлено тегов
+	Destinations int // добавлено или обновлено статусов в назначениях
+}
+
+// eachExportRecord: все посты в порядке загрузки, с тегами и публикациями
+func (s *Store) eachExportRecord(fn func(ExportRecord) error) (int, error) {
+	var posts []Post
+	if err := s.eachPost(`1=1`, func(p Post) { posts = append(posts, p) }); err != nil {
+		return 0, err
+	}
+
+	for _, p := range posts {
+		rec := ExportRecord{
+			VKFullID: p.VKFullID, VKOwnerID: p.VKOwnerID, VKPostID: p.VKPostID, Link: p.Link, Text: p.Text,
+			MediaURLs: p.MediaURLs(), Status: p.Status, CreatedAt: p.CreatedAt, UpdatedAt: p.UpdatedAt, UsedAt: p.UsedAt,
+			VKDate: p.VKDate, VKEditedAt: p.VKEditedAt, Likes: p.Likes, Reposts: p.Reposts, Views: p.Views, Comments: p.Comments,
+			DeletedAt: p.DeletedAt,
+		}
+
+		for _, m := range p.Media {
+			em := ExportMedia{
+				Type: m.Type, VKPhotoID: m.VKPhotoID, URL: m.URL, Width: m.Width, Height: m.Height,
+				ThumbURL: m.ThumbURL, TGFileID: m.TGFileID, Status: m.Status,
+			}
+			if m.HasPHash {
+				em.PHash = fmt.Sprintf("%016x", m.PHash)
+			}
+			rec.Photos = append(rec.Photos, em)
+		}
+
+		tags, err := s.postTagsWithSource(p.VKFullID)
+		if err != nil {
+			return 0, err
+		}
+		rec.Tags = tags
+
+		pubs, err := s.ListPublications(p.VKFullID)
+		if err != nil {
+			return 0, err
+		}
+		// в файле — в хронологическом порядке
+		for i := len(pubs) - 1; i >= 0; i-- {
+			pub := pubs[i]
+			rec.Publications = append(rec.Publications, ExportPublication{
+				ChatID: pub.ChatID, MessageIDs: pub.MessageIDs, PublishedAt: pub.PublishedAt,
+				PublishedBy: pub.PublishedBy, Caption: pub.Caption, UndoneAt: pub.UndoneAt,
+			})
+		}
+
+		if rec.Destinations, err = s.postDestStatuses(p.VKFullID); err != nil {
+			return 0, err
+		}
+
+		if err := fn(rec); err != nil {
+			return 0, err
+		}
+	}
+	return len(posts), nil
+}
+
+func (s *Store) postDestStatuses(vkFullID string) ([]ExportDestStatus, error) {
+	rows, err := s.db.Query(`
+SELECT d.chat_id, d.name, pd.status, pd.used_at, pd.updated_at
+FROM post_destinations pd JOIN destinations d ON d.id = pd.destination_id
+WHERE pd.vk_full_id=?
+ORDER BY d.chat_id;
+`, vkFullID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ExportDestStatus
+	for rows.Next() {
+		var ds ExportDestStatus
+		if err := rows.Scan(&ds.ChatID, &ds.Name, &ds.Status, &ds.UsedAt, &ds.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, ds)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) postTagsWithSource(vkFullID string) ([]ExportTag, error) {
+	rows, err := s.db.Query(`SELECT tag, source FROM post_tags WHERE vk_full_id=? ORDER BY tag;`, vkFullID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ExportTag
+	for rows.Next() {
+		var t ExportTag
+		if err := rows.Scan(&t.Tag, &t.Source); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// ExportJSONL: по посту на строку, со статусом, таймстемпами, фото, тегами и публикациями
+func (s *Store) ExportJSONL(w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+
+	n, err := s.eachExportRecord(func(rec ExportRecord) error {
+		return enc.Encode(rec)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, bw.Flush()
+}
+
+// ExportCSV: плоская таблица для таблиц; импорт из CSV не поддерживается — для переноса JSONL
+func (s *Store) ExportCSV(w io.Writer) (int, error) {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"vk_full_id", "link", "status", "created_at", "updated_at", "used_at",
+		"vk_date", "likes", "reposts", "views", "comments", "deleted_at",
+		"photos", "media", "tags", "publications", "last_published_at", "text",
+	}
+	if err := cw.Write(header); err != nil {
+		return 0, err
+	}
+
+	ts := func(v int64) string {
+		if v == 0 {
+			return ""
+		}
+		return time.Unix(v, 0).UTC().Format(time.RFC3339)
+	}
+
+	n, err := s.eachExportRecord(func(rec ExportRecord) error {
+		tags := make([]string, 0, len(rec.Tags))
+		for _, t := range rec.Tags {
+			if t.Source != TagRemoved {
+				tags = append(tags, t.Tag)
+			}
+		}
+		var lastPub int64
+		active := 0
+		for _, pub := range rec.Publications {
+			if pub.UndoneAt != 0 {
+				continue
+			}
+			active++
+			lastPub = max(lastPub, pub.PublishedAt)
+		}
+		return cw.Write([]string{
+			rec.VKFullID, rec.Link, rec.Status, ts(rec.CreatedAt), ts(rec.UpdatedAt), ts(rec.UsedAt),
+			ts(rec.VKDate), strconv.Itoa(rec.Likes), strconv.Itoa(rec.Reposts), strconv.Itoa(rec.Views), strconv.Itoa(rec.Comments), ts(rec.DeletedAt),
+			strconv.Itoa(len(rec.MediaURLs)), strings.Join(rec.MediaURLs, " "), strings.Join(tags, " "),
+			strconv.Itoa(active), ts(lastPub), rec.Text,
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// ImportJSONL: сливает файл ExportJSONL в базу по vk_full_id.
+// Повторный импорт того же файла ничего не меняет: теги и публикации не дублируются.
+func (s *Store) ImportJSONL(r io.Reader, policy string) (st ImportStats, err error) {
+	switch policy {
+	case ConflictKeepLocal, ConflictOverwrite, ConflictNewest:
+	default:
+		return st, fmt.Errorf("unknown conflict policy %q", policy)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return st, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := strings.TrimSpace(sc.Text())
+		if raw == "" {
+			continue
+		}
+		var rec ExportRecord
+		if err = json.Unmarshal([]byte(raw), &rec); err != nil {
+			return st, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.VKFullID == "" {
+			err = fmt.Errorf("line %d: empty vk_full_id", line)
+			return st, err
+		}
+		if !validStatus(rec.Status) {
+			rec.Status = "new"
+		}
+		st.Read++
+		if err = importRecord(tx, rec, policy, &st); err != nil {
+			return st, fmt.Errorf("line %d (%s): %w", line, rec.VKFullID, err)
+		}
+	}
+	if err = sc.Err(); err != nil {
+		return st, err
+	}
+
+	err = tx.Commit()
+	return st, err
+}
+
+// recordMedia: фото из photos, а в файлах старых версий — из media
+func recordMedia(rec ExportRecord) []Media {
+	if len(rec.Photos) == 0 {
+		return MediaFromURLs(rec.MediaURLs)
+	}
+	out := make([]Media, 0, len(rec.Photos))
+	for _, em := range rec.Photos {
+		m := Media{
+			Type: em.Type, VKPhotoID: em.VKPhotoID, URL: em.URL, Width: em.Width, Height: em.Height,
+			ThumbURL: em.ThumbURL, TGFileID: em.TGFileID, Status: em.Status,
+		}
+		if h, err := strconv.ParseUint(em.PHash, 16, 64); err == nil {
+			m.PHash, m.HasPHash = h, true
+		}
+		if m.Status != MediaOK && m.Status != MediaBroken {
+			m.Status = MediaOK
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func importRecord(tx *Tx, rec ExportRecord, policy string, st *ImportStats) error {
+	media := recordMedia(rec)
+	hash := ContentHash(rec.Text, Post{Media: media}.MediaURLs())
+
+	var localHash, localStatus string
+	var localUpdated, localUsed, localDeleted int64
+	err := tx.QueryRow(`SELECT content_hash, status, updated_at, used_at, deleted_at FROM posts WHERE vk_full_id=?;`, rec.VKFullID).
+		Scan(&localHash, &localStatus, &localUpdated, &localUsed, &localDeleted)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if _, err := tx.Exec(`
+INSERT INTO posts
+(vk_full_id, vk_owner_id, vk_post_id, link, text, status, created_at, updated_at, used_at,
+ vk_date, vk_edited_at, likes, reposts, views, comments, content_hash, deleted_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+`, rec.VKFullID, rec.VKOwnerID, rec.VKPostID, rec.Link, rec.Text, rec.Status,
+			rec.CreatedAt, rec.UpdatedAt, rec.UsedAt, rec.VKDate, rec.VKEditedAt,
+			rec.Likes, rec.Reposts, rec.Views, rec.Comments, hash, rec.DeletedAt); err != nil {
+			return err
+		}
+		if err := setMedia(tx, rec.VKFullID, media, time.Now().Unix()); err != nil {
+			return err
+		}
+		st.Inserted++
+
+	case err != nil:
+		return err
+
+	default:
+		overwrite := policy == ConflictOverwrite || (policy == ConflictNewest && rec.UpdatedAt > localUpdated)
+		same := localHash == hash && localStatus == rec.Status && localUpdated == rec.UpdatedAt &&
+			localUsed == rec.UsedAt && localDeleted == rec.DeletedAt
+		if !overwrite || same {
+			st.Unchanged++
+			break
+		}
+		if _, err := tx.Exec(`
+UPDATE posts
+SET vk_owner_id=?, vk_post_id=?, link=?, text=?, status=?, created_at=?, updated_at=?, used_at=?,
+    vk_date=?, vk_edited_at=?, likes=?, reposts=?, views=?, comments=?, content_hash=?, deleted_at=?
+WHERE vk_full_id=?;
+`, rec.VKOwnerID, rec.VKPostID, rec.Link, rec.Text, rec.Status,
+			rec.CreatedAt, rec.UpdatedAt, rec.UsedAt, rec.VKDate, rec.VKEditedAt,
+			rec.Likes, rec.Reposts, rec.Views, rec.Comments, hash, rec.DeletedAt, rec.VKFullID); err != nil {
+			return err
+		}
+		if err := setMedia(tx, rec.VKFullID, media, time.Now().Unix()); err != nil {
+			return err
+		}
+		st.Updated++
+	}
+
+	for _, t := range rec.Tags {
+		tag := NormalizeTag(t.Tag)
+		if tag == "" {
+			continue
+		}
+		src := t.Source
+		if src != TagAuto && src != TagManual && src != TagRemoved {
+			src = TagManual
+		}
+		res, err := tx.Exec(`
+INSERT INTO post_tags (vk_full_id, tag, source, created_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT DO NOTHING;
+`, rec.VKFullID, tag, src, time.Now().Unix())
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			st.Tags++
+		}
+	}
+
+	// публикация одна и та же, если совпали чат, время и сообщения
+	for _, pub := range rec.Publications {
+		msgJSON, _ := json.Marshal(pub.MessageIDs)
+		var n int
+		if err := tx.QueryRow(`
+SELECT COUNT(*) FROM publications
+WHERE vk_full_id=? AND chat_id=? AND published_at=? AND message_ids=?;
+`, rec.VKFullID, pub.ChatID, pub.PublishedAt, string(msgJSON)).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := tx.Exec(`
+INSERT INTO publications (vk_full_id, chat_id, message_ids, published_at, published_by, caption, undone_at)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+`, rec.VKFullID, pub.ChatID, string(msgJSON), pub.PublishedAt, pub.PublishedBy, pub.Caption, pub.UndoneAt); err != nil {
+			return err
+		}
+		st.Publications++
+	}
+
+	// статусы в назначениях: по той же политике, что и пост
+	onConflict := `DO NOTHING`
+	switch policy {
+	case ConflictOverwrite:
+		onConflict = `DO UPDATE SET status=excluded.status, used_at=excluded.used_at, updated_at=excluded.updated_at`
+	case ConflictNewest:
+		onConflict = `DO UPDATE SET status=excluded.status, used_at=excluded.used_at, updated_at=excluded.updated_at
+  WHERE excluded.updated_at > post_destinations.updated_at`
+	}
+	for _, ds := range rec.Destinations {
+		if !validDestStatus(ds.Status) || ds.Status == "new" {
+			continue
+		}
+		destID, err := importDestinationTx(tx, ds)
+		if err != nil {
+			return err
+		}
+		if destID == 0 {
+			continue
+		}
+		res, err := tx.Exec(`
+INSERT INTO post_destinations (vk_full_id, destination_id, status, used_at, updated_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(vk_full_id, destination_id) `+onConflict+`;
+`, rec.VKFullID, destID, ds.Status, ds.UsedAt, ds.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			st.Destinations++
+		}
+	}
+	return nil
+}
+
+// importDestinationTx: id назначения с chat_id из файла; если его нет — заводит
+// (включённым, без расписания и шаблона). 0 — имя занято другим чатом, статус пропускаем.
+func importDestinationTx(tx *Tx, ds ExportDestStatus) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM destinations WHERE chat_id=?;`, ds.ChatID).Scan(&id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return id, err
+	}
+
+	d := Destination{ChatID: ds.ChatID, Name: ds.Name}
+	if err := d.normalize(); err != nil {
+		return 0, nil
+	}
+	now := time.Now()
+	if _, err := tx.Exec(`
+INSERT INTO destinations (chat_id, name, enabled, last_slot, created_at)
+VALUES (?, ?, 1, ?, ?)
+ON CONFLICT DO NOTHING;
+`, d.ChatID, d.Name, now.Format(slotLayout), now.Unix()); err != nil {
+		return 0, err
+	}
+	err = tx.QueryRow(`SELECT id FROM destinations WHERE chat_id=?;`, ds.ChatID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
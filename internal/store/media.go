@@ -0,0 +1,365 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// тип вложения
+const MediaPhoto = "photo"
+
+// статус фото
+const (
+	MediaOK     = "ok"
+	MediaBroken = "broken" // превью не скачалось/не разобралось — хэш не считаем, пока VK не даст другое фото
+)
+
+// Media: одно фото поста, строка таблицы media
+type Media struct {
+	Type      string // MediaPhoto
+	VKPhotoID string // "<owner>_<id>", пусто у постов из старых баз
+	URL       string // самый большой размер
+	Width     int
+	Height    int
+	ThumbURL  string // самый маленький размер, для перцептивного хэша
+	TGFileID  string // file_id в Telegram после первой отправки: повторно фото не качается
+	PHash     uint64 // dHash превью, если HasPHash
+	HasPHash  bool
+	Status    string // MediaOK, MediaBroken
+}
+
+// MediaURLs: ссылки на фото по порядку — как раньше хранилось в media_json
+func (p Post) MediaURLs() []string {
+	out := make([]string, 0, len(p.Media))
+	for _, m := range p.Media {
+		out = append(out, m.URL)
+	}
+	return out
+}
+
+// MediaFromURLs: фото только по ссылкам (старый экспорт, тесты)
+func MediaFromURLs(urls []string) []Media {
+	out := make([]Media, 0, len(urls))
+	for _, u := range urls {
+		out = append(out, Media{Type: MediaPhoto, URL: u, Status: MediaOK})
+	}
+	return out
+}
+
+// photoKey: путь фото без хоста и подписи — по нему понимаем, что фото то же
+func photoKey(u string) string {
+	if pu, err := url.Parse(u); err == nil && pu.Path != "" {
+		return pu.Path
+	}
+	return u
+}
+
+// mediaColumns: колонки media; фото живут, пока жив пост (в SQLite foreign_keys включён прагмой)
+const mediaColumns = `(
+  vk_full_id  TEXT NOT NULL REFERENCES posts(vk_full_id) ON DELETE CASCADE,
+  idx         INTEGER NOT NULL,
+  type        TEXT NOT NULL DEFAULT 'photo',
+  vk_photo_id TEXT NOT NULL DEFAULT '',
+  url         TEXT NOT NULL,
+  photo_key   TEXT NOT NULL DEFAULT '',
+  width       INTEGER NOT NULL DEFAULT 0,
+  height      INTEGER NOT NULL DEFAULT 0,
+  thumb_url   TEXT NOT NULL DEFAULT '',
+  tg_file_id  TEXT NOT NULL DEFAULT '',
+  phash       INTEGER,
+  status      TEXT NOT NULL DEFAULT 'ok',
+  updated_at  INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (vk_full_id, idx)
+)`
+
+// ensureMediaSchema: таблица media. Старые базы хранили ссылки в posts.media_json,
+// а превью и хэши — в media_hashes; переносим и то, и другое и убираем старое.
+func (s *Store) ensureMediaSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS media `+mediaColumns+`;
+
+CREATE INDEX IF NOT EXISTS idx_media_pending ON media(phash, status);
+`)
+	if err != nil {
+		return err
+	}
+	if s.db.pg {
+		// явный rowid, как у posts: порядок PendingThumbs
+		cols, err := s.tableColumns(ctx, "media")
+		if err != nil {
+			return err
+		}
+		if !cols["rowid"] {
+			if _, err := s.db.ExecSchema(ctx, `ALTER TABLE media ADD COLUMN rowid BIGSERIAL UNIQUE;`); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.migrateMediaJSON(ctx); err != nil {
+		return err
+	}
+	return s.ensureMediaFK(ctx)
+}
+
+const mediaAllCols = `vk_full_id, idx, type, vk_photo_id, url, photo_key, width, height, thumb_url, tg_file_id, phash, status, updated_at`
+
+// ensureMediaFK: media из баз до внешнего ключа на posts. Фото постов, которых
+// уже нет, удаляются. SQLite не умеет ADD CONSTRAINT — таблица пересобирается.
+func (s *Store) ensureMediaFK(ctx context.Context) (err error) {
+	q := `SELECT COUNT(*) FROM pragma_foreign_key_list('media');`
+	if s.db.pg {
+		q = `SELECT COUNT(*) FROM information_schema.table_constraints
+WHERE table_schema=current_schema() AND table_name='media' AND constraint_type='FOREIGN KEY';`
+	}
+	var n int
+	if err := s.db.QueryRowContext(ctx, q).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(`DELETE FROM media WHERE vk_full_id NOT IN (SELECT vk_full_id FROM posts);`); err != nil {
+		return err
+	}
+	if s.db.pg {
+		_, err = tx.Exec(`
+ALTER TABLE media ADD CONSTRAINT media_vk_full_id_fkey
+  FOREIGN KEY (vk_full_id) REFERENCES posts(vk_full_id) ON DELETE CASCADE;
+`)
+	} else {
+		_, err = tx.Exec(`
+CREATE TABLE media_fk ` + mediaColumns + `;
+INSERT INTO media_fk (` + mediaAllCols + `) SELECT ` + mediaAllCols + ` FROM media ORDER BY rowid;
+DROP TABLE media;
+ALTER TABLE media_fk RENAME TO media;
+CREATE INDEX IF NOT EXISTS idx_media_pending ON media(phash, status);
+`)
+	}
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	return err
+}
+
+// migrateMediaJSON: posts.media_json и media_hashes -> media (SQLite и PostgreSQL)
+func (s *Store) migrateMediaJSON(ctx context.Context) (err error) {
+	cols, err := s.tableColumns(ctx, "posts")
+	if err != nil {
+		return err
+	}
+	if !cols["media_json"] {
+		return nil
+	}
+	hashes, err := s.tableExists(ctx, "media_hashes")
+	if err != nil {
+		return err
+	}
+
+	type item struct{ id, mediaJSON string }
+	var items []item
+	rows, err := s.db.QueryContext(ctx, `SELECT vk_full_id, media_json FROM posts WHERE media_json != '[]';`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.id, &it.mediaJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().Unix()
+	for _, it := range items {
+		// битый media_json не пропускаем: ниже колонка удаляется, фото пропали бы молча
+		var urls []string
+		if err = json.Unmarshal([]byte(it.mediaJSON), &urls); err != nil {
+			err = fmt.Errorf("media_json of %s: %w (fix or clear the row, then restart)", it.id, err)
+			return err
+		}
+		for i, u := range urls {
+			if _, err = tx.Exec(`
+INSERT INTO media (vk_full_id, idx, url, photo_key, updated_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT DO NOTHING;
+`, it.id, i, u, photoKey(u), now); err != nil {
+				return err
+			}
+		}
+	}
+
+	if hashes {
+		// превью и посчитанные хэши; failed_at -> status='broken'
+		if _, err = tx.Exec(`
+UPDATE media SET
+  thumb_url = (SELECT h.thumb_url FROM media_hashes h WHERE h.vk_full_id=media.vk_full_id AND h.idx=media.idx),
+  phash     = (SELECT h.dhash FROM media_hashes h WHERE h.vk_full_id=media.vk_full_id AND h.idx=media.idx),
+  status    = (SELECT CASE WHEN h.failed_at > 0 THEN 'broken' ELSE 'ok' END
+               FROM media_hashes h WHERE h.vk_full_id=media.vk_full_id AND h.idx=media.idx)
+WHERE EXISTS (SELECT 1 FROM media_hashes h WHERE h.vk_full_id=media.vk_full_id AND h.idx=media.idx);
+`); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`DROP TABLE media_hashes;`); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(`ALTER TABLE posts DROP COLUMN media_json;`); err != nil {
+		return err
+	}
+	err = tx.Commit()
+	return err
+}
+
+// setMedia: фото поста по порядку. Если на позиции то же фото (photo_key),
+// хэш, статус и file_id в Telegram остаются. Пустой media — фото в посте больше нет,
+// строки удаляются; nil — фото неизвестны, ничего не трогаем.
+func setMedia(tx *Tx, vkFullID string, media []Media, now int64) error {
+	if media == nil {
+		return nil
+	}
+	for i, m := range media {
+		if m.Type == "" {
+			m.Type = MediaPhoto
+		}
+		if m.Status == "" {
+			m.Status = MediaOK
+		}
+		var phash any
+		if m.HasPHash {
+			phash = int64(m.PHash)
+		}
+		if _, err := tx.Exec(`
+INSERT INTO media (vk_full_id, idx, type, vk_photo_id, url, photo_key, width, height, thumb_url, tg_file_id, phash, status, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(vk_full_id, idx) DO UPDATE SET
+  type=excluded.type,
+  vk_photo_id=excluded.vk_photo_id,
+  url=excluded.url,
+  width=excluded.width,
+  height=excluded.height,
+  thumb_url=CASE WHEN excluded.thumb_url='' AND media.photo_key=excluded.photo_key THEN media.thumb_url ELSE excluded.thumb_url END,
+  tg_file_id=CASE WHEN excluded.tg_file_id='' AND media.photo_key=excluded.photo_key THEN media.tg_file_id ELSE excluded.tg_file_id END,
+  phash=CASE WHEN excluded.phash IS NULL AND media.photo_key=excluded.photo_key THEN media.phash ELSE excluded.phash END,
+  status=CASE WHEN excluded.phash IS NULL AND media.photo_key=excluded.photo_key THEN media.status ELSE excluded.status END,
+  photo_key=excluded.photo_key,
+  updated_at=excluded.updated_at;
+`, vkFullID, i, m.Type, m.VKPhotoID, m.URL, photoKey(m.URL), m.Width, m.Height, m.ThumbURL, m.TGFileID, phash, m.Status, now); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`DELETE FROM media WHERE vk_full_id=? AND idx>=?;`, vkFullID, len(media))
+	return err
+}
+
+const mediaCols = `vk_full_id, type, vk_photo_id, url, width, height, thumb_url, tg_file_id, phash, status`
+
+func scanMedia(sc interface{ Scan(...any) error }) (string, Media, error) {
+	var id string
+	var m Media
+	var phash sql.NullInt64
+	err := sc.Scan(&id, &m.Type, &m.VKPhotoID, &m.URL, &m.Width, &m.Height, &m.ThumbURL, &m.TGFileID, &phash, &m.Status)
+	m.PHash, m.HasPHash = uint64(phash.Int64), phash.Valid
+	return id, m, err
+}
+
+// attachMedia: Post.Media для уже прочитанных постов, пачками по 500
+func (s *Store) attachMedia(posts []Post) error {
+	const chunk = 500
+	for lo := 0; lo < len(posts); lo += chunk {
+		part := posts[lo:min(lo+chunk, len(posts))]
+		at := make(map[string]int, len(part))
+		args := make([]any, 0, len(part))
+		for i, p := range part {
+			at[p.VKFullID] = i
+			args = append(args, p.VKFullID)
+		}
+		rows, err := s.db.Query(`
+SELECT `+mediaCols+`
+FROM media
+WHERE vk_full_id IN (?`+strings.Repeat(", ?", len(args)-1)+`)
+ORDER BY vk_full_id, idx;
+`, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			id, m, err := scanMedia(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if i, ok := at[id]; ok {
+				part[i].Media = append(part[i].Media, m)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMediaFileIDs: file_id фото после отправки в Telegram, по порядку; пустые пропускаем
+func (s *Store) SetMediaFileIDs(vkFullID string, fileIDs []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().Unix()
+	for i, id := range fileIDs {
+		if id == "" {
+			continue
+		}
+		if _, err = tx.Exec(`UPDATE media SET tg_file_id=?, updated_at=? WHERE vk_full_id=? AND idx=?;`, id, now, vkFullID, i); err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	return err
+}
+
+// ClearMediaFileIDs: Telegram не принял file_id (другой бот, протухли) — дальше шлём по URL
+func (s *Store) ClearMediaFileIDs(vkFullID string) error {
+	_, err := s.db.Exec(`UPDATE media SET tg_file_id='', updated_at=? WHERE vk_full_id=?;`, time.Now().Unix(), vkFullID)
+	return err
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// PickOnThisDay: случайный new, опубликованный в VK в этот же день (±window дней)
+// в прошлые годы — не ближе, чем за год до day. Если таких нет — обычный
+// PickRandomNew, matched=false.
+func (s *Store) PickOnThisDay(day time.Time, window int) (p *Post, matched bool, err error) {
+	return s.pickOnThisDay(day, window, 0)
+}
+
+// pickOnThisDay: PickOnThisDay в очереди назначения dest (0 — общая)
+func (s *Store) pickOnThisDay(day time.Time, window int, dest int64) (p *Post, matched bool, err error) {
+	if window < 0 {
+		window = 0
+	}
+
+	days := make([]string, 0, 2*window+1)
+	args := make([]any, 0, 2*window+2)
+	for d := -window; d <= window; d++ {
+		days = append(days, "?")
+		args = append(args, day.AddDate(0, 0, d).Format("01-02"))
+	}
+	// «прошлый год» — по дате, а не по номеру года: 2 января с окном 3 пост от
+	// 30 декабря совпадает по дню, но ему три дня. Граница — начало дня после
+	// day-1год+window в часовом поясе day.
+	edge := day.AddDate(-1, 0, window+1)
+	args = append(args, time.Date(edge.Year(), edge.Month(), edge.Day(), 0, 0, 0, 0, day.Location()).Unix())
+	cond, condArgs := newCond(dest)
+
+	// 'localtime' — день считаем в часовом поясе бота (TZ);
+	// в PostgreSQL — в часовом поясе сессии (OpenPostgres выставляет его из TZ)
+	monthDay := `strftime('%m-%d', vk_date, 'unixepoch', 'localtime')`
+	if s.db.pg {
+		monthDay = `to_char(to_timestamp(vk_date), 'MM-DD')`
+	}
+	row := s.db.QueryRow(`
+SELECT `+postCols+`
+FROM posts
+WHERE `+cond+`
+  AND vk_date > 0
+  AND `+monthDay+` IN (`+strings.Join(days, ",")+`)
+  AND vk_date < ?
+ORDER BY RANDOM()
+LIMIT 1;
+`, append(condArgs, args...)...)
+
+	post, err := s.onePost(row)
+	if err != nil {
+		return nil, false, err
+	}
+	if post != nil {
+		return post, true, nil
+	}
+
+	p, err = s.pickRandom(dest, "")
+	return p, false, err
+}
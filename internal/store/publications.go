@@ -0,0 +1,322 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Publication: одна отправка поста в чат
+type Publication struct {
+	ID          int64
+	VKFullID    string
+	ChatID      int64
+	MessageIDs  []int
+	PublishedAt int64
+	PublishedBy int64
+	Caption     string
+	UndoneAt    int64 // 0 — действует; иначе отменена через /undo
+}
+
+func (s *Store) ensurePublicationsSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS publications (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  vk_full_id   TEXT NOT NULL,
+  chat_id      INTEGER NOT NULL,
+  message_ids  TEXT NOT NULL DEFAULT '[]',
+  published_at INTEGER NOT NULL DEFAULT 0,
+  published_by INTEGER NOT NULL DEFAULT 0,
+  caption      TEXT NOT NULL DEFAULT '',
+  undone_at    INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_publications_post ON publications(vk_full_id, published_at DESC);
+CREATE INDEX IF NOT EXISTS idx_publications_chat ON publications(chat_id, published_at DESC);
+`)
+	if err != nil {
+		return err
+	}
+
+	cols, err := s.tableColumns(ctx, "publications")
+	if err != nil {
+		return err
+	}
+	if !cols["undone_at"] {
+		_, err = s.db.ExecSchema(ctx, `ALTER TABLE publications ADD COLUMN undone_at INTEGER NOT NULL DEFAULT 0;`)
+	}
+	return err
+}
+
+const publicationCols = `id, vk_full_id, chat_id, message_ids, published_at, published_by, caption, undone_at`
+
+func scanPublication(sc interface{ Scan(...any) error }) (Publication, error) {
+	var p Publication
+	var msgJSON string
+	if err := sc.Scan(&p.ID, &p.VKFullID, &p.ChatID, &msgJSON, &p.PublishedAt, &p.PublishedBy, &p.Caption, &p.UndoneAt); err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal([]byte(msgJSON), &p.MessageIDs); err != nil {
+		return p, fmt.Errorf("message_ids of publication %d: %w", p.ID, err)
+	}
+	return p, nil
+}
+
+// MarkPublished: пишет запись в publications и одной транзакцией помечает пост used:
+// в чате-назначении — только в его очереди (post_destinations), общую очередь
+// (posts.status) это не трогает; в обычном чате — в posts.
+func (s *Store) MarkPublished(pub Publication) (id int64, err error) {
+	if pub.PublishedAt == 0 {
+		pub.PublishedAt = time.Now().Unix()
+	}
+	msgJSON, _ := json.Marshal(pub.MessageIDs)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	dest, err := isDestChatTx(tx, pub.ChatID)
+	if err != nil {
+		return 0, err
+	}
+	if dest {
+		err = markDestUsedTx(tx, pub.VKFullID, pub.ChatID, pub.PublishedAt)
+	} else {
+		_, err = tx.Exec(`
+UPDATE posts
+SET status='used', updated_at=?, used_at=?
+WHERE vk_full_id=?;
+`, pub.PublishedAt, pub.PublishedAt, pub.VKFullID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(`
+INSERT INTO publications (vk_full_id, chat_id, message_ids, published_at, published_by, caption)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id;
+`, pub.VKFullID, pub.ChatID, string(msgJSON), pub.PublishedAt, pub.PublishedBy, pub.Caption).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	// повторы этого мема больше не публикуем
+	if err = markDuplicatesTx(tx, pub.VKFullID, pub.PublishedAt); err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	return id, err
+}
+
+// ListPublications: история отправок поста, новые первыми
+func (s *Store) ListPublications(vkFullID string) ([]Publication, error) {
+	return s.queryPublications(`
+SELECT `+publicationCols+`
+FROM publications
+WHERE vk_full_id=?
+ORDER BY published_at DESC, id DESC;
+`, vkFullID)
+}
+
+// ActivePublicationsInRange: неотменённые публикации чата с id в [fromID, toID]
+func (s *Store) ActivePublicationsInRange(chatID, fromID, toID int64) ([]Publication, error) {
+	return s.queryPublications(`
+SELECT `+publicationCols+`
+FROM publications
+WHERE chat_id=? AND id BETWEEN ? AND ? AND undone_at=0
+ORDER BY id;
+`, chatID, fromID, toID)
+}
+
+// LastPublication: последняя неотменённая публикация в чате, nil если нет
+func (s *Store) LastPublication(chatID int64) (*Publication, error) {
+	p, err := scanPublication(s.db.QueryRow(`
+SELECT `+publicationCols+`
+FROM publications
+WHERE chat_id=? AND undone_at=0
+ORDER BY published_at DESC, id DESC
+LIMIT 1;
+`, chatID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *Store) queryPublications(query string, args ...any) ([]Publication, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Publication{}
+	for rows.Next() {
+		p, err := scanPublication(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// UndoPublication: помечает публикацию отменённой. Статус в общей очереди
+// считается по действующим публикациям в чаты, которые не назначения: нет их —
+// пост снова new, иначе used_at откатывается на предыдущую. Отмена публикации
+// в назначение то же делает с его очередью, а posts.status меняет, только если
+// пост там used (опубликован до того, как чат стал назначением).
+// Дубли возвращаются в new, когда у поста не осталось ни одной публикации.
+// Повторная отмена уже отменённой публикации ничего не делает.
+func (s *Store) UndoPublication(id int64) (err error) {
+	now := time.Now().Unix()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var vkFullID string
+	var chatID int64
+	if err = tx.QueryRow(`SELECT vk_full_id, chat_id FROM publications WHERE id=?;`, id).Scan(&vkFullID, &chatID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`UPDATE publications SET undone_at=? WHERE id=? AND undone_at=0;`, now, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		// уже отменена (двойное нажатие): статусы с тех пор могли поменять руками
+		return tx.Commit()
+	}
+	dest, err := isDestChatTx(tx, chatID)
+	if err != nil {
+		return err
+	}
+
+	var lastAt, active int64
+	if err = tx.QueryRow(`
+SELECT COALESCE(MAX(CASE WHEN chat_id NOT IN (SELECT chat_id FROM destinations) THEN published_at END), 0),
+       COUNT(*)
+FROM publications
+WHERE vk_full_id=? AND undone_at=0;
+`, vkFullID).Scan(&lastAt, &active); err != nil {
+		return err
+	}
+
+	// назначение: banned/duplicate/new поста не трогаем
+	onlyUsed := ""
+	if dest {
+		onlyUsed = " AND status='used'"
+	}
+	if lastAt == 0 {
+		_, err = tx.Exec(`UPDATE posts SET status='new', updated_at=?, used_at=0 WHERE vk_full_id=?`+onlyUsed+`;`, now, vkFullID)
+	} else {
+		_, err = tx.Exec(`UPDATE posts SET status='used', updated_at=?, used_at=? WHERE vk_full_id=?`+onlyUsed+`;`, now, lastAt, vkFullID)
+	}
+	if err != nil {
+		return err
+	}
+	if active == 0 {
+		if err = unmarkDuplicatesTx(tx, vkFullID, now); err != nil {
+			return err
+		}
+	}
+	if dest {
+		if err = undoDestUsedTx(tx, vkFullID, chatID, now); err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// CaptionEdit: правка подписи уже отправленной публикации
+type CaptionEdit struct {
+	ID            int64
+	PublicationID int64
+	OldCaption    string
+	NewCaption    string
+	EditedAt      int64
+	EditedBy      int64
+}
+
+func (s *Store) ensureCaptionEditsSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS caption_edits (
+  id             INTEGER PRIMARY KEY AUTOINCREMENT,
+  publication_id INTEGER NOT NULL,
+  old_caption    TEXT NOT NULL DEFAULT '',
+  new_caption    TEXT NOT NULL DEFAULT '',
+  edited_at      INTEGER NOT NULL DEFAULT 0,
+  edited_by      INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_caption_edits_pub ON caption_edits(publication_id, edited_at DESC);
+`)
+	return err
+}
+
+// ActivePublications: неотменённые публикации поста
+func (s *Store) ActivePublications(vkFullID string) ([]Publication, error) {
+	return s.queryPublications(`
+SELECT `+publicationCols+`
+FROM publications
+WHERE vk_full_id=? AND undone_at=0
+ORDER BY published_at DESC, id DESC;
+`, vkFullID)
+}
+
+// UpdatePublicationCaption: новый снимок подписи + запись в caption_edits
+func (s *Store) UpdatePublicationCaption(pubID int64, caption string, editedBy int64) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var old string
+	if err = tx.QueryRow(`SELECT caption FROM publications WHERE id=?;`, pubID).Scan(&old); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE publications SET caption=? WHERE id=?;`, caption, pubID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`
+INSERT INTO caption_edits (publication_id, old_caption, new_caption, edited_at, edited_by)
+VALUES (?, ?, ?, ?, ?);
+`, pubID, old, caption, time.Now().Unix(), editedBy); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func openTest(t *testing.T) *Store {
+	t.Helper()
+	st, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+func TestPublicationCorruptMessageIDs(t *testing.T) {
+	st := openTest(t)
+	if _, err := st.UpsertPosts([]Post{{VKFullID: "-1_1", VKOwnerID: "-1", VKPostID: "1", Link: "l", Text: "t"}}); err != nil {
+		t.Fatal(err)
+	}
+	id, err := st.MarkPublished(Publication{VKFullID: "-1_1", ChatID: 10, MessageIDs: []int{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.db.Exec(`UPDATE publications SET message_ids='[1,' WHERE id=?;`, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// битый message_ids — ошибка, а не публикация без сообщений (её /undo «отменил» бы, ничего не удалив)
+	if p, err := st.LastPublication(10); err == nil {
+		t.Fatalf("LastPublication: %+v без ошибки", p)
+	}
+	if ps, err := st.ActivePublicationsInRange(10, id, id); err == nil {
+		t.Fatalf("ActivePublicationsInRange: %+v без ошибки", ps)
+	}
+}
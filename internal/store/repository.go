@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// Repository: всё, чем пользуются cmd/bot, cmd/sync и cmd/archive.
+// Реализация одна — Store, поверх SQLite (Open) или PostgreSQL (OpenPostgres);
+// общий набор проверок — пакет storetest.
+type Repository interface {
+	Close() error
+	Ping(ctx context.Context) error
+
+	// посты
+	UpsertPosts(posts []Post) (inserted int, err error)
+	GetByVKFullID(vkFullID string) (*Post, error)
+	SetStatus(vkFullID, status string) error
+	Stats() (map[string]int, error)
+	Report(since int64, top int) (*Report, error)
+	CountByStatus(status string) (int, error)
+	ListByStatusPage(status string, limit, offset int) ([]Post, error)
+
+	// выбор следующего поста
+	Selector(name string, todayWindow int) (Selector, error)
+	TagSelector(tag string) Selector
+	DestSelector(name string, todayWindow int, destID int64) (Selector, error)
+	DestTagSelector(tag string, destID int64) Selector
+	PickOnThisDay(day time.Time, window int) (p *Post, matched bool, err error)
+	ChatSelector(chatID int64) (string, error)
+	SetChatSelector(chatID int64, name string) error
+
+	// поиск
+	Search(query, status string, limit, offset int) ([]Post, error)
+	CountSearch(query, status string) (int, error)
+	SaveSearchQuery(chatID int64, query string) (int64, error)
+	SearchQuery(id int64) (string, error)
+
+	// назначения: у каждого своя очередь и статусы постов
+	AddDestination(d Destination) (*Destination, error)
+	UpdateDestination(d Destination) error
+	DeleteDestination(id int64) error
+	GetDestination(id int64) (*Destination, error)
+	DestinationByChat(chatID int64) (*Destination, error)
+	ListDestinations() ([]Destination, error)
+	ClaimScheduleSlot(destID int64, slot string) (bool, error)
+	SetDestStatus(vkFullID string, destID int64, status string) error
+	DestStats(destID int64) (map[string]int, error)
+	CountByDestStatus(destID int64, status string) (int, error)
+	ListByDestStatusPage(destID int64, status string, limit, offset int) ([]Post, error)
+	GetDestPost(destID int64, vkFullID string) (*Post, error)
+
+	// публикации
+	MarkPublished(pub Publication) (id int64, err error)
+	UndoPublication(id int64) error
+	LastPublication(chatID int64) (*Publication, error)
+	ListPublications(vkFullID string) ([]Publication, error)
+	ActivePublications(vkFullID string) ([]Publication, error)
+	ActivePublicationsInRange(chatID, fromID, toID int64) ([]Publication, error)
+	UpdatePublicationCaption(pubID int64, caption string, editedBy int64) error
+
+	// админы
+	AdminRole(userID int64) (string, error)
+	SetAdmin(userID int64, role string, addedBy int64) error
+	RemoveAdmin(userID int64) (bool, error)
+	ListAdmins() ([]Admin, error)
+	CreateInvite(role string, createdBy int64, ttl time.Duration) (string, error)
+	UseInvite(token string, userID int64) (role string, err error)
+
+	// шаблоны подписи и источники
+	GetTemplate(scope string) (*CaptionTemplate, error)
+	ListTemplates() ([]CaptionTemplate, error)
+	SaveTemplateDraft(scope, draft string, by int64) error
+	ActivateTemplate(scope string, by int64) error
+	DeleteTemplate(scope string) error
+	SourceName(ownerID string) (string, error)
+	SetSourceName(ownerID, name string) error
+
+	// теги
+	PostTags(vkFullID string) ([]string, error)
+	AddPostTag(vkFullID, tag string) error
+	RemovePostTag(vkFullID, tag string) error
+	ChatCaptionTags(chatID int64) (bool, error)
+	SetChatCaptionTags(chatID int64, on bool) error
+
+	// правила sync и бан
+	AddRule(kind, value string, by int64) (*Rule, error)
+	DeleteRule(id int64) error
+	SetRuleEnabled(id int64, enabled bool) error
+	ListRules() ([]Rule, error)
+	FilterPosts(posts []Post) (kept []Post, skipped map[int64]int, err error)
+	DryRunRules() ([]RuleHits, error)
+	ApplyRules() (int, error)
+	BanPost(vkFullID string) error
+	UnbanPost(vkFullID string) error
+
+	// правки и удаления в VK
+	LivePostIDs() ([]string, error)
+	MarkDeleted(ids []string) (int, error)
+	ChangesSince(since int64) (edited, deleted int, err error)
+	LastSyncRun() (*SyncRun, error)
+	RecordSyncRun(r SyncRun) error
+
+	// фото
+	SetMediaFileIDs(vkFullID string, fileIDs []string) error
+	ClearMediaFileIDs(vkFullID string) error
+
+	// дубли
+	HashPendingThumbs(hash func(url string) (uint64, error)) (hashed, failed int, err error)
+	DupeClusters(limit int) ([]DupeCluster, error)
+
+	// журнал действий админов
+	LogAction(e AuditEntry) error
+	AuditLog(limit, offset int) ([]AuditEntry, error)
+	CountAuditLog() (int, error)
+	PostAuditLog(vkFullID string, limit int) ([]AuditEntry, error)
+
+	// сбои для ops-чата
+	RecordAlert(a Alert) (int64, error)
+	GetAlert(id int64) (*Alert, error)
+	LastAlertSent(kind, vkFullID string) (int64, error)
+	CountAlertsSent(since int64) (int, error)
+	MuteAlerts(kind string, until int64) error
+	AlertMutedUntil(kind string) (int64, error)
+	AlertSummary(since int64) ([]AlertGroup, error)
+	PruneAlerts(before int64) (int, error)
+
+	// экспорт, импорт, бэкап (Backup/Restore — только SQLite, иначе ErrBackupUnsupported)
+	ExportJSONL(w io.Writer) (int, error)
+	ExportCSV(w io.Writer) (int, error)
+	ImportJSONL(r io.Reader, policy string) (ImportStats, error)
+	Backup(path string) error
+	Restore(path string) (BackupInfo, error)
+}
+
+var _ Repository = (*Store)(nil)
+
+// OpenRepository: postgres://… или postgresql://… — PostgreSQL, иначе путь к файлу SQLite
+func OpenRepository(dsn string) (Repository, error) {
+	open := Open
+	if IsPostgresDSN(dsn) {
+		open = OpenPostgres
+	}
+	s, err := open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// IsPostgresDSN: OpenRepository откроет dsn как PostgreSQL
+func IsPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
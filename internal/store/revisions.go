@@ -0,0 +1,288 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Revision: прежняя версия поста до правки в VK
+type Revision struct {
+	ID          int64
+	VKFullID    string
+	Text        string
+	MediaURLs   []string
+	ContentHash string
+	VKEditedAt  int64
+	CreatedAt   int64 // когда sync заметил правку
+}
+
+// SyncRun: один прогон sync, нужен для сводки «с прошлого sync»
+type SyncRun struct {
+	ID       int64
+	At       int64
+	Inserted int
+	Edited   int
+	Deleted  int
+}
+
+func (s *Store) ensureRevisionsSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS post_revisions (
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  vk_full_id   TEXT NOT NULL,
+  text         TEXT NOT NULL,
+  media_json   TEXT NOT NULL DEFAULT '[]',
+  content_hash TEXT NOT NULL DEFAULT '',
+  vk_edited_at INTEGER NOT NULL DEFAULT 0,
+  created_at   INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post ON post_revisions(vk_full_id, id);
+CREATE INDEX IF NOT EXISTS idx_post_revisions_created ON post_revisions(created_at);
+CREATE INDEX IF NOT EXISTS idx_posts_deleted ON posts(deleted_at);
+
+CREATE TABLE IF NOT EXISTS sync_runs (
+  id       INTEGER PRIMARY KEY AUTOINCREMENT,
+  at       INTEGER NOT NULL,
+  inserted INTEGER NOT NULL DEFAULT 0,
+  edited   INTEGER NOT NULL DEFAULT 0,
+  deleted  INTEGER NOT NULL DEFAULT 0
+);
+`)
+	if err != nil {
+		return err
+	}
+
+	// хэш для постов, загруженных до появления content_hash.
+	// заглушки /ban без фото не трогаем: у них ещё нет контента
+	var posts []Post
+	rows, err := s.db.QueryContext(ctx, `
+SELECT vk_full_id, text
+FROM posts
+WHERE content_hash='' AND EXISTS (SELECT 1 FROM media WHERE media.vk_full_id=posts.vk_full_id);
+`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(&p.VKFullID, &p.Text); err != nil {
+			rows.Close()
+			return err
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := s.attachMedia(posts); err != nil {
+		return err
+	}
+	type item struct{ id, hash string }
+	var items []item
+	for _, p := range posts {
+		items = append(items, item{p.VKFullID, ContentHash(p.Text, p.MediaURLs())})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		if _, err := tx.Exec(`UPDATE posts SET content_hash=? WHERE vk_full_id=?;`, it.hash, it.id); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ContentHash: sha256 текста и фото поста.
+// У фото берём только путь: хост (sun9-xx) и подпись в query VK меняет сам, без правки поста.
+func ContentHash(text string, mediaURLs []string) string {
+	h := sha256.New()
+	h.Write([]byte(text))
+	for _, m := range mediaURLs {
+		h.Write([]byte{0})
+		if u, err := url.Parse(m); err == nil && u.Path != "" {
+			h.Write([]byte(u.Path))
+		} else {
+			h.Write([]byte(m))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// saveRevision: если хэш в базе отличается от нового — сохраняем старую версию поста
+func saveRevision(tx *Tx, vkFullID, newHash string, now int64) error {
+	var text, oldHash string
+	var editedAt int64
+	err := tx.QueryRow(`
+SELECT text, content_hash, vk_edited_at
+FROM posts
+WHERE vk_full_id=?;
+`, vkFullID).Scan(&text, &oldHash, &editedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if oldHash == "" || oldHash == newHash {
+		return nil
+	}
+
+	// снимок ссылок на фото — в post_revisions.media_json, как было
+	urls := []string{}
+	rows, err := tx.Query(`SELECT url FROM media WHERE vk_full_id=? ORDER BY idx;`, vkFullID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			rows.Close()
+			return err
+		}
+		urls = append(urls, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	mediaJSON, _ := json.Marshal(urls)
+	_, err = tx.Exec(`
+INSERT INTO post_revisions (vk_full_id, text, media_json, content_hash, vk_edited_at, created_at)
+VALUES (?, ?, ?, ?, ?, ?);
+`, vkFullID, text, string(mediaJSON), oldHash, editedAt, now)
+	return err
+}
+
+// PostRevisions: прежние версии поста, новые сверху
+func (s *Store) PostRevisions(vkFullID string) ([]Revision, error) {
+	rows, err := s.db.Query(`
+SELECT id, vk_full_id, text, media_json, content_hash, vk_edited_at, created_at
+FROM post_revisions
+WHERE vk_full_id=?
+ORDER BY id DESC;
+`, vkFullID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Revision{}
+	for rows.Next() {
+		var r Revision
+		var mediaJSON string
+		if err := rows.Scan(&r.ID, &r.VKFullID, &r.Text, &mediaJSON, &r.ContentHash, &r.VKEditedAt, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(mediaJSON), &r.MediaURLs); err != nil {
+			return nil, fmt.Errorf("media_json of revision %d: %w", r.ID, err)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// LivePostIDs: все посты, которые сверка ещё не отметила удалёнными
+func (s *Store) LivePostIDs() ([]string, error) {
+	rows, err := s.db.Query(`SELECT vk_full_id FROM posts WHERE deleted_at=0 ORDER BY rowid;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// MarkDeleted: помечает посты, которых больше нет в VK. Статус не меняем:
+// фото в архиве остаются, пост можно опубликовать. Вернулся в VK — UpsertPosts снимет метку.
+func (s *Store) MarkDeleted(ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	now := time.Now().Unix()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	n := 0
+	for _, id := range ids {
+		res, e := tx.Exec(`UPDATE posts SET deleted_at=?, updated_at=? WHERE vk_full_id=? AND deleted_at=0;`, now, now, id)
+		if e != nil {
+			err = e
+			return 0, err
+		}
+		c, _ := res.RowsAffected()
+		n += int(c)
+	}
+	err = tx.Commit()
+	return n, err
+}
+
+// ChangesSince: сколько постов поправили и удалили в VK с момента since
+func (s *Store) ChangesSince(since int64) (edited, deleted int, err error) {
+	err = s.db.QueryRow(`
+SELECT
+  (SELECT COUNT(DISTINCT vk_full_id) FROM post_revisions WHERE created_at >= ?),
+  (SELECT COUNT(*) FROM posts WHERE deleted_at >= ? AND deleted_at > 0);
+`, since, since).Scan(&edited, &deleted)
+	return edited, deleted, err
+}
+
+// LastSyncRun: nil, nil если sync ещё не запускался
+func (s *Store) LastSyncRun() (*SyncRun, error) {
+	var r SyncRun
+	err := s.db.QueryRow(`
+SELECT id, at, inserted, edited, deleted
+FROM sync_runs
+ORDER BY id DESC
+LIMIT 1;
+`).Scan(&r.ID, &r.At, &r.Inserted, &r.Edited, &r.Deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) RecordSyncRun(r SyncRun) error {
+	if r.At == 0 {
+		r.At = time.Now().Unix()
+	}
+	_, err := s.db.Exec(`
+INSERT INTO sync_runs (at, inserted, edited, deleted)
+VALUES (?, ?, ?, ?);
+`, r.At, r.Inserted, r.Edited, r.Deleted)
+	return err
+}
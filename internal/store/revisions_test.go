@@ -0,0 +1,35 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPostRevisionsCorruptMedia(t *testing.T) {
+	st := openTest(t)
+	p := Post{VKFullID: "-1_1", VKOwnerID: "-1", VKPostID: "1", Link: "l", Text: "было",
+		Media: MediaFromURLs([]string{"https://sun9-1.userapi.com/a.jpg"})}
+	if _, err := st.UpsertPosts([]Post{p}); err != nil {
+		t.Fatal(err)
+	}
+	p.Text = "стало"
+	if _, err := st.UpsertPosts([]Post{p}); err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err := st.PostRevisions("-1_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 1 || revs[0].Text != "было" || !slices.Equal(revs[0].MediaURLs, []string{"https://sun9-1.userapi.com/a.jpg"}) {
+		t.Fatalf("PostRevisions: %+v", revs)
+	}
+
+	// битый media_json — ошибка, а не версия без фото
+	if _, err := st.db.Exec(`UPDATE post_revisions SET media_json='["https:' WHERE id=?;`, revs[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if revs, err := st.PostRevisions("-1_1"); err == nil {
+		t.Fatalf("PostRevisions: %+v без ошибки", revs)
+	}
+}
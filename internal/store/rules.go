@@ -0,0 +1,374 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// виды правил исключения для sync
+const (
+	RuleKeyword   = "keyword"   // подстрока в тексте, без учёта регистра
+	RuleRegex     = "regex"     // регулярка по тексту
+	RuleMinPhotos = "minphotos" // меньше N фото
+	RuleExtLink   = "extlink"   // ссылки на внешние сайты
+	RuleContest   = "contest"   // конкурсы и розыгрыши
+)
+
+var RuleKinds = []string{RuleKeyword, RuleRegex, RuleMinPhotos, RuleExtLink, RuleContest}
+
+var ErrRuleNotFound = errors.New("rule not found")
+
+var (
+	contestRe = regexp.MustCompile(`(?i)(конкурс|розыгрыш|разыгрываем|giveaway|репост.{0,20}(запис|пост))`)
+	urlRe     = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+|\b[a-z0-9-]+(\.[a-z0-9-]+)*\.(ru|com|net|org|io|me|cc|su|рф)(/[^\s<>"]*)?`)
+)
+
+// свои домены — не считаются внешними
+var internalHosts = []string{"vk.com", "vk.ru", "vk.cc", "vk.me", "vkvideo.ru"}
+
+type Rule struct {
+	ID        int64
+	Kind      string
+	Value     string
+	Enabled   bool
+	CreatedBy int64
+	CreatedAt int64
+
+	re  *regexp.Regexp
+	min int
+}
+
+func (s *Store) ensureRulesSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS sync_rules (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  kind       TEXT NOT NULL,
+  value      TEXT NOT NULL DEFAULT '',
+  enabled    INTEGER NOT NULL DEFAULT 1,
+  created_by INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL DEFAULT 0
+);
+`)
+	return err
+}
+
+// compile: проверяет value и готовит правило к Match
+func (r *Rule) compile() error {
+	switch r.Kind {
+	case RuleKeyword:
+		r.Value = strings.TrimSpace(r.Value)
+		if r.Value == "" {
+			return fmt.Errorf("keyword: пустое слово")
+		}
+	case RuleRegex:
+		re, err := regexp.Compile("(?i)" + r.Value)
+		if err != nil {
+			return fmt.Errorf("regex: %v", err)
+		}
+		r.re = re
+	case RuleMinPhotos:
+		n, err := strconv.Atoi(strings.TrimSpace(r.Value))
+		if err != nil || n < 1 || n > 10 {
+			return fmt.Errorf("minphotos: нужно число 1..10")
+		}
+		r.min = n
+	case RuleExtLink, RuleContest:
+		r.Value = ""
+	default:
+		return fmt.Errorf("неизвестный вид правила %q, есть: %s", r.Kind, strings.Join(RuleKinds, ", "))
+	}
+	return nil
+}
+
+// Match: true — пост надо исключить
+func (r Rule) Match(p Post) bool {
+	switch r.Kind {
+	case RuleKeyword:
+		return strings.Contains(strings.ToLower(p.Text), strings.ToLower(r.Value))
+	case RuleRegex:
+		return r.re != nil && r.re.MatchString(p.Text)
+	case RuleMinPhotos:
+		return len(p.Media) < r.min
+	case RuleExtLink:
+		return hasExternalLink(p)
+	case RuleContest:
+		return contestRe.MatchString(p.Text)
+	}
+	return false
+}
+
+func (r Rule) String() string {
+	if r.Value == "" {
+		return r.Kind
+	}
+	return r.Kind + " " + r.Value
+}
+
+func hasExternalLink(p Post) bool {
+	links := append([]string{}, p.Links...)
+	links = append(links, urlRe.FindAllString(p.Text, -1)...)
+	for _, l := range links {
+		if !strings.Contains(l, "://") {
+			l = "http://" + l
+		}
+		u, err := url.Parse(l)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		if !isInternalHost(strings.ToLower(u.Hostname())) {
+			return true
+		}
+	}
+	return false
+}
+
+func isInternalHost(host string) bool {
+	for _, h := range internalHosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchRules: первое включённое правило, под которое попал пост, или nil
+func MatchRules(rules []Rule, p Post) *Rule {
+	for i := range rules {
+		if rules[i].Enabled && rules[i].Match(p) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// AddRule: проверяет правило и сохраняет его включённым
+func (s *Store) AddRule(kind, value string, by int64) (*Rule, error) {
+	r := Rule{Kind: strings.ToLower(strings.TrimSpace(kind)), Value: value, Enabled: true, CreatedBy: by, CreatedAt: time.Now().Unix()}
+	if err := r.compile(); err != nil {
+		return nil, err
+	}
+	err := s.db.WriteRow(`
+INSERT INTO sync_rules (kind, value, enabled, created_by, created_at)
+VALUES (?, ?, 1, ?, ?)
+RETURNING id;
+`, r.Kind, r.Value, r.CreatedBy, r.CreatedAt).Scan(&r.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Store) DeleteRule(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM sync_rules WHERE id=?;`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+func (s *Store) SetRuleEnabled(id int64, enabled bool) error {
+	v := 0
+	if enabled {
+		v = 1
+	}
+	res, err := s.db.Exec(`UPDATE sync_rules SET enabled=? WHERE id=?;`, v, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// ListRules: все правила, включая выключенные. Правило, которое больше не компилируется
+// (например, после обновления), выключается в памяти, чтобы не ронять sync.
+func (s *Store) ListRules() ([]Rule, error) {
+	rows, err := s.db.Query(`
+SELECT id, kind, value, enabled, created_by, created_at
+FROM sync_rules
+ORDER BY id;
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Rule{}
+	for rows.Next() {
+		var r Rule
+		var en int
+		if err := rows.Scan(&r.ID, &r.Kind, &r.Value, &en, &r.CreatedBy, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Enabled = en != 0
+		if r.compile() != nil {
+			r.Enabled = false
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// FilterPosts: делит посты из VK на те, что идут в базу, и отсеянные правилами.
+// skipped: id правила -> сколько постов оно отсеяло.
+func (s *Store) FilterPosts(posts []Post) (kept []Post, skipped map[int64]int, err error) {
+	rules, err := s.ListRules()
+	if err != nil {
+		return nil, nil, err
+	}
+	skipped = map[int64]int{}
+	kept = make([]Post, 0, len(posts))
+	for _, p := range posts {
+		if r := MatchRules(rules, p); r != nil {
+			skipped[r.ID]++
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept, skipped, nil
+}
+
+// RuleHits: результат dry-run одного правила
+type RuleHits struct {
+	Rule     Rule
+	Count    int
+	Examples []string // vk_full_id, не больше 5
+}
+
+// DryRunRules: какие new-посты в базе исключило бы каждое правило (включая выключенные).
+// Ссылки из вложений не хранятся, поэтому extlink смотрит только на текст.
+func (s *Store) DryRunRules() ([]RuleHits, error) {
+	rules, err := s.ListRules()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RuleHits, len(rules))
+	for i, r := range rules {
+		out[i].Rule = r
+	}
+	if len(rules) == 0 {
+		return out, nil
+	}
+
+	err = s.eachPost(`status='new'`, func(p Post) {
+		for i := range rules {
+			if !rules[i].Match(p) {
+				continue
+			}
+			out[i].Count++
+			if len(out[i].Examples) < 5 {
+				out[i].Examples = append(out[i].Examples, p.VKFullID)
+			}
+		}
+	})
+	return out, err
+}
+
+// ApplyRules: переводит в banned все new-посты, попавшие под включённые правила
+func (s *Store) ApplyRules() (int, error) {
+	rules, err := s.ListRules()
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []string
+	err = s.eachPost(`status='new'`, func(p Post) {
+		if MatchRules(rules, p) != nil {
+			ids = append(ids, p.VKFullID)
+		}
+	})
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().Unix()
+	for _, id := range ids {
+		if _, err = tx.Exec(`UPDATE posts SET status='banned', updated_at=? WHERE vk_full_id=? AND status='new';`, now, id); err != nil {
+			return 0, err
+		}
+	}
+	err = tx.Commit()
+	return len(ids), err
+}
+
+// eachPost: обходит посты под условием where, не держа курсор во время fn
+func (s *Store) eachPost(where string, fn func(Post)) error {
+	rows, err := s.db.Query(`SELECT ` + postCols + ` FROM posts WHERE ` + where + ` ORDER BY rowid;`)
+	if err != nil {
+		return err
+	}
+	var posts []Post
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := s.attachMedia(posts); err != nil {
+		return err
+	}
+	for _, p := range posts {
+		fn(p)
+	}
+	return nil
+}
+
+// BanPost: пост больше не публикуется и не возвращается sync'ом.
+// Если поста ещё нет в базе — заводим заглушку, sync заполнит контент, статус не тронет.
+func (s *Store) BanPost(vkFullID string) error {
+	owner, id, ok := strings.Cut(vkFullID, "_")
+	if !ok {
+		return fmt.Errorf("bad vk_full_id: %s", vkFullID)
+	}
+	now := time.Now().Unix()
+	_, err := s.db.Exec(`
+INSERT INTO posts (vk_full_id, vk_owner_id, vk_post_id, link, text, status, created_at, updated_at)
+VALUES (?, ?, ?, ?, '', 'banned', ?, ?)
+ON CONFLICT(vk_full_id) DO UPDATE SET status='banned', updated_at=excluded.updated_at;
+`, vkFullID, owner, id, "https://vk.com/wall"+vkFullID, now, now)
+	return err
+}
+
+// UnbanPost: обратно в new (или used, если пост уже публиковался);
+// заглушку без фото просто удаляем — sync добавит пост заново.
+func (s *Store) UnbanPost(vkFullID string) error {
+	if _, err := s.db.Exec(`
+DELETE FROM posts
+WHERE vk_full_id=? AND status='banned'
+  AND NOT EXISTS (SELECT 1 FROM media WHERE media.vk_full_id=posts.vk_full_id);
+`, vkFullID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`
+UPDATE posts
+SET status=CASE WHEN used_at > 0 THEN 'used' ELSE 'new' END, updated_at=?
+WHERE vk_full_id=? AND status='banned';
+`, time.Now().Unix(), vkFullID)
+	return err
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// schemaFingerprints: отпечаток схемы свежей SQLite-базы для каждой версии.
+// Упал тест — схема поменялась: подними SchemaVersion, допиши schemaHistory
+// и добавь сюда новый отпечаток (старые не трогаем).
+var schemaFingerprints = map[int]string{
+	8: "4725b4524cbc4145",
+	9: "26e320cb12096eac",
+}
+
+func TestSchemaVersion(t *testing.T) {
+	if SchemaVersion != len(schemaHistory)-1 {
+		t.Fatalf("SchemaVersion=%d, а в schemaHistory версий до %d", SchemaVersion, len(schemaHistory)-1)
+	}
+
+	path := filepath.Join(t.TempDir(), "schema.db")
+	st, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, version := schemaFingerprint(t, path)
+	if version != SchemaVersion {
+		t.Fatalf("user_version=%d, want %d", version, SchemaVersion)
+	}
+	if want := schemaFingerprints[SchemaVersion]; got != want {
+		t.Fatalf("схема v%d изменилась (отпечаток %s, записан %q): подними SchemaVersion", SchemaVersion, got, want)
+	}
+}
+
+// schemaFingerprint: sha256 по DDL всех таблиц, индексов и триггеров
+func schemaFingerprint(t *testing.T, path string) (string, int) {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY type, name;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var ddl []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		ddl = append(ddl, strings.Join(strings.Fields(s), " "))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version;`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(ddl, "\n")))
+	return hex.EncodeToString(sum[:8]), version
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// posts_fts: полнотекстовый индекс по posts.text.
+// vk_full_id храним в самой fts-таблице, а не через content_rowid:
+// rowid у posts (TEXT PRIMARY KEY) может поменяться после VACUUM.
+func (s *Store) ensureSearchSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS search_queries (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  chat_id    INTEGER NOT NULL,
+  query      TEXT NOT NULL,
+  created_at INTEGER NOT NULL DEFAULT 0
+);
+`)
+	if err != nil {
+		return err
+	}
+
+	// PostgreSQL: вместо posts_fts — GIN-индекс по tsvector, триггеры не нужны
+	if s.db.pg {
+		_, err = s.db.ExecSchema(ctx, `CREATE INDEX IF NOT EXISTS idx_posts_text_fts ON posts USING GIN (to_tsvector('simple', text));`)
+		return err
+	}
+
+	exists, err := s.tableExists(ctx, "posts_fts")
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecSchema(ctx, `
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+  vk_full_id UNINDEXED,
+  text,
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_ai AFTER INSERT ON posts BEGIN
+  INSERT INTO posts_fts (vk_full_id, text) VALUES (new.vk_full_id, new.text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_ad AFTER DELETE ON posts BEGIN
+  DELETE FROM posts_fts WHERE vk_full_id = old.vk_full_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_au AFTER UPDATE OF text ON posts
+WHEN old.text <> new.text BEGIN
+  DELETE FROM posts_fts WHERE vk_full_id = old.vk_full_id;
+  INSERT INTO posts_fts (vk_full_id, text) VALUES (new.vk_full_id, new.text);
+END;
+`)
+	if err != nil {
+		return err
+	}
+
+	// индекс появился на уже заполненной базе — наполняем
+	if !exists {
+		_, err = s.db.ExecContext(ctx, `INSERT INTO posts_fts (vk_full_id, text) SELECT vk_full_id, text FROM posts;`)
+	}
+	return err
+}
+
+// rebuildSearchIndex: posts_fts заново из posts (после Restore)
+func rebuildSearchIndex(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+DELETE FROM posts_fts;
+INSERT INTO posts_fts (vk_full_id, text) SELECT vk_full_id, text FROM posts;
+`)
+	return err
+}
+
+// searchFrom: FROM/WHERE поиска (первый ? — выражение match), сортировка по релевантности.
+// В PostgreSQL — tsvector по GIN-индексу idx_posts_text_fts, в SQLite — posts_fts.
+func (s *Store) searchFrom(query string) (from, rank, match string) {
+	if s.db.pg {
+		return `posts p, to_tsquery('simple', ?) q
+WHERE to_tsvector('simple', p.text) @@ q`, `ts_rank(to_tsvector('simple', p.text), q) DESC`, tsQuery(query)
+	}
+	return `posts_fts f
+JOIN posts p ON p.vk_full_id = f.vk_full_id
+WHERE posts_fts MATCH ?`, `f.rank`, ftsQuery(query)
+}
+
+// tsQuery: то же, что ftsQuery, для to_tsquery: "кот пёс" -> "кот:* & пёс:*"
+func tsQuery(q string) string {
+	terms := []string{}
+	for _, w := range strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		terms = append(terms, w+":*")
+	}
+	return strings.Join(terms, " & ")
+}
+
+// ftsQuery: пользовательский ввод -> безопасное выражение MATCH.
+// каждое слово ищем как префикс, все слова должны встретиться.
+func ftsQuery(q string) string {
+	terms := []string{}
+	for _, w := range strings.Fields(q) {
+		w = strings.ReplaceAll(w, `"`, "")
+		if w == "" {
+			continue
+		}
+		terms = append(terms, `"`+w+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+func checkSearchStatus(status string) error {
+	if status != "" && !validStatus(status) {
+		return fmt.Errorf("unsupported status: %s", status)
+	}
+	return nil
+}
+
+// Search: посты по тексту, самые релевантные первыми. status="" — любой.
+func (s *Store) Search(query, status string, limit, offset int) ([]Post, error) {
+	if err := checkSearchStatus(status); err != nil {
+		return nil, err
+	}
+	from, rank, match := s.searchFrom(query)
+	if match == "" {
+		return []Post{}, nil
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := s.db.Query(`
+SELECT `+postColumns("p")+`
+FROM `+from+` AND (? = '' OR p.status = ?)
+ORDER BY `+rank+`
+LIMIT ? OFFSET ?;
+`, match, status, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Post{}
+	for rows.Next() {
+		p, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, s.attachMedia(out)
+}
+
+func (s *Store) CountSearch(query, status string) (int, error) {
+	if err := checkSearchStatus(status); err != nil {
+		return 0, err
+	}
+	from, _, match := s.searchFrom(query)
+	if match == "" {
+		return 0, nil
+	}
+	row := s.db.QueryRow(`
+SELECT COUNT(*)
+FROM `+from+` AND (? = '' OR p.status = ?);
+`, match, status, status)
+	var n int
+	return n, row.Scan(&n)
+}
+
+// SaveSearchQuery: запрос в callback_data не влезает (64 байта), кнопки ссылаются на id
+func (s *Store) SaveSearchQuery(chatID int64, query string) (int64, error) {
+	var id int64
+	err := s.db.WriteRow(`
+INSERT INTO search_queries (chat_id, query, created_at) VALUES (?, ?, ?)
+RETURNING id;
+`, chatID, query, time.Now().Unix()).Scan(&id)
+	return id, err
+}
+
+// SearchQuery: "" если не нашли
+func (s *Store) SearchQuery(id int64) (string, error) {
+	var q string
+	err := s.db.QueryRow(`SELECT query FROM search_queries WHERE id=?;`, id).Scan(&q)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return q, err
+}
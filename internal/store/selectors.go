@@ -0,0 +1,343 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// стратегии выбора следующего new-поста
+const (
+	SelectRandom     = "random"
+	SelectOldest     = "oldest"
+	SelectNewest     = "newest"
+	SelectWeighted   = "weighted"
+	SelectRoundRobin = "roundrobin"
+	SelectDiverse    = "diverse"
+	SelectToday      = "today"
+)
+
+var SelectorNames = []string{SelectRandom, SelectOldest, SelectNewest, SelectWeighted, SelectRoundRobin, SelectDiverse, SelectToday}
+
+// Selector: следующий new-пост для публикации.
+// Pick возвращает nil, если постов нет, и имя стратегии, которая реально выбрала пост
+// (может отличаться от Name(), если сработал запасной вариант).
+type Selector interface {
+	Name() string
+	Pick() (*Post, string, error)
+}
+
+// Selector: стратегия по имени. todayWindow нужен только для "today".
+func (s *Store) Selector(name string, todayWindow int) (Selector, error) {
+	return s.selector(name, todayWindow, 0)
+}
+
+// DestSelector: стратегия по имени в очереди назначения destID
+func (s *Store) DestSelector(name string, todayWindow int, destID int64) (Selector, error) {
+	return s.selector(name, todayWindow, destID)
+}
+
+func (s *Store) selector(name string, todayWindow int, dest int64) (Selector, error) {
+	switch name {
+	case SelectRandom, "":
+		return randomSelector{s, dest}, nil
+	case SelectOldest:
+		return orderSelector{s, dest, SelectOldest, "vk_date = 0, vk_date ASC, rowid ASC"}, nil
+	case SelectNewest:
+		return orderSelector{s, dest, SelectNewest, "vk_date DESC, rowid DESC"}, nil
+	case SelectWeighted:
+		return weightedSelector{s, dest}, nil
+	case SelectRoundRobin:
+		return roundRobinSelector{s, dest}, nil
+	case SelectDiverse:
+		return diverseSelector{s: s, dest: dest, lastK: 10, candidates: 20, threshold: 0.5}, nil
+	case SelectToday:
+		return todaySelector{s, dest, todayWindow}, nil
+	}
+	return nil, fmt.Errorf("unknown selector: %s", name)
+}
+
+func (s *Store) pickOne(query string, args ...any) (*Post, error) {
+	return s.onePost(s.db.QueryRow(query, args...))
+}
+
+// у всех стратегий dest — назначение, в чьей очереди выбираем; 0 — общая очередь (status='new')
+
+type randomSelector struct {
+	s    *Store
+	dest int64
+}
+
+func (r randomSelector) Name() string { return SelectRandom }
+
+func (r randomSelector) Pick() (*Post, string, error) {
+	p, err := r.s.pickRandom(r.dest, "")
+	return p, SelectRandom, err
+}
+
+// orderSelector: oldest/newest по дате поста в VK
+type orderSelector struct {
+	s     *Store
+	dest  int64
+	name  string
+	order string
+}
+
+func (o orderSelector) Name() string { return o.name }
+
+func (o orderSelector) Pick() (*Post, string, error) {
+	cond, args := newCond(o.dest)
+	p, err := o.s.pickOne(`
+SELECT `+postCols+`
+FROM posts
+WHERE `+cond+`
+ORDER BY `+o.order+`
+LIMIT 1;
+`, args...)
+	return p, o.name, err
+}
+
+// weightedSelector: вероятность ∝ 1 + likes + views/100.
+// Ключ -ln(u)/w — экспоненциальные часы, минимальный ключ выигрывает с вероятностью w/Σw.
+type weightedSelector struct {
+	s    *Store
+	dest int64
+}
+
+func (w weightedSelector) Name() string { return SelectWeighted }
+
+func (w weightedSelector) Pick() (*Post, string, error) {
+	// u в (0, 1]: в SQLite random() — целое, в PostgreSQL — дробное в [0, 1)
+	u := `(abs(random()) % 1000000 + 1) / 1000001.0`
+	if w.s.db.pg {
+		u = `(1 - random())`
+	}
+	cond, args := newCond(w.dest)
+	p, err := w.s.pickOne(`
+SELECT `+postCols+`
+FROM posts
+WHERE `+cond+`
+ORDER BY -ln(`+u+`) / (1 + likes + views / 100.0)
+LIMIT 1;
+`, args...)
+	return p, SelectWeighted, err
+}
+
+// roundRobinSelector: источник, из которого дольше всего ничего не публиковали,
+// внутри него — случайный
+type roundRobinSelector struct {
+	s    *Store
+	dest int64
+}
+
+func (r roundRobinSelector) Name() string { return SelectRoundRobin }
+
+func (r roundRobinSelector) Pick() (*Post, string, error) {
+	cond, args := newCond(r.dest)
+	// когда из источника последний раз публиковали — в общей очереди или в назначении
+	lastUsed := `
+  SELECT vk_owner_id, MAX(used_at) AS last_used
+  FROM posts WHERE status='used'
+  GROUP BY vk_owner_id`
+	lastArgs := []any{}
+	if r.dest != 0 {
+		lastUsed = `
+  SELECT p.vk_owner_id, MAX(pd.used_at) AS last_used
+  FROM post_destinations pd JOIN posts p ON p.vk_full_id = pd.vk_full_id
+  WHERE pd.destination_id=? AND pd.status='used'
+  GROUP BY p.vk_owner_id`
+		lastArgs = append(lastArgs, r.dest)
+	}
+
+	var owner string
+	err := r.s.db.QueryRow(`
+SELECT n.vk_owner_id
+FROM (SELECT DISTINCT vk_owner_id FROM posts WHERE `+cond+`) n
+LEFT JOIN (`+lastUsed+`
+) u ON u.vk_owner_id = n.vk_owner_id
+ORDER BY COALESCE(u.last_used, 0) ASC, n.vk_owner_id
+LIMIT 1;
+`, append(args, lastArgs...)...).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, SelectRoundRobin, nil
+	}
+	if err != nil {
+		return nil, SelectRoundRobin, err
+	}
+
+	p, err := r.s.pickRandom(r.dest, ` AND vk_owner_id=?`, owner)
+	return p, SelectRoundRobin, err
+}
+
+// diverseSelector: из нескольких случайных кандидатов берёт первый,
+// не похожий (по словам текста) на последние lastK опубликованных;
+// если похожи все — наименее похожий.
+type diverseSelector struct {
+	s          *Store
+	dest       int64
+	lastK      int
+	candidates int
+	threshold  float64
+}
+
+func (d diverseSelector) Name() string { return SelectDiverse }
+
+func (d diverseSelector) Pick() (*Post, string, error) {
+	var recent []Post
+	var err error
+	if d.dest == 0 {
+		recent, err = d.s.ListByStatusPage("used", d.lastK, 0)
+	} else {
+		recent, err = d.s.ListByDestStatusPage(d.dest, "used", d.lastK, 0)
+	}
+	if err != nil {
+		return nil, SelectDiverse, err
+	}
+	recentWords := make([]map[string]struct{}, 0, len(recent))
+	for _, p := range recent {
+		recentWords = append(recentWords, wordSet(p.Text))
+	}
+
+	var best *Post
+	bestSim := 2.0
+	for i := 0; i < d.candidates; i++ {
+		p, err := d.s.pickRandom(d.dest, "")
+		if err != nil {
+			return nil, SelectDiverse, err
+		}
+		if p == nil {
+			return nil, SelectDiverse, nil
+		}
+
+		words := wordSet(p.Text)
+		sim := 0.0
+		for _, rw := range recentWords {
+			if j := jaccard(words, rw); j > sim {
+				sim = j
+			}
+		}
+		if sim < d.threshold {
+			return p, SelectDiverse, nil
+		}
+		if sim < bestSim {
+			best, bestSim = p, sim
+		}
+	}
+	return best, SelectDiverse + " (все похожи, взял наименее похожий)", nil
+}
+
+// wordSet: слова от 3 букв в нижнем регистре
+func wordSet(text string) map[string]struct{} {
+	out := map[string]struct{}{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(w)) >= 3 {
+			out[w] = struct{}{}
+		}
+	}
+	return out
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for w := range a {
+		if _, ok := b[w]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+type todaySelector struct {
+	s      *Store
+	dest   int64
+	window int
+}
+
+func (t todaySelector) Name() string { return SelectToday }
+
+func (t todaySelector) Pick() (*Post, string, error) {
+	p, matched, err := t.s.pickOnThisDay(time.Now(), t.window, t.dest)
+	if err != nil || p == nil || matched {
+		return p, SelectToday, err
+	}
+	return p, SelectRandom + " (в этот день ничего)", nil
+}
+
+func (s *Store) ensureChatSettingsSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS chat_settings (
+  chat_id      INTEGER PRIMARY KEY,
+  selector     TEXT NOT NULL DEFAULT '',
+  caption_tags INTEGER NOT NULL DEFAULT 0,
+  updated_at   INTEGER NOT NULL DEFAULT 0
+);
+`)
+	if err != nil {
+		return err
+	}
+
+	cols, err := s.tableColumns(ctx, "chat_settings")
+	if err != nil {
+		return err
+	}
+	if !cols["caption_tags"] {
+		_, err = s.db.ExecSchema(ctx, `ALTER TABLE chat_settings ADD COLUMN caption_tags INTEGER NOT NULL DEFAULT 0;`)
+	}
+	return err
+}
+
+// ChatSelector: стратегия, заданная для чата, "" — по умолчанию
+func (s *Store) ChatSelector(chatID int64) (string, error) {
+	var name string
+	err := s.db.QueryRow(`SELECT selector FROM chat_settings WHERE chat_id=?;`, chatID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return name, err
+}
+
+func (s *Store) SetChatSelector(chatID int64, name string) error {
+	if name != "" {
+		if _, err := s.Selector(name, 0); err != nil {
+			return err
+		}
+	}
+	_, err := s.db.Exec(`
+INSERT INTO chat_settings (chat_id, selector, updated_at)
+VALUES (?, ?, ?)
+ON CONFLICT(chat_id) DO UPDATE SET selector=excluded.selector, updated_at=excluded.updated_at;
+`, chatID, name, time.Now().Unix())
+	return err
+}
+
+// ChatCaptionTags: добавлять ли теги поста к подписи рядом с тегом архива
+func (s *Store) ChatCaptionTags(chatID int64) (bool, error) {
+	var on int
+	err := s.db.QueryRow(`SELECT caption_tags FROM chat_settings WHERE chat_id=?;`, chatID).Scan(&on)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return on != 0, err
+}
+
+func (s *Store) SetChatCaptionTags(chatID int64, on bool) error {
+	v := 0
+	if on {
+		v = 1
+	}
+	_, err := s.db.Exec(`
+INSERT INTO chat_settings (chat_id, caption_tags, updated_at)
+VALUES (?, ?, ?)
+ON CONFLICT(chat_id) DO UPDATE SET caption_tags=excluded.caption_tags, updated_at=excluded.updated_at;
+`, chatID, v, time.Now().Unix())
+	return err
+}
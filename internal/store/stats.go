@@ -0,0 +1,155 @@
+package store
+
+// DayCount: публикаций за день; Day — YYYY-MM-DD в часовом поясе бота (TZ)
+type DayCount struct {
+	Day   string
+	Count int
+}
+
+// SourceStat: посты одного источника (VK-группы) по статусам
+type SourceStat struct {
+	OwnerID string
+	Name    string // из sources, "" если ещё не знаем
+	Total   int
+	New     int
+	Used    int
+}
+
+// PublisherStat: сколько публикаций сделал админ; UserID 0 — бот по расписанию
+type PublisherStat struct {
+	UserID int64
+	Count  int
+}
+
+// PhotoCount: сколько постов с таким числом фото
+type PhotoCount struct {
+	Photos int
+	Posts  int
+}
+
+// Report: сводка для /stats. Публикации — неотменённые, с since;
+// источники и фото — по всей базе.
+type Report struct {
+	Since          int64
+	Daily          []DayCount // только дни с публикациями, по возрастанию
+	Publications   int
+	PublishedPosts int // разных постов среди публикаций — с такой скоростью уходит new
+	AvgCaptionLen  float64
+	TopPublishers  []PublisherStat
+	Sources        []SourceStat
+	Photos         []PhotoCount // по возрастанию числа фото
+}
+
+// Report: агрегаты для /stats; top — сколько админов в TopPublishers
+func (s *Store) Report(since int64, top int) (*Report, error) {
+	if top <= 0 {
+		top = 5
+	}
+	r := &Report{Since: since}
+
+	// день — как в PickOnThisDay: localtime в SQLite, часовой пояс сессии в PostgreSQL
+	day := `strftime('%Y-%m-%d', published_at, 'unixepoch', 'localtime')`
+	if s.db.pg {
+		day = `to_char(to_timestamp(published_at), 'YYYY-MM-DD')`
+	}
+	rows, err := s.db.Query(`
+SELECT `+day+` AS day, COUNT(*)
+FROM publications
+WHERE undone_at=0 AND published_at >= ?
+GROUP BY day
+ORDER BY day;
+`, since)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var d DayCount
+		if err := rows.Scan(&d.Day, &d.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.Daily = append(r.Daily, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRow(`
+SELECT COUNT(*), COUNT(DISTINCT vk_full_id), COALESCE(AVG(LENGTH(caption)), 0)
+FROM publications
+WHERE undone_at=0 AND published_at >= ?;
+`, since).Scan(&r.Publications, &r.PublishedPosts, &r.AvgCaptionLen)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`
+SELECT published_by, COUNT(*)
+FROM publications
+WHERE undone_at=0 AND published_at >= ?
+GROUP BY published_by
+ORDER BY COUNT(*) DESC, published_by
+LIMIT ?;
+`, since, top)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p PublisherStat
+		if err := rows.Scan(&p.UserID, &p.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.TopPublishers = append(r.TopPublishers, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`
+SELECT p.vk_owner_id, COALESCE(MAX(src.name), ''), COUNT(*),
+       SUM(CASE WHEN p.status='new' THEN 1 ELSE 0 END),
+       SUM(CASE WHEN p.status='used' THEN 1 ELSE 0 END)
+FROM posts p
+LEFT JOIN sources src ON src.owner_id=p.vk_owner_id
+GROUP BY p.vk_owner_id
+ORDER BY COUNT(*) DESC, p.vk_owner_id;
+`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var src SourceStat
+		if err := rows.Scan(&src.OwnerID, &src.Name, &src.Total, &src.New, &src.Used); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.Sources = append(r.Sources, src)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// заглушки /ban без фото в распределение не попадают
+	rows, err = s.db.Query(`
+SELECT n, COUNT(*)
+FROM (SELECT COUNT(*) AS n FROM media GROUP BY vk_full_id) AS per_post
+GROUP BY n
+ORDER BY n;
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pc PhotoCount
+		if err := rows.Scan(&pc.Photos, &pc.Posts); err != nil {
+			return nil, err
+		}
+		r.Photos = append(r.Photos, pc)
+	}
+	return r, rows.Err()
+}
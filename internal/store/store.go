@@ -3,16 +3,18 @@ package store
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
 type Store struct {
-	db *sql.DB
+	db *conn
 }
 
 type Post struct {
@@ -22,45 +24,140 @@ type Post struct {
 	Link      string
 	Text      string
 
-	MediaURLs []string
+	Media []Media  // фото по порядку, до 10; хранятся в таблице media. UpsertPosts: nil — не трогать
+	Links []string // ссылки из вложений VK; не хранятся, нужны только правилам sync
 
 	Status    string
 	CreatedAt int64
 	UpdatedAt int64
 	UsedAt    int64
+
+	// метаданные VK, обновляются при каждом sync
+	VKDate     int64 // unix, когда пост вышел в VK
+	VKEditedAt int64
+	Likes      int
+	Reposts    int
+	Views      int
+	Comments   int
+
+	DeletedAt int64 // unix, когда сверка не нашла пост в VK; 0 — жив
+}
+
+const postCols = `vk_owner_id, vk_post_id, vk_full_id, link, text, status, created_at, updated_at, used_at,
+  vk_date, vk_edited_at, likes, reposts, views, comments, deleted_at`
+
+// postColumns: postCols с префиксом таблицы, для JOIN
+func postColumns(alias string) string {
+	cols := strings.Split(postCols, ",")
+	for i, c := range cols {
+		cols[i] = alias + "." + strings.TrimSpace(c)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// scanPost: пост без фото — Media заполняет attachMedia
+func scanPost(sc interface{ Scan(...any) error }) (Post, error) {
+	var p Post
+	err := sc.Scan(&p.VKOwnerID, &p.VKPostID, &p.VKFullID, &p.Link, &p.Text, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.UsedAt,
+		&p.VKDate, &p.VKEditedAt, &p.Likes, &p.Reposts, &p.Views, &p.Comments, &p.DeletedAt)
+	return p, err
+}
+
+// onePost: *Post с фото; nil, nil если строки нет
+func (s *Store) onePost(row *sql.Row) (*Post, error) {
+	p, err := scanPost(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := []Post{p}
+	if err := s.attachMedia(out); err != nil {
+		return nil, err
+	}
+	return &out[0], nil
+}
+
+// прагмы на каждое соединение SQLite. WAL — бот и cmd/sync работают с базой
+// одновременно: читатели не блокируют писателя; busy_timeout — второй писатель
+// ждёт до 5с вместо "database is locked"; synchronous=NORMAL в WAL безопасен
+// при падении процесса и не делает fsync на каждый коммит.
+var sqlitePragmas = []string{
+	"journal_mode(WAL)",
+	"busy_timeout(5000)",
+	"foreign_keys(1)",
+	"synchronous(NORMAL)",
+}
+
+// сколько соединений-читателей держать для Query/QueryRow
+const sqliteReaders = 4
+
+// sqliteDSN: путь + прагмы и параметры драйвера modernc.org/sqlite
+func sqliteDSN(path string, params ...string) string {
+	q := make([]string, 0, len(sqlitePragmas)+len(params))
+	for _, p := range sqlitePragmas {
+		q = append(q, "_pragma="+p)
+	}
+	q = append(q, params...)
+	return path + "?" + strings.Join(q, "&")
 }
 
 func Open(path string) (*Store, error) {
-	db, err := sql.Open("sqlite", path)
+	// писатель — одно соединение; BEGIN IMMEDIATE, чтобы транзакция сразу брала
+	// блокировку записи и ждала busy_timeout, а не падала при апгрейде чтения в запись
+	db, err := sql.Open("sqlite", sqliteDSN(path, "_txlock=immediate"))
 	if err != nil {
 		return nil, err
 	}
 	db.SetMaxOpenConns(1)
 
-	s := &Store{db: db}
-	if err := s.ensureSchema(context.Background()); err != nil {
+	rd, err := sql.Open("sqlite", sqliteDSN(path, "_pragma=query_only(1)"))
+	if err != nil {
 		_ = db.Close()
 		return nil, err
 	}
+	rd.SetMaxOpenConns(sqliteReaders)
+
+	s := &Store{db: &conn{DB: db, rd: rd}}
+	if err := s.ensureSchema(context.Background()); err != nil {
+		_ = s.db.Close()
+		return nil, err
+	}
 	return s, nil
 }
 
 func (s *Store) Close() error { return s.db.Close() }
 
+// Ping: отвечает ли база (для /healthz). У SQLite пингуем читателей:
+// писатель может быть занят длинной транзакцией sync, это не поломка.
+func (s *Store) Ping(ctx context.Context) error { return s.db.reader().PingContext(ctx) }
+
+// ensureSchema: одна и та же цепочка ensure*Schema для SQLite и PostgreSQL —
+// каждая создаёт свои таблицы и докатывает миграции, так что база любой прежней
+// версии (в том числе PostgreSQL) доезжает до текущей схемы. Типы под PostgreSQL
+// поправляет ExecSchema, остальные отличия — ветками по s.db.pg на месте.
 func (s *Store) ensureSchema(ctx context.Context) error {
 	// базовая таблица
-	_, err := s.db.ExecContext(ctx, `
+	_, err := s.db.ExecSchema(ctx, `
 CREATE TABLE IF NOT EXISTS posts (
-  vk_full_id  TEXT PRIMARY KEY,
-  vk_owner_id TEXT NOT NULL,
-  vk_post_id  TEXT NOT NULL,
-  link        TEXT NOT NULL,
-  text        TEXT NOT NULL,
-  media_json  TEXT NOT NULL DEFAULT '[]',
-  status      TEXT NOT NULL DEFAULT 'new',
-  created_at  INTEGER NOT NULL DEFAULT 0,
-  updated_at  INTEGER NOT NULL DEFAULT 0,
-  used_at     INTEGER NOT NULL DEFAULT 0
+  vk_full_id   TEXT PRIMARY KEY,
+  vk_owner_id  TEXT NOT NULL,
+  vk_post_id   TEXT NOT NULL,
+  link         TEXT NOT NULL,
+  text         TEXT NOT NULL,
+  status       TEXT NOT NULL DEFAULT 'new',
+  created_at   INTEGER NOT NULL DEFAULT 0,
+  updated_at   INTEGER NOT NULL DEFAULT 0,
+  used_at      INTEGER NOT NULL DEFAULT 0,
+  vk_date      INTEGER NOT NULL DEFAULT 0,
+  vk_edited_at INTEGER NOT NULL DEFAULT 0,
+  likes        INTEGER NOT NULL DEFAULT 0,
+  reposts      INTEGER NOT NULL DEFAULT 0,
+  views        INTEGER NOT NULL DEFAULT 0,
+  comments     INTEGER NOT NULL DEFAULT 0,
+  content_hash TEXT NOT NULL DEFAULT '',
+  deleted_at   INTEGER NOT NULL DEFAULT 0
 );
 
 CREATE INDEX IF NOT EXISTS idx_posts_status_usedat    ON posts(status, used_at DESC);
@@ -80,13 +177,10 @@ CREATE INDEX IF NOT EXISTS idx_posts_status_createdat ON posts(status, created_a
 		if cols[name] {
 			return nil
 		}
-		_, e := s.db.ExecContext(ctx, ddl)
+		_, e := s.db.ExecSchema(ctx, ddl)
 		return e
 	}
 
-	if err := addCol("media_json", `ALTER TABLE posts ADD COLUMN media_json TEXT NOT NULL DEFAULT '[]';`); err != nil {
-		return err
-	}
 	if err := addCol("status", `ALTER TABLE posts ADD COLUMN status TEXT NOT NULL DEFAULT 'new';`); err != nil {
 		return err
 	}
@@ -99,28 +193,47 @@ CREATE INDEX IF NOT EXISTS idx_posts_status_createdat ON posts(status, created_a
 	if err := addCol("used_at", `ALTER TABLE posts ADD COLUMN used_at INTEGER NOT NULL DEFAULT 0;`); err != nil {
 		return err
 	}
+	if err := addCol("content_hash", `ALTER TABLE posts ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';`); err != nil {
+		return err
+	}
+	for _, c := range []string{"vk_date", "vk_edited_at", "likes", "reposts", "views", "comments", "deleted_at"} {
+		if err := addCol(c, fmt.Sprintf(`ALTER TABLE posts ADD COLUMN %s INTEGER NOT NULL DEFAULT 0;`, c)); err != nil {
+			return err
+		}
+	}
+	// в PostgreSQL rowid нет — заводим явный: на нём держатся PickRandomNew и порядок обхода.
+	// В SQLite rowid и так в конце каждого индекса.
+	statusIdx := `posts(status)`
+	if s.db.pg {
+		if err := addCol("rowid", `ALTER TABLE posts ADD COLUMN rowid BIGSERIAL UNIQUE;`); err != nil {
+			return err
+		}
+		statusIdx = `posts(status, rowid)`
+	}
 
-	_, err = s.db.ExecContext(ctx, `
+	_, err = s.db.ExecSchema(ctx, `
 CREATE INDEX IF NOT EXISTS idx_posts_status_usedat    ON posts(status, used_at DESC);
 CREATE INDEX IF NOT EXISTS idx_posts_status_createdat ON posts(status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_posts_status_vkdate    ON posts(status, vk_date);
+CREATE INDEX IF NOT EXISTS idx_posts_status           ON `+statusIdx+`;
 `)
 	if err != nil {
 		return err
 	}
 
 	// “убираем reserved/skipped” как класс:
-	// всё что не new/used -> new
+	// всё что не new/used/banned/duplicate -> new
 	_, err = s.db.ExecContext(ctx, `
 UPDATE posts
 SET status='new', updated_at=COALESCE(updated_at, 0)
-WHERE status NOT IN ('new','used');
+WHERE status NOT IN ('new','used','banned','duplicate');
 `)
 	if err != nil {
 		return err
 	}
 
 	// если вдруг были used без used_at — поставим used_at=updated_at/created_at
-	_, _ = s.db.ExecContext(ctx, `
+	_, err = s.db.ExecContext(ctx, `
 UPDATE posts
 SET used_at = CASE
   WHEN used_at=0 AND updated_at>0 THEN updated_at
@@ -129,12 +242,66 @@ SET used_at = CASE
 END
 WHERE status='used';
 `)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	if err := s.ensureMediaSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAdminsSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureSearchSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensurePublicationsSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureCaptionEditsSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureTemplatesSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureChatSettingsSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureTagsSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureRulesSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureRevisionsSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureDupesSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAuditSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureAlertsSchema(ctx); err != nil {
+		return err
+	}
+	if err := s.ensureDestinationsSchema(ctx); err != nil {
+		return err
+	}
+
+	if s.db.pg {
+		return nil
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d;`, SchemaVersion))
+	return err
 }
 
 func (s *Store) tableColumns(ctx context.Context, table string) (map[string]bool, error) {
-	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`PRAGMA table_info(%s);`, table))
+	q := `SELECT name FROM pragma_table_info(?);`
+	if s.db.pg {
+		q = `SELECT column_name FROM information_schema.columns WHERE table_schema=current_schema() AND table_name=?;`
+	}
+	rows, err := s.db.QueryContext(ctx, q, table)
 	if err != nil {
 		return nil, err
 	}
@@ -142,12 +309,8 @@ func (s *Store) tableColumns(ctx context.Context, table string) (map[string]bool
 
 	out := map[string]bool{}
 	for rows.Next() {
-		var cid int
-		var name, ctype string
-		var notnull int
-		var dflt sql.NullString
-		var pk int
-		if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+		var name string
+		if err := rows.Scan(&name); err != nil {
 			return nil, err
 		}
 		out[name] = true
@@ -155,6 +318,16 @@ func (s *Store) tableColumns(ctx context.Context, table string) (map[string]bool
 	return out, rows.Err()
 }
 
+func (s *Store) tableExists(ctx context.Context, table string) (bool, error) {
+	q := `SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?;`
+	if s.db.pg {
+		q = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=current_schema() AND table_name=?;`
+	}
+	var n int
+	err := s.db.QueryRowContext(ctx, q, table).Scan(&n)
+	return n > 0, err
+}
+
 func (s *Store) UpsertPosts(posts []Post) (inserted int, err error) {
 	if len(posts) == 0 {
 		return 0, nil
@@ -173,9 +346,11 @@ func (s *Store) UpsertPosts(posts []Post) (inserted int, err error) {
 	}()
 
 	insStmt, err := tx.Prepare(`
-INSERT OR IGNORE INTO posts
-(vk_full_id, vk_owner_id, vk_post_id, link, text, media_json, status, created_at, updated_at, used_at)
-VALUES (?, ?, ?, ?, ?, ?, 'new', ?, ?, 0);
+INSERT INTO posts
+(vk_full_id, vk_owner_id, vk_post_id, link, text, status, created_at, updated_at, used_at,
+ vk_date, vk_edited_at, likes, reposts, views, comments, content_hash)
+VALUES (?, ?, ?, ?, ?, 'new', ?, ?, 0, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(vk_full_id) DO NOTHING;
 `)
 	if err != nil {
 		return 0, err
@@ -184,7 +359,9 @@ VALUES (?, ?, ?, ?, ?, ?, 'new', ?, ?, 0);
 
 	updStmt, err := tx.Prepare(`
 UPDATE posts
-SET link=?, text=?, media_json=?, updated_at=?
+SET link=?, text=?, updated_at=?,
+    vk_date=?, vk_edited_at=?, likes=?, reposts=?, views=?, comments=?,
+    content_hash=?, deleted_at=0
 WHERE vk_full_id=?;
 `)
 	if err != nil {
@@ -193,18 +370,36 @@ WHERE vk_full_id=?;
 	defer updStmt.Close()
 
 	for _, p := range posts {
-		mediaJSON, _ := json.Marshal(p.MediaURLs)
-		res, e := insStmt.Exec(p.VKFullID, p.VKOwnerID, p.VKPostID, p.Link, p.Text, string(mediaJSON), now, now)
+		hash := ContentHash(p.Text, p.MediaURLs())
+		res, e := insStmt.Exec(p.VKFullID, p.VKOwnerID, p.VKPostID, p.Link, p.Text, now, now,
+			p.VKDate, p.VKEditedAt, p.Likes, p.Reposts, p.Views, p.Comments, hash)
 		if e != nil {
 			err = e
 			return 0, err
 		}
 		if n, _ := res.RowsAffected(); n > 0 {
 			inserted += int(n)
+		} else if e := saveRevision(tx, p.VKFullID, hash, now); e != nil {
+			// пост уже был — если контент поменялся, старая версия уходит в post_revisions
+			err = e
+			return 0, err
 		}
 
 		// обновляем контент (без смены статуса)
-		if _, e := updStmt.Exec(p.Link, p.Text, string(mediaJSON), now, p.VKFullID); e != nil {
+		if _, e := updStmt.Exec(p.Link, p.Text, now,
+			p.VKDate, p.VKEditedAt, p.Likes, p.Reposts, p.Views, p.Comments, hash, p.VKFullID); e != nil {
+			err = e
+			return 0, err
+		}
+
+		// фото -> media, хэши превью досчитываются отдельно
+		if e := setMedia(tx, p.VKFullID, p.Media, now); e != nil {
+			err = e
+			return 0, err
+		}
+
+		// хэштеги из текста -> post_tags
+		if e := setAutoTags(tx, p.VKFullID, p.Text, now); e != nil {
 			err = e
 			return 0, err
 		}
@@ -214,7 +409,16 @@ WHERE vk_full_id=?;
 	return inserted, err
 }
 
-// Stats: считаем только new/used. Всё остальное уже миграцией превращаем в new.
+// статусы поста:
+//   - new    — ещё не публиковался
+//   - used   — опубликован
+//   - banned — исключён админом или правилом, sync его не воскрешает
+//   - duplicate — те же фото, что у опубликованного поста (duplicate_of)
+func validStatus(status string) bool {
+	return status == "new" || status == "used" || status == "banned" || status == "duplicate"
+}
+
+// Stats: считаем только известные статусы. Всё остальное уже миграцией превращаем в new.
 func (s *Store) Stats() (map[string]int, error) {
 	rows, err := s.db.Query(`SELECT status, COUNT(*) FROM posts GROUP BY status;`)
 	if err != nil {
@@ -223,8 +427,10 @@ func (s *Store) Stats() (map[string]int, error) {
 	defer rows.Close()
 
 	out := map[string]int{
-		"new":  0,
-		"used": 0,
+		"new":       0,
+		"used":      0,
+		"banned":    0,
+		"duplicate": 0,
 	}
 	for rows.Next() {
 		var st string
@@ -232,7 +438,7 @@ func (s *Store) Stats() (map[string]int, error) {
 		if err := rows.Scan(&st, &c); err != nil {
 			return nil, err
 		}
-		if st == "new" || st == "used" {
+		if validStatus(st) {
 			out[st] = c
 		}
 	}
@@ -240,7 +446,7 @@ func (s *Store) Stats() (map[string]int, error) {
 }
 
 func (s *Store) CountByStatus(status string) (int, error) {
-	if status != "new" && status != "used" {
+	if !validStatus(status) {
 		return 0, fmt.Errorf("unsupported status: %s", status)
 	}
 	row := s.db.QueryRow(`SELECT COUNT(*) FROM posts WHERE status=?;`, status)
@@ -249,31 +455,23 @@ func (s *Store) CountByStatus(status string) (int, error) {
 }
 
 func (s *Store) GetByVKFullID(vkFullID string) (*Post, error) {
-	row := s.db.QueryRow(`
-SELECT vk_owner_id, vk_post_id, vk_full_id, link, text, media_json, status, created_at, updated_at, used_at
+	p, err := s.onePost(s.db.QueryRow(`
+SELECT `+postCols+`
 FROM posts
 WHERE vk_full_id=?;
-`, vkFullID)
-
-	var p Post
-	var mediaJSON string
-	err := row.Scan(&p.VKOwnerID, &p.VKPostID, &p.VKFullID, &p.Link, &p.Text, &mediaJSON, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.UsedAt)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, nil
-	}
-	if err != nil {
+`, vkFullID))
+	if p == nil || err != nil {
 		return nil, err
 	}
-	_ = json.Unmarshal([]byte(mediaJSON), &p.MediaURLs)
 	// на всякий: если в базе внезапно был старый статус
-	if p.Status != "new" && p.Status != "used" {
+	if !validStatus(p.Status) {
 		p.Status = "new"
 	}
-	return &p, nil
+	return p, nil
 }
 
 func (s *Store) SetStatus(vkFullID, status string) error {
-	if status != "new" && status != "used" {
+	if !validStatus(status) {
 		return fmt.Errorf("unsupported status: %s", status)
 	}
 	now := time.Now().Unix()
@@ -289,30 +487,46 @@ WHERE vk_full_id=?;
 	return err
 }
 
-// PickRandomNew: выбираем случайный new
-func (s *Store) PickRandomNew() (*Post, error) {
-	row := s.db.QueryRow(`
-SELECT vk_owner_id, vk_post_id, vk_full_id, link, text, media_json, status, created_at, updated_at, used_at
-FROM posts
-WHERE status='new'
-ORDER BY RANDOM()
-LIMIT 1;
-`)
-
-	var p Post
-	var mediaJSON string
-	if err := row.Scan(&p.VKOwnerID, &p.VKPostID, &p.VKFullID, &p.Link, &p.Text, &mediaJSON, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.UsedAt); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+// PickRandomNew: выбираем случайный new, равномерно.
+// Без ORDER BY RANDOM(): COUNT(*) по индексу idx_posts_status и случайный OFFSET
+// по нему же. Это два прохода по индексу (O(n) по числу new, строки таблицы
+// не читаются, сортировки нет) — на 100k постов единицы миллисекунд; случайная
+// точка в диапазоне rowid была бы O(log n), но дырки (used посреди new) дают
+// сильный перекос к постам сразу после них.
+func (s *Store) PickRandomNew() (*Post, error) { return s.pickRandom(0, "") }
+
+// pickRandom: PickRandomNew в очереди назначения dest (0 — общая);
+// extra — дополнительное условие на posts (" AND …") со своими аргументами
+func (s *Store) pickRandom(dest int64, extra string, extraArgs ...any) (*Post, error) {
+	cond, args := newCond(dest)
+	cond += extra
+	args = append(args, extraArgs...)
+	// между COUNT и выборкой пост могли опубликовать — тогда OFFSET мимо, пробуем ещё раз
+	for range 3 {
+		var n int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM posts WHERE `+cond+`;`, args...).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n == 0 {
 			return nil, nil
 		}
-		return nil, err
+
+		p, err := s.onePost(s.db.QueryRow(`
+SELECT `+postCols+`
+FROM posts
+WHERE `+cond+`
+ORDER BY rowid
+LIMIT 1 OFFSET ?;
+`, append(slices.Clone(args), rand.IntN(n))...))
+		if p != nil || err != nil {
+			return p, err
+		}
 	}
-	_ = json.Unmarshal([]byte(mediaJSON), &p.MediaURLs)
-	return &p, nil
+	return nil, nil
 }
 
 func (s *Store) ListByStatusPage(status string, limit, offset int) ([]Post, error) {
-	if status != "new" && status != "used" {
+	if !validStatus(status) {
 		return nil, fmt.Errorf("unsupported status: %s", status)
 	}
 	if limit <= 0 {
@@ -328,12 +542,12 @@ func (s *Store) ListByStatusPage(status string, limit, offset int) ([]Post, erro
 	}
 
 	rows, err := s.db.Query(fmt.Sprintf(`
-SELECT vk_owner_id, vk_post_id, vk_full_id, link, text, media_json, status, created_at, updated_at, used_at
+SELECT %s
 FROM posts
 WHERE status=?
 ORDER BY %s
 LIMIT ? OFFSET ?;
-`, order), status, limit, offset)
+`, postCols, order), status, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -341,13 +555,14 @@ LIMIT ? OFFSET ?;
 
 	out := []Post{}
 	for rows.Next() {
-		var p Post
-		var mediaJSON string
-		if err := rows.Scan(&p.VKOwnerID, &p.VKPostID, &p.VKFullID, &p.Link, &p.Text, &mediaJSON, &p.Status, &p.CreatedAt, &p.UpdatedAt, &p.UsedAt); err != nil {
+		p, err := scanPost(rows)
+		if err != nil {
 			return nil, err
 		}
-		_ = json.Unmarshal([]byte(mediaJSON), &p.MediaURLs)
 		out = append(out, p)
 	}
-	return out, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, s.attachMedia(out)
 }
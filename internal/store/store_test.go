@@ -0,0 +1,33 @@
+package store_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/G1P0/pushdalek/internal/store/storetest"
+)
+
+// общий набор storetest: SQLite всегда, PostgreSQL — если задан DATABASE_URL
+// (каждая проверка в своей схеме, после — DROP SCHEMA)
+
+func TestSQLite(t *testing.T) {
+	runChecks(t, storetest.SQLite(t.TempDir()))
+}
+
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL не задан")
+	}
+	runChecks(t, storetest.Postgres(dsn))
+}
+
+func runChecks(t *testing.T, open storetest.Opener) {
+	for _, c := range storetest.Checks {
+		t.Run(c.Name, func(t *testing.T) {
+			if err := storetest.RunOne(open, c); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,1566 @@
+// Package storetest: общий набор проверок store.Repository. Один и тот же набор
+// гоняется по SQLite и по PostgreSQL (go test ./internal/store и cmd/storecheck),
+// чтобы реализации не разъезжались.
+package storetest
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/G1P0/pushdalek/internal/store"
+)
+
+// Opener: новая пустая база на одну проверку; cleanup закрывает и удаляет её
+type Opener func() (r store.Repository, cleanup func(), err error)
+
+// Check: одна проверка на пустой базе
+type Check struct {
+	Name string
+	Run  func(r store.Repository) error
+}
+
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Checks: весь набор, по порядку
+var Checks = []Check{
+	{"upsert", checkUpsert},
+	{"status", checkStatus},
+	{"selectors", checkSelectors},
+	{"random", checkRandom},
+	{"onthisday", checkOnThisDay},
+	{"search", checkSearch},
+	{"publications", checkPublications},
+	{"tags", checkTags},
+	{"admins", checkAdmins},
+	{"templates", checkTemplates},
+	{"rules", checkRules},
+	{"revisions", checkRevisions},
+	{"media", checkMedia},
+	{"dupes", checkDupes},
+	{"export", checkExport},
+	{"audit", checkAudit},
+	{"report", checkReport},
+	{"alerts", checkAlerts},
+	{"destinations", checkDestinations},
+}
+
+// Run: каждая проверка — на своей базе от open
+func Run(open Opener) []Result {
+	out := make([]Result, 0, len(Checks))
+	for _, c := range Checks {
+		out = append(out, Result{c.Name, RunOne(open, c)})
+	}
+	return out
+}
+
+// RunOne: одна проверка на своей базе от open; паника — тоже ошибка
+func RunOne(open Opener, c Check) (err error) {
+	r, cleanup, err := open()
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer cleanup()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return c.Run(r)
+}
+
+// SQLite: файл в dir на каждую проверку
+func SQLite(dir string) Opener {
+	return func() (store.Repository, func(), error) {
+		f, err := os.CreateTemp(dir, "storetest-*.db")
+		if err != nil {
+			return nil, nil, err
+		}
+		path := f.Name()
+		_ = f.Close()
+
+		r, err := store.Open(path)
+		if err != nil {
+			_ = os.Remove(path)
+			return nil, nil, err
+		}
+		return r, func() {
+			_ = r.Close()
+			_ = os.Remove(path)
+		}, nil
+	}
+}
+
+// Postgres: отдельная схема storetest_* в базе dsn на каждую проверку, после — DROP SCHEMA
+func Postgres(dsn string) Opener {
+	return func() (store.Repository, func(), error) {
+		admin, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		schema := fmt.Sprintf("storetest_%d", time.Now().UnixNano())
+		if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+			_ = admin.Close()
+			return nil, nil, err
+		}
+		drop := func() {
+			_, _ = admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+			_ = admin.Close()
+		}
+
+		r, err := store.OpenPostgres(withSearchPath(dsn, schema))
+		if err != nil {
+			drop()
+			return nil, nil, err
+		}
+		return r, func() {
+			_ = r.Close()
+			drop()
+		}, nil
+	}
+}
+
+func withSearchPath(dsn, schema string) string {
+	if !store.IsPostgresDSN(dsn) {
+		return dsn + " search_path=" + schema
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// ---- данные ----
+
+func post(id, text string, photos ...string) store.Post {
+	owner, pid, _ := strings.Cut(id, "_")
+	if len(photos) == 0 {
+		photos = []string{"https://sun9-1.userapi.com/" + id + ".jpg"}
+	}
+	return store.Post{
+		VKOwnerID: owner,
+		VKPostID:  pid,
+		VKFullID:  id,
+		Link:      "https://vk.com/wall" + id,
+		Text:      text,
+		Media:     store.MediaFromURLs(photos),
+		VKDate:    time.Date(2020, 3, 1, 12, 0, 0, 0, time.Local).Unix(),
+		Likes:     1,
+	}
+}
+
+func upsert(r store.Repository, posts ...store.Post) error {
+	_, err := r.UpsertPosts(posts)
+	return err
+}
+
+func wantStatus(r store.Repository, id, status string) error {
+	p, err := r.GetByVKFullID(id)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("%s: нет в базе", id)
+	}
+	if p.Status != status {
+		return fmt.Errorf("%s: статус %q, ждали %q", id, p.Status, status)
+	}
+	return nil
+}
+
+func wantEq[T comparable](what string, got, want T) error {
+	if got != want {
+		return fmt.Errorf("%s: %v, ждали %v", what, got, want)
+	}
+	return nil
+}
+
+// ---- проверки ----
+
+func checkUpsert(r store.Repository) error {
+	a := post("-1_1", "первый пост", "https://sun9-1.userapi.com/a.jpg", "https://sun9-1.userapi.com/b.jpg")
+	a.Views, a.Comments, a.Reposts = 100, 3, 2
+	b := post("-1_2", "второй")
+
+	n, err := r.UpsertPosts([]store.Post{a, b})
+	if err != nil {
+		return err
+	}
+	if err := wantEq("inserted", n, 2); err != nil {
+		return err
+	}
+	a.Likes = 50
+	if n, err = r.UpsertPosts([]store.Post{a, b}); err != nil {
+		return err
+	}
+	if err := wantEq("inserted повторно", n, 0); err != nil {
+		return err
+	}
+
+	got, err := r.GetByVKFullID(a.VKFullID)
+	if err != nil {
+		return err
+	}
+	if got == nil {
+		return errors.New("пост не найден")
+	}
+	if got.Text != a.Text || got.Link != a.Link || got.VKOwnerID != "-1" || got.VKPostID != "1" ||
+		!slices.Equal(got.MediaURLs(), a.MediaURLs()) || got.Status != "new" || got.CreatedAt == 0 ||
+		got.VKDate != a.VKDate || got.Likes != 50 || got.Views != 100 || got.Comments != 3 || got.Reposts != 2 {
+		return fmt.Errorf("пост прочитался не так: %+v", *got)
+	}
+
+	missing, err := r.GetByVKFullID("-1_404")
+	if err != nil {
+		return err
+	}
+	if missing != nil {
+		return errors.New("несуществующий пост не nil")
+	}
+
+	stats, err := r.Stats()
+	if err != nil {
+		return err
+	}
+	return wantEq("stats new", stats["new"], 2)
+}
+
+func checkStatus(r store.Repository) error {
+	if err := upsert(r, post("-1_1", "a"), post("-1_2", "b"), post("-1_3", "c")); err != nil {
+		return err
+	}
+	if err := r.SetStatus("-1_2", "used"); err != nil {
+		return err
+	}
+	if err := r.SetStatus("-1_2", "reserved"); err == nil {
+		return errors.New("неизвестный статус принят")
+	}
+
+	p, err := r.GetByVKFullID("-1_2")
+	if err != nil {
+		return err
+	}
+	if p.Status != "used" || p.UsedAt == 0 {
+		return fmt.Errorf("после SetStatus used: %q, used_at=%d", p.Status, p.UsedAt)
+	}
+
+	n, err := r.CountByStatus("new")
+	if err != nil {
+		return err
+	}
+	if err := wantEq("CountByStatus new", n, 2); err != nil {
+		return err
+	}
+
+	page, err := r.ListByStatusPage("new", 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := wantEq("ListByStatusPage len", len(page), 1); err != nil {
+		return err
+	}
+	used, err := r.ListByStatusPage("used", 10, 0)
+	if err != nil {
+		return err
+	}
+	if len(used) != 1 || used[0].VKFullID != "-1_2" {
+		return fmt.Errorf("ListByStatusPage used: %d", len(used))
+	}
+	return nil
+}
+
+func checkSelectors(r store.Repository) error {
+	// пусто — nil без ошибки
+	for _, name := range store.SelectorNames {
+		sel, err := r.Selector(name, 3)
+		if err != nil {
+			return err
+		}
+		p, _, err := sel.Pick()
+		if err != nil {
+			return fmt.Errorf("%s на пустой базе: %w", name, err)
+		}
+		if p != nil {
+			return fmt.Errorf("%s на пустой базе вернул пост", name)
+		}
+	}
+
+	today := post("-1_1", "сегодня #кот")
+	today.VKDate = time.Now().AddDate(-2, 0, 0).Unix()
+	old := post("-2_1", "старый")
+	old.VKDate = time.Date(2015, 1, 10, 12, 0, 0, 0, time.Local).Unix()
+	if err := upsert(r, today, old, post("-2_2", "ещё")); err != nil {
+		return err
+	}
+	if err := r.SetStatus("-2_2", "used"); err != nil {
+		return err
+	}
+
+	for _, name := range store.SelectorNames {
+		sel, err := r.Selector(name, 3)
+		if err != nil {
+			return err
+		}
+		p, _, err := sel.Pick()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if p == nil || p.Status != "new" {
+			return fmt.Errorf("%s: не выбрал new-пост", name)
+		}
+		switch name {
+		case store.SelectOldest:
+			err = wantEq(name, p.VKFullID, "-2_1")
+		case store.SelectNewest, store.SelectToday:
+			err = wantEq(name, p.VKFullID, "-1_1")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	p, _, err := r.TagSelector("#Кот").Pick()
+	if err != nil {
+		return err
+	}
+	if p == nil || p.VKFullID != "-1_1" {
+		return errors.New("TagSelector не нашёл пост с тегом")
+	}
+
+	// roundrobin (источник -1 ещё не публиковался) и #кот выбирают из всех своих постов
+	if err := upsert(r, post("-1_2", "второй #кот")); err != nil {
+		return err
+	}
+	rr, err := r.Selector(store.SelectRoundRobin, 3)
+	if err != nil {
+		return err
+	}
+	for _, sel := range []store.Selector{rr, r.TagSelector("кот")} {
+		seen := map[string]bool{}
+		for range 40 {
+			p, _, err := sel.Pick()
+			if err != nil {
+				return fmt.Errorf("%s: %w", sel.Name(), err)
+			}
+			if p == nil {
+				return fmt.Errorf("%s: ничего не выбрал", sel.Name())
+			}
+			seen[p.VKFullID] = true
+		}
+		if len(seen) != 2 || !seen["-1_1"] || !seen["-1_2"] {
+			return fmt.Errorf("%s: выбраны %v, want -1_1 и -1_2", sel.Name(), seen)
+		}
+	}
+
+	if err := r.SetChatSelector(10, store.SelectOldest); err != nil {
+		return err
+	}
+	name, err := r.ChatSelector(10)
+	if err != nil {
+		return err
+	}
+	return wantEq("ChatSelector", name, store.SelectOldest)
+}
+
+// checkRandom: random (PickRandomNew) равномерен и при дырке из used между new
+func checkRandom(r store.Repository) error {
+	posts := make([]store.Post, 0, 100)
+	for i := 1; i <= 100; i++ {
+		posts = append(posts, post(fmt.Sprintf("-1_%d", i), "пост"))
+	}
+	if err := upsert(r, posts...); err != nil {
+		return err
+	}
+	for i := 2; i <= 99; i++ {
+		if err := r.SetStatus(fmt.Sprintf("-1_%d", i), "used"); err != nil {
+			return err
+		}
+	}
+
+	sel, err := r.Selector(store.SelectRandom, 0)
+	if err != nil {
+		return err
+	}
+	got := map[string]int{}
+	for range 2000 {
+		p, _, err := sel.Pick()
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			return errors.New("random: nil при двух new")
+		}
+		got[p.VKFullID]++
+	}
+	// по 1000 в среднем, σ ≈ 22
+	for _, id := range []string{"-1_1", "-1_100"} {
+		if got[id] < 850 || got[id] > 1150 {
+			return fmt.Errorf("random неравномерен: %v", got)
+		}
+	}
+	return nil
+}
+
+func checkSearch(r store.Repository) error {
+	if err := upsert(r,
+		post("-1_1", "Кот сидит на окне"),
+		post("-1_2", "котики и собаки"),
+		post("-1_3", "собака лает"),
+	); err != nil {
+		return err
+	}
+	if err := r.SetStatus("-1_2", "used"); err != nil {
+		return err
+	}
+
+	res, err := r.Search("кот", "", 10, 0)
+	if err != nil {
+		return err
+	}
+	if err := wantEq("Search кот", len(res), 2); err != nil {
+		return err
+	}
+	n, err := r.CountSearch("кот", "new")
+	if err != nil {
+		return err
+	}
+	if err := wantEq("CountSearch кот new", n, 1); err != nil {
+		return err
+	}
+	n, err = r.CountSearch("соба лает", "")
+	if err != nil {
+		return err
+	}
+	if err := wantEq("CountSearch соба лает", n, 1); err != nil {
+		return err
+	}
+	if res, err = r.Search(`" :*&|!`, "", 10, 0); err != nil {
+		return fmt.Errorf("спецсимволы в запросе: %w", err)
+	}
+	if err := wantEq("Search по спецсимволам", len(res), 0); err != nil {
+		return err
+	}
+
+	id, err := r.SaveSearchQuery(5, "кот")
+	if err != nil {
+		return err
+	}
+	q, err := r.SearchQuery(id)
+	if err != nil {
+		return err
+	}
+	if err := wantEq("SearchQuery", q, "кот"); err != nil {
+		return err
+	}
+	q, err = r.SearchQuery(id + 100)
+	if err != nil {
+		return err
+	}
+	return wantEq("SearchQuery неизвестный", q, "")
+}
+
+func checkPublications(r store.Repository) error {
+	if err := upsert(r, post("-1_1", "a"), post("-1_2", "b")); err != nil {
+		return err
+	}
+	const chat = -100123
+
+	id1, err := r.MarkPublished(store.Publication{VKFullID: "-1_1", ChatID: chat, MessageIDs: []int{10, 11}, PublishedBy: 7, Caption: "a"})
+	if err != nil {
+		return err
+	}
+	id2, err := r.MarkPublished(store.Publication{VKFullID: "-1_2", ChatID: chat, MessageIDs: []int{12}, PublishedBy: 7, Caption: "b"})
+	if err != nil {
+		return err
+	}
+	if id1 == 0 || id2 <= id1 {
+		return fmt.Errorf("id публикаций: %d, %d", id1, id2)
+	}
+	if err := wantStatus(r, "-1_1", "used"); err != nil {
+		return err
+	}
+
+	last, err := r.LastPublication(chat)
+	if err != nil {
+		return err
+	}
+	if last == nil || last.ID != id2 || !slices.Equal(last.MessageIDs, []int{12}) {
+		return fmt.Errorf("LastPublication: %+v", last)
+	}
+	inRange, err := r.ActivePublicationsInRange(chat, id1, id2)
+	if err != nil {
+		return err
+	}
+	if err := wantEq("ActivePublicationsInRange", len(inRange), 2); err != nil {
+		return err
+	}
+
+	if err := r.UpdatePublicationCaption(id1, "новая", 7); err != nil {
+		return err
+	}
+	pubs, err := r.ActivePublications("-1_1")
+	if err != nil {
+		return err
+	}
+	if len(pubs) != 1 || pubs[0].Caption != "новая" {
+		return fmt.Errorf("ActivePublications после правки подписи: %+v", pubs)
+	}
+
+	if err := r.UndoPublication(id2); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-1_2", "new"); err != nil {
+		return err
+	}
+	last, err = r.LastPublication(chat)
+	if err != nil {
+		return err
+	}
+	if last == nil || last.ID != id1 {
+		return errors.New("LastPublication после undo")
+	}
+	all, err := r.ListPublications("-1_2")
+	if err != nil {
+		return err
+	}
+	if len(all) != 1 || all[0].UndoneAt == 0 {
+		return errors.New("ListPublications: отменённая публикация потерялась")
+	}
+
+	// повторная отмена (двойное нажатие) уже отменённой публикации ничего не меняет:
+	// пост, который после отмены забанили, не возвращается в new
+	if err := r.SetStatus("-1_2", "banned"); err != nil {
+		return err
+	}
+	if err := r.UndoPublication(id2); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-1_2", "banned"); err != nil {
+		return fmt.Errorf("повторная отмена: %w", err)
+	}
+	return nil
+}
+
+func checkTags(r store.Repository) error {
+	if err := upsert(r, post("-1_1", "мем #Кот #пёс #кот")); err != nil {
+		return err
+	}
+	tags, err := r.PostTags("-1_1")
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(tags, []string{"кот", "пёс"}) {
+		return fmt.Errorf("auto-теги: %v", tags)
+	}
+
+	if err := r.AddPostTag("-1_1", "#Ручной"); err != nil {
+		return err
+	}
+	if err := r.RemovePostTag("-1_1", "пёс"); err != nil {
+		return err
+	}
+	// sync не вернёт снятый админом тег, хоть хэштег и остался в тексте, и не тронет ручной
+	if err := upsert(r, post("-1_1", "мем #кот #пёс")); err != nil {
+		return err
+	}
+	if tags, err = r.PostTags("-1_1"); err != nil {
+		return err
+	}
+	if !slices.Equal(tags, []string{"кот", "ручной"}) {
+		return fmt.Errorf("теги после sync: %v", tags)
+	}
+	if p, _, err := r.TagSelector("пёс").Pick(); err != nil || p != nil {
+		return fmt.Errorf("TagSelector по снятому тегу: %v, %v", p, err)
+	}
+	// вернуть можно только руками
+	if err := r.AddPostTag("-1_1", "пёс"); err != nil {
+		return err
+	}
+	if tags, err = r.PostTags("-1_1"); err != nil {
+		return err
+	}
+	if !slices.Equal(tags, []string{"кот", "пёс", "ручной"}) {
+		return fmt.Errorf("теги после AddPostTag: %v", tags)
+	}
+
+	if err := r.SetChatCaptionTags(10, true); err != nil {
+		return err
+	}
+	on, err := r.ChatCaptionTags(10)
+	if err != nil {
+		return err
+	}
+	off, err := r.ChatCaptionTags(11)
+	if err != nil {
+		return err
+	}
+	if !on || off {
+		return fmt.Errorf("ChatCaptionTags: %v, %v", on, off)
+	}
+	return nil
+}
+
+func checkAdmins(r store.Repository) error {
+	if err := r.SetAdmin(1, store.RoleEditor, 100); err != nil {
+		return err
+	}
+	role, err := r.AdminRole(1)
+	if err != nil {
+		return err
+	}
+	if err := wantEq("AdminRole", role, store.RoleEditor); err != nil {
+		return err
+	}
+
+	token, err := r.CreateInvite(store.RoleViewer, 100, time.Hour)
+	if err != nil {
+		return err
+	}
+	if role, err = r.UseInvite(token, 2); err != nil {
+		return err
+	}
+	if err := wantEq("UseInvite", role, store.RoleViewer); err != nil {
+		return err
+	}
+	if _, err := r.UseInvite(token, 3); !errors.Is(err, store.ErrInviteNotFound) {
+		return fmt.Errorf("повторный UseInvite: %v", err)
+	}
+
+	admins, err := r.ListAdmins()
+	if err != nil {
+		return err
+	}
+	if err := wantEq("ListAdmins", len(admins), 2); err != nil {
+		return err
+	}
+	ok, err := r.RemoveAdmin(2)
+	if err != nil {
+		return err
+	}
+	again, err := r.RemoveAdmin(2)
+	if err != nil {
+		return err
+	}
+	if !ok || again {
+		return fmt.Errorf("RemoveAdmin: %v, %v", ok, again)
+	}
+
+	// один токен одновременно у нескольких — роль получает ровно один
+	token, err = r.CreateInvite(store.RoleEditor, 100, time.Hour)
+	if err != nil {
+		return err
+	}
+	errs := make(chan error, 8)
+	var wg sync.WaitGroup
+	for i := range cap(errs) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.UseInvite(token, int64(10+i))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	used := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			used++
+		case !errors.Is(err, store.ErrInviteNotFound):
+			return fmt.Errorf("UseInvite наперегонки: %w", err)
+		}
+	}
+	return wantEq("UseInvite наперегонки: успешных", used, 1)
+}
+
+func checkTemplates(r store.Repository) error {
+	if err := r.SaveTemplateDraft(store.TemplateScopeDefault, "{{.Link}}", 1); err != nil {
+		return err
+	}
+	if err := r.ActivateTemplate(store.TemplateScopeDefault, 1); err != nil {
+		return err
+	}
+	if err := r.ActivateTemplate(store.TemplateScopeDefault, 1); !errors.Is(err, store.ErrNoDraft) {
+		return fmt.Errorf("ActivateTemplate без черновика: %v", err)
+	}
+	t, err := r.GetTemplate(store.TemplateScopeDefault)
+	if err != nil {
+		return err
+	}
+	if t == nil || t.Body != "{{.Link}}" || t.Draft != "" {
+		return fmt.Errorf("GetTemplate: %+v", t)
+	}
+	list, err := r.ListTemplates()
+	if err != nil {
+		return err
+	}
+	if err := wantEq("ListTemplates", len(list), 1); err != nil {
+		return err
+	}
+	if err := r.DeleteTemplate(store.TemplateScopeDefault); err != nil {
+		return err
+	}
+	if t, err = r.GetTemplate(store.TemplateScopeDefault); err != nil || t != nil {
+		return fmt.Errorf("GetTemplate после удаления: %+v, %v", t, err)
+	}
+
+	if err := r.SetSourceName("-1", "Паблик"); err != nil {
+		return err
+	}
+	name, err := r.SourceName("-1")
+	if err != nil {
+		return err
+	}
+	return wantEq("SourceName", name, "Паблик")
+}
+
+func checkRules(r store.Repository) error {
+	rule, err := r.AddRule(store.RuleKeyword, "розыгрыш", 1)
+	if err != nil {
+		return err
+	}
+	if rule.ID == 0 {
+		return errors.New("AddRule: id = 0")
+	}
+
+	kept, skipped, err := r.FilterPosts([]store.Post{post("-1_1", "Большой РОЗЫГРЫШ"), post("-1_2", "мем")})
+	if err != nil {
+		return err
+	}
+	if len(kept) != 1 || skipped[rule.ID] != 1 {
+		return fmt.Errorf("FilterPosts: kept=%d skipped=%v", len(kept), skipped)
+	}
+
+	// пост, загруженный до правила
+	if err := upsert(r, post("-1_3", "розыгрыш мемов"), post("-1_4", "мем")); err != nil {
+		return err
+	}
+	hits, err := r.DryRunRules()
+	if err != nil {
+		return err
+	}
+	if len(hits) != 1 || hits[0].Count != 1 {
+		return fmt.Errorf("DryRunRules: %+v", hits)
+	}
+	n, err := r.ApplyRules()
+	if err != nil {
+		return err
+	}
+	if err := wantEq("ApplyRules", n, 1); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-1_3", "banned"); err != nil {
+		return err
+	}
+
+	// бан поста, которого ещё нет, и разбан
+	if err := r.BanPost("-5_7"); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-5_7", "banned"); err != nil {
+		return err
+	}
+	if err := r.UnbanPost("-5_7"); err != nil {
+		return err
+	}
+	if p, err := r.GetByVKFullID("-5_7"); err != nil || p != nil {
+		return fmt.Errorf("заглушка после UnbanPost: %v, %v", p, err)
+	}
+	if err := r.UnbanPost("-1_3"); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-1_3", "new"); err != nil {
+		return err
+	}
+
+	if err := r.SetRuleEnabled(rule.ID, false); err != nil {
+		return err
+	}
+	rules, err := r.ListRules()
+	if err != nil {
+		return err
+	}
+	if len(rules) != 1 || rules[0].Enabled {
+		return fmt.Errorf("ListRules после выключения: %+v", rules)
+	}
+	if err := r.DeleteRule(rule.ID); err != nil {
+		return err
+	}
+	if err := r.DeleteRule(rule.ID); !errors.Is(err, store.ErrRuleNotFound) {
+		return fmt.Errorf("повторный DeleteRule: %v", err)
+	}
+	return nil
+}
+
+func checkRevisions(r store.Repository) error {
+	start := time.Now().Unix()
+	if err := upsert(r, post("-1_1", "было"), post("-1_2", "живой"), post("-1_3", "удалят")); err != nil {
+		return err
+	}
+	if err := upsert(r, post("-1_1", "стало")); err != nil {
+		return err
+	}
+
+	n, err := r.MarkDeleted([]string{"-1_3", "-1_404"})
+	if err != nil {
+		return err
+	}
+	if err := wantEq("MarkDeleted", n, 1); err != nil {
+		return err
+	}
+	live, err := r.LivePostIDs()
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(live, []string{"-1_1", "-1_2"}) {
+		return fmt.Errorf("LivePostIDs: %v", live)
+	}
+
+	edited, deleted, err := r.ChangesSince(start)
+	if err != nil {
+		return err
+	}
+	if edited != 1 || deleted != 1 {
+		return fmt.Errorf("ChangesSince: edited=%d deleted=%d", edited, deleted)
+	}
+
+	last, err := r.LastSyncRun()
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		return errors.New("LastSyncRun на пустой базе не nil")
+	}
+	if err := r.RecordSyncRun(store.SyncRun{Inserted: 3, Edited: 1, Deleted: 1}); err != nil {
+		return err
+	}
+	if last, err = r.LastSyncRun(); err != nil {
+		return err
+	}
+	if last == nil || last.At == 0 || last.Inserted != 3 || last.Edited != 1 || last.Deleted != 1 {
+		return fmt.Errorf("LastSyncRun: %+v", last)
+	}
+	return nil
+}
+
+func checkMedia(r store.Repository) error {
+	p := post("-1_1", "фото", "https://sun9-1.userapi.com/a.jpg?sign=1", "https://sun9-1.userapi.com/b.jpg")
+	p.Media[0].VKPhotoID, p.Media[0].Width, p.Media[0].Height = "-1_10", 1280, 960
+	p.Media[0].ThumbURL = "https://sun9-1.userapi.com/a_s.jpg"
+	if err := upsert(r, p); err != nil {
+		return err
+	}
+	if _, _, err := r.HashPendingThumbs(func(string) (uint64, error) { return 42, nil }); err != nil {
+		return err
+	}
+	if err := r.SetMediaFileIDs(p.VKFullID, []string{"AgAD1", "AgAD2"}); err != nil {
+		return err
+	}
+
+	// то же фото с новой подписью — хэш и file_id остаются; второе фото сменилось — сбрасываются
+	p.Media[0].URL = "https://sun9-2.userapi.com/a.jpg?sign=2"
+	p.Media[1].URL = "https://sun9-1.userapi.com/c.jpg"
+	if err := upsert(r, p); err != nil {
+		return err
+	}
+	got, err := r.GetByVKFullID(p.VKFullID)
+	if err != nil {
+		return err
+	}
+	if got == nil || len(got.Media) != 2 {
+		return fmt.Errorf("Media: %+v", got)
+	}
+	m0, m1 := got.Media[0], got.Media[1]
+	if m0.URL != p.Media[0].URL || m0.VKPhotoID != "-1_10" || m0.Width != 1280 || m0.Height != 960 ||
+		m0.Type != store.MediaPhoto || m0.Status != store.MediaOK || !m0.HasPHash || m0.PHash != 42 || m0.TGFileID != "AgAD1" {
+		return fmt.Errorf("первое фото: %+v", m0)
+	}
+	if m1.URL != p.Media[1].URL || m1.HasPHash || m1.TGFileID != "" {
+		return fmt.Errorf("второе фото: %+v", m1)
+	}
+
+	// фото стало меньше — лишние строки уходят
+	p.Media = p.Media[:1]
+	if err := upsert(r, p); err != nil {
+		return err
+	}
+	if got, err = r.GetByVKFullID(p.VKFullID); err != nil {
+		return err
+	}
+	if !slices.Equal(got.MediaURLs(), []string{p.Media[0].URL}) {
+		return fmt.Errorf("MediaURLs: %v", got.MediaURLs())
+	}
+
+	if err := r.ClearMediaFileIDs(p.VKFullID); err != nil {
+		return err
+	}
+	if got, err = r.GetByVKFullID(p.VKFullID); err != nil {
+		return err
+	}
+	if err := wantEq("tg_file_id после Clear", got.Media[0].TGFileID, ""); err != nil {
+		return err
+	}
+
+	// nil — фото неизвестны, остаются; пустой список — в VK фото из поста убрали
+	p.Media = nil
+	if err := upsert(r, p); err != nil {
+		return err
+	}
+	if got, err = r.GetByVKFullID(p.VKFullID); err != nil {
+		return err
+	}
+	if err := wantEq("фото после Media=nil", len(got.Media), 1); err != nil {
+		return err
+	}
+	p.Media = []store.Media{}
+	if err := upsert(r, p); err != nil {
+		return err
+	}
+	if got, err = r.GetByVKFullID(p.VKFullID); err != nil {
+		return err
+	}
+	return wantEq("фото после пустого Media", len(got.Media), 0)
+}
+
+func checkDupes(r store.Repository) error {
+	thumb := func(p store.Post, urls ...string) store.Post {
+		for i, u := range urls {
+			p.Media[i].ThumbURL = u
+		}
+		return p
+	}
+	if err := upsert(r,
+		thumb(post("-1_1", "оригинал"), "https://t/a.jpg"),
+		thumb(post("-2_1", "репост"), "https://t/a2.jpg"),
+		thumb(post("-3_1", "другое"), "https://t/b.jpg"),
+		thumb(post("-7_1", "пересжатый"), "https://t/a4.jpg"),
+		thumb(post("-8_1", "почти такой же"), "https://t/a5.jpg"),
+	); err != nil {
+		return err
+	}
+
+	hashes := map[string]uint64{
+		"https://t/a.jpg":  0xF0F0F0F0F0F0F0F0,
+		"https://t/a2.jpg": 0xF0F0F0F0F0F0F0F1, // расстояние 1
+		"https://t/b.jpg":  0x0F0F0F0F0F0F0F0F,
+		"https://t/a4.jpg": 0xF0F0F0F0F0F0F0F0 ^ 0x0003000300010001, // 6: по битам в каждом куске
+		"https://t/a5.jpg": 0xF0F0F0F0F0F0F0F0 ^ 0x7000700001000000, // 7: уже не дубль
+	}
+	hashed, failed, err := r.HashPendingThumbs(func(u string) (uint64, error) {
+		if h, ok := hashes[u]; ok {
+			return h, nil
+		}
+		return 0, errors.New("404")
+	})
+	if err != nil {
+		return err
+	}
+	if hashed != 5 || failed != 0 {
+		return fmt.Errorf("HashPendingThumbs: hashed=%d failed=%d", hashed, failed)
+	}
+
+	clusters, err := r.DupeClusters(10)
+	if err != nil {
+		return err
+	}
+	if len(clusters) != 1 || len(clusters[0].Posts) != 3 {
+		return fmt.Errorf("DupeClusters: %d", len(clusters))
+	}
+
+	id, err := r.MarkPublished(store.Publication{VKFullID: "-1_1", ChatID: 1, MessageIDs: []int{1}})
+	if err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-2_1", "duplicate"); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-7_1", "duplicate"); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-8_1", "new"); err != nil {
+		return err
+	}
+	if err := r.UndoPublication(id); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-2_1", "new"); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-7_1", "new"); err != nil {
+		return err
+	}
+
+	// хэши посчитаны после публикации: поздний репост опубликованного и пост,
+	// опубликованный до подсчёта хэшей, — дубли находятся после HashPendingThumbs
+	if _, err := r.MarkPublished(store.Publication{VKFullID: "-1_1", ChatID: 1, MessageIDs: []int{2}}); err != nil {
+		return err
+	}
+	if err := upsert(r,
+		thumb(post("-4_1", "поздний репост"), "https://t/a3.jpg"),
+		thumb(post("-5_1", "опубликован сразу"), "https://t/c.jpg"),
+		thumb(post("-6_1", "его копия"), "https://t/c2.jpg"),
+	); err != nil {
+		return err
+	}
+	if _, err := r.MarkPublished(store.Publication{VKFullID: "-5_1", ChatID: 1, MessageIDs: []int{3}}); err != nil {
+		return err
+	}
+	hashes["https://t/a3.jpg"] = 0xF0F0F0F0F0F0F0F3 // расстояние 2 до a
+	hashes["https://t/c.jpg"] = 0x00FF00FF00FF00FF
+	hashes["https://t/c2.jpg"] = 0x00FF00FF00FF00FE
+	if _, _, err := r.HashPendingThumbs(func(u string) (uint64, error) { return hashes[u], nil }); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-4_1", "duplicate"); err != nil {
+		return err
+	}
+	return wantStatus(r, "-6_1", "duplicate")
+}
+
+func checkExport(r store.Repository) error {
+	if err := upsert(r, post("-1_1", "экспорт #тег"), post("-1_2", "второй")); err != nil {
+		return err
+	}
+	if _, err := r.MarkPublished(store.Publication{VKFullID: "-1_1", ChatID: 1, MessageIDs: []int{5}}); err != nil {
+		return err
+	}
+	mirror, err := r.AddDestination(store.Destination{ChatID: 7, Name: "mirror"})
+	if err != nil {
+		return err
+	}
+	if _, err := r.MarkPublished(store.Publication{VKFullID: "-1_2", ChatID: 7, MessageIDs: []int{6}}); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	n, err := r.ExportJSONL(&buf)
+	if err != nil {
+		return err
+	}
+	if err := wantEq("ExportJSONL", n, 2); err != nil {
+		return err
+	}
+
+	// тот же файл обратно — ничего не меняется
+	st, err := r.ImportJSONL(bytes.NewReader(buf.Bytes()), store.ConflictKeepLocal)
+	if err != nil {
+		return err
+	}
+	if st.Read != 2 || st.Inserted != 0 || st.Publications != 0 || st.Tags != 0 || st.Destinations != 0 {
+		return fmt.Errorf("повторный импорт: %+v", st)
+	}
+
+	var again bytes.Buffer
+	if _, err := r.ExportJSONL(&again); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		return errors.New("экспорт после импорта отличается")
+	}
+
+	// очередь назначения переезжает вместе с файлом; назначение заводится по chat_id
+	if err := r.DeleteDestination(mirror.ID); err != nil {
+		return err
+	}
+	if st, err = r.ImportJSONL(bytes.NewReader(buf.Bytes()), store.ConflictKeepLocal); err != nil {
+		return err
+	}
+	if err := wantEq("импорт статусов в назначениях", st.Destinations, 1); err != nil {
+		return err
+	}
+	d, err := r.DestinationByChat(7)
+	if err != nil {
+		return err
+	}
+	if d == nil || d.Name != "mirror" {
+		return fmt.Errorf("назначение после импорта: %+v", d)
+	}
+	if err := wantDestStats(r, d.ID, 1, 1); err != nil {
+		return fmt.Errorf("назначение после импорта: %w", err)
+	}
+
+	var csv bytes.Buffer
+	if n, err = r.ExportCSV(&csv); err != nil {
+		return err
+	}
+	if err := wantEq("ExportCSV", n, 2); err != nil {
+		return err
+	}
+	return wantEq("строк CSV", strings.Count(csv.String(), "\n"), 3)
+}
+
+func checkAudit(r store.Repository) error {
+	for i, e := range []store.AuditEntry{
+		{ActorID: 7, ChatID: 1, Action: "sync", Details: "+2"},
+		{ActorID: 7, ChatID: 1, Action: "publish", VKFullID: "-1_1", Details: "pub #1"},
+		{ActorID: 8, ChatID: 1, Action: "ban", VKFullID: "-1_2", Result: "db is locked"},
+		{ChatID: 1, Action: "publish", VKFullID: "-1_1", Details: "pub #2"},
+	} {
+		e.At = int64(100 + i)
+		if err := r.LogAction(e); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.CountAuditLog()
+	if err != nil {
+		return err
+	}
+	if err := wantEq("CountAuditLog", n, 4); err != nil {
+		return err
+	}
+
+	page, err := r.AuditLog(2, 1)
+	if err != nil {
+		return err
+	}
+	if len(page) != 2 || page[0].Action != "ban" || page[1].Action != "publish" {
+		return fmt.Errorf("AuditLog(2, 1): %+v", page)
+	}
+	if page[0].Result != "db is locked" || page[1].Result != store.AuditOK {
+		return fmt.Errorf("AuditLog result: %q, %q", page[0].Result, page[1].Result)
+	}
+
+	// журнал поста — новые сверху, действие бота с actor 0
+	byPost, err := r.PostAuditLog("-1_1", 5)
+	if err != nil {
+		return err
+	}
+	if len(byPost) != 2 || byPost[0].ActorID != 0 || byPost[0].Details != "pub #2" || byPost[1].ActorID != 7 {
+		return fmt.Errorf("PostAuditLog: %+v", byPost)
+	}
+	return nil
+}
+
+// checkOnThisDay: «в этот день» через Новый год — свежий пост совпадает по дню,
+// но в прошлые годы не попадает, а прошлогодний на границе окна попадает
+func checkOnThisDay(r store.Repository) error {
+	at := func(id string, y int, m time.Month, d int) store.Post {
+		p := post(id, "пост "+id)
+		p.VKDate = time.Date(y, m, d, 12, 0, 0, 0, time.Local).Unix()
+		return p
+	}
+	pick := func(day time.Time) (string, bool, error) {
+		p, matched, err := r.PickOnThisDay(day, 3)
+		if err != nil || p == nil {
+			return "", matched, err
+		}
+		return p.VKFullID, matched, nil
+	}
+	jan2 := time.Date(2027, 1, 2, 9, 0, 0, 0, time.Local)
+
+	// 30 декабря — три дня назад, а не «год назад»
+	if err := upsert(r, at("-1_1", 2026, 12, 30)); err != nil {
+		return err
+	}
+	if _, matched, err := pick(jan2); err != nil || matched {
+		return fmt.Errorf("2 января: пост от 30.12 прошлого года совпал (%v, %v)", matched, err)
+	}
+
+	if err := upsert(r, at("-1_2", 2025, 12, 31)); err != nil {
+		return err
+	}
+	id, matched, err := pick(jan2)
+	if err != nil {
+		return err
+	}
+	if !matched || id != "-1_2" {
+		return fmt.Errorf("2 января: %s, %v; ждали -1_2 из 2025", id, matched)
+	}
+
+	// 30 декабря: 2 января этого же года — год назад минус 3 дня, в окне
+	if err := r.SetStatus("-1_2", "used"); err != nil {
+		return err
+	}
+	if err := upsert(r, at("-1_3", 2026, 1, 2)); err != nil {
+		return err
+	}
+	if id, matched, err = pick(time.Date(2026, 12, 30, 9, 0, 0, 0, time.Local)); err != nil {
+		return err
+	}
+	if !matched || id != "-1_3" {
+		return fmt.Errorf("30 декабря: %s, %v; ждали -1_3 от 2 января", id, matched)
+	}
+	return nil
+}
+
+func checkReport(r store.Repository) error {
+	if err := upsert(r,
+		post("-1_1", "один"),
+		post("-1_2", "два", "https://t/a.jpg", "https://t/b.jpg"),
+		post("-1_3", "три"),
+		post("-2_1", "чужой"),
+	); err != nil {
+		return err
+	}
+	if err := r.SetSourceName("-1", "Группа"); err != nil {
+		return err
+	}
+
+	day := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+	for _, pub := range []store.Publication{
+		{VKFullID: "-1_1", ChatID: 1, MessageIDs: []int{1}, PublishedAt: day.Unix(), PublishedBy: 7, Caption: "abcd"},
+		{VKFullID: "-1_1", ChatID: 2, MessageIDs: []int{1}, PublishedAt: day.Unix() + 60, PublishedBy: 7, Caption: "ab"},
+		{VKFullID: "-1_2", ChatID: 1, MessageIDs: []int{2}, PublishedAt: day.AddDate(0, 0, 1).Unix(), Caption: "abc"},
+	} {
+		if _, err := r.MarkPublished(pub); err != nil {
+			return err
+		}
+	}
+	// отменённая и слишком старая не считаются
+	id, err := r.MarkPublished(store.Publication{VKFullID: "-1_3", ChatID: 1, MessageIDs: []int{3}, PublishedAt: day.Unix() + 120, PublishedBy: 8})
+	if err != nil {
+		return err
+	}
+	if err := r.UndoPublication(id); err != nil {
+		return err
+	}
+	if _, err := r.MarkPublished(store.Publication{VKFullID: "-2_1", ChatID: 1, MessageIDs: []int{4}, PublishedAt: day.AddDate(0, 0, -10).Unix(), PublishedBy: 9}); err != nil {
+		return err
+	}
+
+	rep, err := r.Report(day.AddDate(0, 0, -1).Unix(), 5)
+	if err != nil {
+		return err
+	}
+	if rep.Publications != 3 || rep.PublishedPosts != 2 || rep.AvgCaptionLen != 3 {
+		return fmt.Errorf("Report: pubs=%d posts=%d avg=%v", rep.Publications, rep.PublishedPosts, rep.AvgCaptionLen)
+	}
+	wantDaily := []store.DayCount{{Day: "2024-05-10", Count: 2}, {Day: "2024-05-11", Count: 1}}
+	if !slices.Equal(rep.Daily, wantDaily) {
+		return fmt.Errorf("Report.Daily: %+v", rep.Daily)
+	}
+	wantTop := []store.PublisherStat{{UserID: 7, Count: 2}, {UserID: 0, Count: 1}}
+	if !slices.Equal(rep.TopPublishers, wantTop) {
+		return fmt.Errorf("Report.TopPublishers: %+v", rep.TopPublishers)
+	}
+	wantSources := []store.SourceStat{
+		{OwnerID: "-1", Name: "Группа", Total: 3, New: 1, Used: 2},
+		{OwnerID: "-2", Total: 1, Used: 1},
+	}
+	if !slices.Equal(rep.Sources, wantSources) {
+		return fmt.Errorf("Report.Sources: %+v", rep.Sources)
+	}
+	wantPhotos := []store.PhotoCount{{Photos: 1, Posts: 3}, {Photos: 2, Posts: 1}}
+	if !slices.Equal(rep.Photos, wantPhotos) {
+		return fmt.Errorf("Report.Photos: %+v", rep.Photos)
+	}
+	return nil
+}
+
+func checkAlerts(r store.Repository) error {
+	const kind = "publish: telegram: Too Many Requests: retry after N"
+	for _, a := range []store.Alert{
+		{At: 100, Op: "publish", Kind: kind, VKFullID: "-1_1", Error: "retry after 5", Sent: true},
+		{At: 110, Op: "publish", Kind: kind, VKFullID: "-1_1", Error: "retry after 7"},
+		{At: 120, Op: "publish", Kind: kind, VKFullID: "-1_2", Error: "retry after 9", Sent: true},
+		{At: 130, Op: "sync", Kind: "sync: vk error N: boom", Error: "vk error 10: boom", Sent: true},
+		{At: 10, Op: "backup", Kind: "backup: disk full", Error: "disk full", Sent: true},
+	} {
+		if _, err := r.RecordAlert(a); err != nil {
+			return err
+		}
+	}
+
+	last, err := r.LastAlertSent(kind, "-1_1")
+	if err != nil {
+		return err
+	}
+	if err := wantEq("LastAlertSent", last, int64(100)); err != nil {
+		return err
+	}
+	if last, err = r.LastAlertSent(kind, "-1_3"); err != nil {
+		return err
+	}
+	if err := wantEq("LastAlertSent нет", last, int64(0)); err != nil {
+		return err
+	}
+	n, err := r.CountAlertsSent(100)
+	if err != nil {
+		return err
+	}
+	if err := wantEq("CountAlertsSent", n, 3); err != nil {
+		return err
+	}
+
+	if err := r.MuteAlerts(kind, 500); err != nil {
+		return err
+	}
+	if err := r.MuteAlerts(kind, 600); err != nil {
+		return err
+	}
+	until, err := r.AlertMutedUntil(kind)
+	if err != nil {
+		return err
+	}
+	if err := wantEq("AlertMutedUntil", until, int64(600)); err != nil {
+		return err
+	}
+	if until, err = r.AlertMutedUntil("sync: other"); err != nil {
+		return err
+	}
+	if err := wantEq("AlertMutedUntil нет", until, int64(0)); err != nil {
+		return err
+	}
+
+	groups, err := r.AlertSummary(50)
+	if err != nil {
+		return err
+	}
+	if len(groups) != 2 {
+		return fmt.Errorf("AlertSummary: %+v", groups)
+	}
+	g := groups[0]
+	if g.Kind != kind || g.Op != "publish" || g.Count != 3 || g.Sent != 2 || g.Posts != 2 || g.LastAt != 120 {
+		return fmt.Errorf("AlertSummary[0]: %+v", g)
+	}
+	if groups[1].Posts != 0 || groups[1].Count != 1 {
+		return fmt.Errorf("AlertSummary[1]: %+v", groups[1])
+	}
+
+	deleted, err := r.PruneAlerts(50)
+	if err != nil {
+		return err
+	}
+	if err := wantEq("PruneAlerts", deleted, 1); err != nil {
+		return err
+	}
+	// истёкший mute убран вместе со старыми сбоями
+	if until, err = r.AlertMutedUntil(kind); err != nil {
+		return err
+	}
+	if err := wantEq("AlertMutedUntil после PruneAlerts", until, int64(0)); err != nil {
+		return err
+	}
+
+	a, err := r.GetAlert(1 << 40)
+	if err != nil {
+		return err
+	}
+	if a != nil {
+		return fmt.Errorf("GetAlert нет: %+v", a)
+	}
+	return nil
+}
+
+func checkDestinations(r store.Repository) error {
+	if err := upsert(r, post("-1_1", "один"), post("-1_2", "два"), post("-1_3", "три")); err != nil {
+		return err
+	}
+	// -1_1 ушёл в основной канал ещё до того, как его завели назначением
+	if _, err := r.MarkPublished(store.Publication{VKFullID: "-1_1", ChatID: 100, MessageIDs: []int{1}}); err != nil {
+		return err
+	}
+
+	main, err := r.AddDestination(store.Destination{ChatID: 100, Name: "Main", Schedule: "18:00, 9:00"})
+	if err != nil {
+		return err
+	}
+	if main.Name != "main" || main.Schedule != "09:00,18:00" || !main.Enabled {
+		return fmt.Errorf("AddDestination: %+v", main)
+	}
+	mirror, err := r.AddDestination(store.Destination{ChatID: 200, Name: "mirror"})
+	if err != nil {
+		return err
+	}
+	if _, err := r.AddDestination(store.Destination{ChatID: 300, Name: "mirror"}); !errors.Is(err, store.ErrDestinationExists) {
+		return fmt.Errorf("AddDestination с тем же именем: %v", err)
+	}
+	if _, err := r.AddDestination(store.Destination{ChatID: 300, Name: "bad", Schedule: "25:00"}); err == nil {
+		return errors.New("AddDestination принял расписание 25:00")
+	}
+
+	// слоты расписания: последний не позже now, утром — вчерашний вечерний
+	morning := time.Date(2024, 5, 10, 8, 0, 0, 0, time.Local)
+	if err := wantEq("ScheduleSlot утром", store.ScheduleSlot(main.Schedule, morning), "2024-05-09 18:00"); err != nil {
+		return err
+	}
+	if err := wantEq("ScheduleSlot днём", store.ScheduleSlot(main.Schedule, morning.Add(4*time.Hour)), "2024-05-10 09:00"); err != nil {
+		return err
+	}
+	// слоты до заведения назначения не забираются, новый — ровно один раз
+	if ok, err := r.ClaimScheduleSlot(main.ID, "2000-01-01 09:00"); err != nil || ok {
+		return fmt.Errorf("ClaimScheduleSlot прошлого слота: %v, %v", ok, err)
+	}
+	if ok, err := r.ClaimScheduleSlot(main.ID, "2999-01-01 09:00"); err != nil || !ok {
+		return fmt.Errorf("ClaimScheduleSlot: %v, %v", ok, err)
+	}
+	if ok, err := r.ClaimScheduleSlot(main.ID, "2999-01-01 09:00"); err != nil || ok {
+		return fmt.Errorf("ClaimScheduleSlot второй раз: %v, %v", ok, err)
+	}
+
+	// старая публикация засчитана основному, зеркалу -1_1 ещё new
+	if err := wantDestStats(r, main.ID, 2, 1); err != nil {
+		return fmt.Errorf("main: %w", err)
+	}
+	if err := wantDestStats(r, mirror.ID, 3, 0); err != nil {
+		return fmt.Errorf("mirror: %w", err)
+	}
+
+	// публикация в зеркало не трогает очередь основного
+	if _, err := r.MarkPublished(store.Publication{VKFullID: "-1_2", ChatID: 200, MessageIDs: []int{2}}); err != nil {
+		return err
+	}
+	if err := wantDestStats(r, main.ID, 2, 1); err != nil {
+		return fmt.Errorf("main после зеркала: %w", err)
+	}
+	// и общую очередь чатов, которые не назначения
+	if err := wantStatus(r, "-1_2", "new"); err != nil {
+		return fmt.Errorf("общая очередь после зеркала: %w", err)
+	}
+	if p, err := r.GetDestPost(mirror.ID, "-1_2"); err != nil {
+		return err
+	} else if p == nil || p.Status != "used" || p.UsedAt == 0 {
+		return fmt.Errorf("GetDestPost(mirror): %+v", p)
+	}
+	// публикация в обычный чат не трогает очереди назначений
+	pub3, err := r.MarkPublished(store.Publication{VKFullID: "-1_3", ChatID: 999, MessageIDs: []int{3}})
+	if err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-1_3", "used"); err != nil {
+		return err
+	}
+	if err := wantDestStats(r, mirror.ID, 2, 1); err != nil {
+		return fmt.Errorf("mirror после обычного чата: %w", err)
+	}
+	if err := r.UndoPublication(pub3); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-1_3", "new"); err != nil {
+		return err
+	}
+	used, err := r.ListByDestStatusPage(mirror.ID, "used", 10, 0)
+	if err != nil {
+		return err
+	}
+	if len(used) != 1 || used[0].VKFullID != "-1_2" || used[0].Status != "used" {
+		return fmt.Errorf("ListByDestStatusPage(mirror, used): %+v", used)
+	}
+
+	// в основном осталось -1_2 и -1_3; -1_3 бан только в основном
+	if err := r.SetDestStatus("-1_3", main.ID, "banned"); err != nil {
+		return err
+	}
+	for _, name := range store.SelectorNames {
+		sel, err := r.DestSelector(name, 3, main.ID)
+		if err != nil {
+			return err
+		}
+		p, _, err := sel.Pick()
+		if err != nil {
+			return fmt.Errorf("DestSelector %s: %w", name, err)
+		}
+		if p == nil || p.VKFullID != "-1_2" {
+			return fmt.Errorf("DestSelector %s: %+v", name, p)
+		}
+	}
+	if n, err := r.CountByDestStatus(mirror.ID, "new"); err != nil {
+		return err
+	} else if err := wantEq("CountByDestStatus(mirror, new)", n, 2); err != nil {
+		return err
+	}
+
+	// отмена публикации в зеркало возвращает пост в его очередь
+	pubs, err := r.ActivePublications("-1_2")
+	if err != nil {
+		return err
+	}
+	if len(pubs) != 1 {
+		return fmt.Errorf("ActivePublications: %+v", pubs)
+	}
+	if err := r.UndoPublication(pubs[0].ID); err != nil {
+		return err
+	}
+	if err := wantDestStats(r, mirror.ID, 3, 0); err != nil {
+		return fmt.Errorf("mirror после undo: %w", err)
+	}
+	if err := wantStatus(r, "-1_2", "new"); err != nil {
+		return fmt.Errorf("общая очередь после undo в зеркале: %w", err)
+	}
+	// -1_1 ушёл в основной, пока тот не был назначением: отмена возвращает его и в общую очередь
+	pubs, err = r.ActivePublications("-1_1")
+	if err != nil {
+		return err
+	}
+	if len(pubs) != 1 {
+		return fmt.Errorf("ActivePublications(-1_1): %+v", pubs)
+	}
+	if err := r.UndoPublication(pubs[0].ID); err != nil {
+		return err
+	}
+	if err := wantStatus(r, "-1_1", "new"); err != nil {
+		return err
+	}
+	if err := wantDestStats(r, main.ID, 2, 0); err != nil {
+		return fmt.Errorf("main после undo: %w", err)
+	}
+	if _, err := r.MarkPublished(store.Publication{VKFullID: "-1_1", ChatID: 100, MessageIDs: []int{4}}); err != nil {
+		return err
+	}
+
+	// бан поста действует во всех назначениях
+	if err := r.BanPost("-1_2"); err != nil {
+		return err
+	}
+	stats, err := r.DestStats(mirror.ID)
+	if err != nil {
+		return err
+	}
+	if stats["banned"] != 1 || stats["new"] != 2 {
+		return fmt.Errorf("DestStats(mirror) после бана: %v", stats)
+	}
+
+	mirror.Enabled = false
+	mirror.Schedule = "12:00"
+	if err := r.UpdateDestination(*mirror); err != nil {
+		return err
+	}
+	d, err := r.DestinationByChat(200)
+	if err != nil {
+		return err
+	}
+	if d == nil || d.Enabled || d.Schedule != "12:00" {
+		return fmt.Errorf("DestinationByChat после Update: %+v", d)
+	}
+	if err := r.DeleteDestination(mirror.ID); err != nil {
+		return err
+	}
+	if err := r.DeleteDestination(mirror.ID); !errors.Is(err, store.ErrDestinationNotFound) {
+		return fmt.Errorf("DeleteDestination второй раз: %v", err)
+	}
+	list, err := r.ListDestinations()
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 || list[0].ID != main.ID {
+		return fmt.Errorf("ListDestinations: %+v", list)
+	}
+	return nil
+}
+
+func wantDestStats(r store.Repository, destID int64, wantNew, wantUsed int) error {
+	stats, err := r.DestStats(destID)
+	if err != nil {
+		return err
+	}
+	if stats["new"] != wantNew || stats["used"] != wantUsed {
+		return fmt.Errorf("DestStats: %v, ждали new=%d used=%d", stats, wantNew, wantUsed)
+	}
+	return nil
+}
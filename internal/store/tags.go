@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// источник тега
+const (
+	TagAuto    = "auto"    // хэштег из текста VK, пересчитывается на каждом sync
+	TagManual  = "manual"  // добавлен админом, sync его не трогает
+	TagRemoved = "removed" // снят админом: строка-заглушка, чтобы sync не вернул хэштег
+)
+
+var hashtagRe = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+// ExtractHashtags: хэштеги из текста, без '#', в нижнем регистре, без повторов.
+// "#мем@club123" -> "мем".
+func ExtractHashtags(text string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, m := range hashtagRe.FindAllStringSubmatch(text, -1) {
+		t := NormalizeTag(m[1])
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// NormalizeTag: "#Кот" -> "кот"
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+func (s *Store) ensureTagsSchema(ctx context.Context) error {
+	exists, err := s.tableExists(ctx, "post_tags")
+	if err != nil {
+		return err
+	}
+	fresh := !exists
+
+	_, err = s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS post_tags (
+  vk_full_id TEXT NOT NULL,
+  tag        TEXT NOT NULL,
+  source     TEXT NOT NULL DEFAULT 'auto',
+  created_at INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (vk_full_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag ON post_tags(tag);
+`)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return nil
+	}
+
+	// таблица новая — разбираем хэштеги у уже загруженных постов
+	rows, err := s.db.QueryContext(ctx, `SELECT vk_full_id, text FROM posts;`)
+	if err != nil {
+		return err
+	}
+	type item struct{ id, text string }
+	var items []item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.id, &it.text); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		if err := setAutoTags(tx, it.id, it.text, time.Now().Unix()); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// setAutoTags: заменяет auto-теги поста хэштегами из text; ручные и снятые админом
+// (TagRemoved) не трогает — на них INSERT упирается в конфликт
+func setAutoTags(tx *Tx, vkFullID, text string, now int64) error {
+	if _, err := tx.Exec(`DELETE FROM post_tags WHERE vk_full_id=? AND source='auto';`, vkFullID); err != nil {
+		return err
+	}
+	for _, t := range ExtractHashtags(text) {
+		if _, err := tx.Exec(`
+INSERT INTO post_tags (vk_full_id, tag, source, created_at)
+VALUES (?, ?, 'auto', ?)
+ON CONFLICT DO NOTHING;
+`, vkFullID, t, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PostTags: теги поста по алфавиту
+func (s *Store) PostTags(vkFullID string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT tag FROM post_tags WHERE vk_full_id=? AND source!='removed' ORDER BY tag;`, vkFullID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// AddPostTag: ручной тег; если такой был auto или снят — становится manual
+func (s *Store) AddPostTag(vkFullID, tag string) error {
+	tag = NormalizeTag(tag)
+	if tag == "" {
+		return nil
+	}
+	_, err := s.db.Exec(`
+INSERT INTO post_tags (vk_full_id, tag, source, created_at)
+VALUES (?, ?, 'manual', ?)
+ON CONFLICT(vk_full_id, tag) DO UPDATE SET source='manual';
+`, vkFullID, tag, time.Now().Unix())
+	return err
+}
+
+// RemovePostTag: снимает тег и запоминает это (TagRemoved) — sync не вернёт его,
+// даже если хэштег остался в тексте VK. Вернуть — AddPostTag.
+func (s *Store) RemovePostTag(vkFullID, tag string) error {
+	tag = NormalizeTag(tag)
+	if tag == "" {
+		return nil
+	}
+	_, err := s.db.Exec(`
+INSERT INTO post_tags (vk_full_id, tag, source, created_at)
+VALUES (?, ?, 'removed', ?)
+ON CONFLICT(vk_full_id, tag) DO UPDATE SET source='removed';
+`, vkFullID, tag, time.Now().Unix())
+	return err
+}
+
+// TagSelector: случайный new с тегом tag
+func (s *Store) TagSelector(tag string) Selector {
+	return tagSelector{s, NormalizeTag(tag), 0}
+}
+
+// DestTagSelector: то же в очереди назначения
+func (s *Store) DestTagSelector(tag string, destID int64) Selector {
+	return tagSelector{s, NormalizeTag(tag), destID}
+}
+
+type tagSelector struct {
+	s    *Store
+	tag  string
+	dest int64
+}
+
+func (t tagSelector) Name() string { return "#" + t.tag }
+
+func (t tagSelector) Pick() (*Post, string, error) {
+	p, err := t.s.pickRandom(t.dest, `
+  AND vk_full_id IN (SELECT vk_full_id FROM post_tags WHERE tag=? AND source!='removed')`, t.tag)
+	return p, t.Name(), err
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// области действия шаблона подписи, от частной к общей
+const (
+	TemplateScopeDefault = "default"
+	TemplateScopeSource  = "source:" // + vk owner_id
+	TemplateScopeChat    = "chat:"   // + telegram chat_id
+)
+
+var ErrNoDraft = errors.New("no template draft")
+
+// CaptionTemplate: Body — активный шаблон, Draft — сохранённый, но ещё не включённый
+type CaptionTemplate struct {
+	Scope     string
+	Body      string
+	Draft     string
+	UpdatedAt int64
+	UpdatedBy int64
+}
+
+func (s *Store) ensureTemplatesSchema(ctx context.Context) error {
+	_, err := s.db.ExecSchema(ctx, `
+CREATE TABLE IF NOT EXISTS caption_templates (
+  scope      TEXT PRIMARY KEY,
+  body       TEXT NOT NULL DEFAULT '',
+  draft      TEXT NOT NULL DEFAULT '',
+  updated_at INTEGER NOT NULL DEFAULT 0,
+  updated_by INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS sources (
+  owner_id   TEXT PRIMARY KEY,
+  name       TEXT NOT NULL DEFAULT '',
+  updated_at INTEGER NOT NULL DEFAULT 0
+);
+`)
+	return err
+}
+
+// GetTemplate: nil если для scope ничего нет
+func (s *Store) GetTemplate(scope string) (*CaptionTemplate, error) {
+	var t CaptionTemplate
+	err := s.db.QueryRow(`
+SELECT scope, body, draft, updated_at, updated_by
+FROM caption_templates
+WHERE scope=?;
+`, scope).Scan(&t.Scope, &t.Body, &t.Draft, &t.UpdatedAt, &t.UpdatedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *Store) ListTemplates() ([]CaptionTemplate, error) {
+	rows, err := s.db.Query(`
+SELECT scope, body, draft, updated_at, updated_by
+FROM caption_templates
+ORDER BY scope;
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []CaptionTemplate{}
+	for rows.Next() {
+		var t CaptionTemplate
+		if err := rows.Scan(&t.Scope, &t.Body, &t.Draft, &t.UpdatedAt, &t.UpdatedBy); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// SaveTemplateDraft: активный шаблон не трогаем, пока не вызван ActivateTemplate
+func (s *Store) SaveTemplateDraft(scope, draft string, by int64) error {
+	_, err := s.db.Exec(`
+INSERT INTO caption_templates (scope, draft, updated_at, updated_by)
+VALUES (?, ?, ?, ?)
+ON CONFLICT(scope) DO UPDATE SET draft=excluded.draft, updated_at=excluded.updated_at, updated_by=excluded.updated_by;
+`, scope, draft, time.Now().Unix(), by)
+	return err
+}
+
+func (s *Store) ActivateTemplate(scope string, by int64) error {
+	res, err := s.db.Exec(`
+UPDATE caption_templates
+SET body=draft, draft='', updated_at=?, updated_by=?
+WHERE scope=? AND draft<>'';
+`, time.Now().Unix(), by, scope)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNoDraft
+	}
+	return nil
+}
+
+func (s *Store) DeleteTemplate(scope string) error {
+	_, err := s.db.Exec(`DELETE FROM caption_templates WHERE scope=?;`, scope)
+	return err
+}
+
+// SourceName: человеческое имя стены, "" если ещё не знаем
+func (s *Store) SourceName(ownerID string) (string, error) {
+	var name string
+	err := s.db.QueryRow(`SELECT name FROM sources WHERE owner_id=?;`, ownerID).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return name, err
+}
+
+func (s *Store) SetSourceName(ownerID, name string) error {
+	_, err := s.db.Exec(`
+INSERT INTO sources (owner_id, name, updated_at)
+VALUES (?, ?, ?)
+ON CONFLICT(owner_id) DO UPDATE SET name=excluded.name, updated_at=excluded.updated_at;
+`, ownerID, name, time.Now().Unix())
+	return err
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,20 +19,38 @@ type Client struct {
 
 type WallItem struct {
 	ID          int          `json:"id"`
+	OwnerID     int          `json:"owner_id"`
+	Date        int64        `json:"date"`
+	Edited      int64        `json:"edited,omitempty"`
 	Text        string       `json:"text"`
 	Pinned      int          `json:"is_pinned,omitempty"`
 	Ads         int          `json:"marked_as_ads,omitempty"`
 	Attachments []Attachment `json:"attachments,omitempty"`
+
+	Likes    Counter `json:"likes"`
+	Reposts  Counter `json:"reposts"`
+	Views    Counter `json:"views"`
+	Comments Counter `json:"comments"`
+}
+
+type Counter struct {
+	Count int `json:"count"`
 }
 
 type Attachment struct {
-	Type  string `json:"type"`
-	Photo *Photo `json:"photo,omitempty"`
+	Type  string   `json:"type"`
+	Photo *Photo   `json:"photo,omitempty"`
+	Link  *LinkAtt `json:"link,omitempty"`
+}
+
+type LinkAtt struct {
+	URL string `json:"url"`
 }
 
 type Photo struct {
-	ID    int64       `json:"id"`
-	Sizes []PhotoSize `json:"sizes,omitempty"`
+	ID      int64       `json:"id"`
+	OwnerID int64       `json:"owner_id"`
+	Sizes   []PhotoSize `json:"sizes,omitempty"`
 }
 
 type PhotoSize struct {
@@ -45,7 +66,24 @@ type Post struct {
 	VKFullID  string
 	Link      string
 	Text      string
-	MediaURLs []string // <= до 10 ссылок на фото
+	Photos    []PostPhoto // <= 10
+	Links     []string    // ссылки из вложений-link
+
+	Date     int64 // unix, когда пост вышел в VK
+	EditedAt int64 // unix, 0 — не редактировался
+	Likes    int
+	Reposts  int
+	Views    int
+	Comments int
+}
+
+// PostPhoto: фото поста — самый большой размер и самый маленький (превью для перцептивного хэша)
+type PostPhoto struct {
+	ID       string // "<owner>_<id>"
+	URL      string
+	Width    int
+	Height   int
+	ThumbURL string
 }
 
 type wallGetResp struct {
@@ -59,6 +97,55 @@ type wallGetResp struct {
 	} `json:"error,omitempty"`
 }
 
+type wallGetByIDResp struct {
+	// до 5.136 — массив постов, в новых версиях — {"items": [...]}
+	Response json.RawMessage `json:"response"`
+	Error    *struct {
+		ErrorCode int    `json:"error_code"`
+		ErrorMsg  string `json:"error_msg"`
+	} `json:"error,omitempty"`
+}
+
+// Error: ошибка, которую вернул сам API VK (а не сеть)
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("vk error %d: %s", e.Code, e.Msg) }
+
+// ErrCodeAuth: «User authorization failed» — токен истёк или отозван
+const ErrCodeAuth = 5
+
+// OnCall: если задан — вызывается после каждого запроса к API VK с методом и кодом:
+// "ok", код ошибки VK ("6", "15", …) или "error" (сеть, битый ответ). Ставится один раз при старте.
+var OnCall func(method, code string)
+
+func observe(method string, vkCode int, err error) {
+	if OnCall == nil {
+		return
+	}
+	code := "ok"
+	switch {
+	case vkCode != 0:
+		code = strconv.Itoa(vkCode)
+	case err != nil:
+		code = "error"
+	}
+	OnCall(method, code)
+}
+
+var fullIDRe = regexp.MustCompile(`(?:^|wall)(-?\d+_\d+)(?:$|[^\d])`)
+
+// ParseFullID: "-123_456", "wall-123_456" или ссылка vk.com/wall-123_456 (в т.ч. ?w=wall-123_456)
+func ParseFullID(s string) (string, bool) {
+	m := fullIDRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
 func New(token, ownerID string) *Client {
 	return &Client{
 		Token:   token,
@@ -119,7 +206,10 @@ func (c *Client) FetchWall(limit int) ([]WallItem, error) {
 }
 
 // один запрос wall.get (count <= 100) с offset
-func (c *Client) fetchWallPage(count, offset int) ([]WallItem, int, error) {
+func (c *Client) fetchWallPage(count, offset int) (items []WallItem, total int, err error) {
+	vkCode := 0
+	defer func() { observe("wall.get", vkCode, err) }()
+
 	if count <= 0 {
 		count = 50
 	}
@@ -152,12 +242,110 @@ func (c *Client) fetchWallPage(count, offset int) ([]WallItem, int, error) {
 		return nil, 0, err
 	}
 	if data.Error != nil {
-		return nil, 0, fmt.Errorf("vk error %d: %s", data.Error.ErrorCode, data.Error.ErrorMsg)
+		vkCode = data.Error.ErrorCode
+		return nil, 0, &Error{Code: data.Error.ErrorCode, Msg: data.Error.ErrorMsg}
 	}
 
 	return data.Response.Items, data.Response.Count, nil
 }
 
+// FetchByIDs: wall.getById, fullIDs вида "-123_456"
+func (c *Client) FetchByIDs(fullIDs ...string) (items []WallItem, err error) {
+	if len(fullIDs) == 0 {
+		return nil, nil
+	}
+	vkCode := 0
+	defer func() { observe("wall.getById", vkCode, err) }()
+
+	u, _ := url.Parse("https://api.vk.com/method/wall.getById")
+	q := u.Query()
+	q.Set("posts", strings.Join(fullIDs, ","))
+	q.Set("access_token", c.Token)
+	q.Set("v", "5.131")
+	u.RawQuery = q.Encode()
+
+	req, _ := http.NewRequest("GET", u.String(), nil)
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data wallGetByIDResp
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	if data.Error != nil {
+		vkCode = data.Error.ErrorCode
+		return nil, &Error{Code: data.Error.ErrorCode, Msg: data.Error.ErrorMsg}
+	}
+
+	if err := json.Unmarshal(data.Response, &items); err == nil {
+		return items, nil
+	}
+	var wrapped struct {
+		Items []WallItem `json:"items"`
+	}
+	if err := json.Unmarshal(data.Response, &wrapped); err != nil {
+		return nil, err
+	}
+	return wrapped.Items, nil
+}
+
+// OwnerName: название группы (owner_id < 0) или имя пользователя
+func (c *Client) OwnerName(ownerID string) (name string, err error) {
+	id, err := strconv.ParseInt(ownerID, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("bad owner_id %q: %w", ownerID, err)
+	}
+
+	method := "users.get"
+	q := url.Values{}
+	if id < 0 {
+		method = "groups.getById"
+		q.Set("group_id", strconv.FormatInt(-id, 10))
+	} else {
+		q.Set("user_ids", ownerID)
+	}
+	q.Set("access_token", c.Token)
+	q.Set("v", "5.131")
+
+	vkCode := 0
+	defer func() { observe(method, vkCode, err) }()
+	resp, err := c.HTTP.Get("https://api.vk.com/method/" + method + "?" + q.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Response []struct {
+			Name      string `json:"name"`
+			FirstName string `json:"first_name"`
+			LastName  string `json:"last_name"`
+		} `json:"response"`
+		Error *struct {
+			ErrorCode int    `json:"error_code"`
+			ErrorMsg  string `json:"error_msg"`
+		} `json:"error,omitempty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+	if data.Error != nil {
+		vkCode = data.Error.ErrorCode
+		return "", &Error{Code: data.Error.ErrorCode, Msg: data.Error.ErrorMsg}
+	}
+	if len(data.Response) == 0 {
+		return "", fmt.Errorf("vk: owner %s not found", ownerID)
+	}
+	r := data.Response[0]
+	if r.Name != "" {
+		return r.Name, nil
+	}
+	return strings.TrimSpace(r.FirstName + " " + r.LastName), nil
+}
+
 // ExtractPosts: каждый VK-пост -> один Post с альбомом до 10 фоток
 func (c *Client) ExtractPosts(items []WallItem) []Post {
 	out := make([]Post, 0, len(items))
@@ -167,47 +355,71 @@ func (c *Client) ExtractPosts(items []WallItem) []Post {
 			continue
 		}
 
-		media := make([]string, 0, 10)
+		var links []string
+		photos := make([]PostPhoto, 0, 10)
 		for _, att := range it.Attachments {
+			if att.Type == "link" && att.Link != nil && att.Link.URL != "" {
+				links = append(links, att.Link.URL)
+				continue
+			}
 			if att.Type != "photo" || att.Photo == nil {
 				continue
 			}
-			u := bestPhotoURL(att.Photo)
-			if u == "" {
+			best := bestPhotoSize(att.Photo)
+			if best.URL == "" {
 				continue
 			}
-			media = append(media, u)
-			if len(media) == 10 {
+			photos = append(photos, PostPhoto{
+				ID:       fmt.Sprintf("%d_%d", att.Photo.OwnerID, att.Photo.ID),
+				URL:      best.URL,
+				Width:    best.Width,
+				Height:   best.Height,
+				ThumbURL: smallestPhotoURL(att.Photo),
+			})
+			if len(photos) == 10 {
 				break // лимит телеги
 			}
 		}
 
-		if len(media) == 0 {
+		if len(photos) == 0 {
 			continue
 		}
 
+		// wall.getById может вернуть пост чужой стены
+		ownerID := c.OwnerID
+		if it.OwnerID != 0 {
+			ownerID = strconv.Itoa(it.OwnerID)
+		}
+
 		vkPostID := fmt.Sprintf("%d", it.ID)
-		vkFull := fmt.Sprintf("%s_%s", c.OwnerID, vkPostID)
+		vkFull := fmt.Sprintf("%s_%s", ownerID, vkPostID)
 		link := fmt.Sprintf("https://vk.com/wall%s", vkFull)
 
 		out = append(out, Post{
-			VKOwnerID: c.OwnerID,
+			VKOwnerID: ownerID,
 			VKPostID:  vkPostID,
 			VKFullID:  vkFull,
 			Link:      link,
 			Text:      it.Text,
-			MediaURLs: media,
+			Photos:    photos,
+			Links:     links,
+			Date:      it.Date,
+			EditedAt:  it.Edited,
+			Likes:     it.Likes.Count,
+			Reposts:   it.Reposts.Count,
+			Views:     it.Views.Count,
+			Comments:  it.Comments.Count,
 		})
 	}
 
 	return out
 }
 
-func bestPhotoURL(p *Photo) string {
+func bestPhotoSize(p *Photo) PhotoSize {
+	var best PhotoSize
 	if p == nil || len(p.Sizes) == 0 {
-		return ""
+		return best
 	}
-	bestURL := ""
 	bestArea := -1
 	for _, s := range p.Sizes {
 		if s.URL == "" {
@@ -216,8 +428,25 @@ func bestPhotoURL(p *Photo) string {
 		area := s.Width * s.Height
 		if area > bestArea {
 			bestArea = area
-			bestURL = s.URL
+			best = s
+		}
+	}
+	return best
+}
+
+// smallestPhotoURL: превью для хэша, качать оригинал незачем
+func smallestPhotoURL(p *Photo) string {
+	smallURL := ""
+	smallArea := -1
+	for _, s := range p.Sizes {
+		if s.URL == "" {
+			continue
+		}
+		area := s.Width * s.Height
+		if smallArea < 0 || area < smallArea {
+			smallArea = area
+			smallURL = s.URL
 		}
 	}
-	return bestURL
+	return smallURL
 }
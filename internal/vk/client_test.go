@@ -0,0 +1,79 @@
+package vk
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// roundTrip: ответ API без сети
+type roundTrip func(*http.Request) (*http.Response, error)
+
+func (f roundTrip) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func fakeClient(body string) *Client {
+	c := New("token", "-1")
+	c.HTTP.Transport = roundTrip(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})
+	return c
+}
+
+// кусок настоящего ответа wall.get v5.131: у старого поста нет views и edited
+const wallGetBody = `{"response":{"count":2,"items":[
+{"id":10,"owner_id":-1,"from_id":-1,"date":1700000000,"edited":1700003600,"text":"свежий",
+ "attachments":[{"type":"photo","photo":{"id":5,"owner_id":-1,"sizes":[
+   {"type":"s","url":"https://sun9-1.userapi.com/s.jpg","width":75,"height":50},
+   {"type":"w","url":"https://sun9-1.userapi.com/w.jpg","width":1280,"height":853}]}}],
+ "comments":{"can_post":1,"count":3},"likes":{"can_like":1,"count":42,"user_likes":0},
+ "reposts":{"count":7,"user_reposted":0},"views":{"count":1500}},
+{"id":9,"owner_id":-1,"date":1400000000,"text":"старый",
+ "attachments":[{"type":"photo","photo":{"id":4,"owner_id":-1,"sizes":[
+   {"type":"x","url":"https://sun9-1.userapi.com/x.jpg","width":604,"height":403}]}}],
+ "likes":{"count":1},"reposts":{"count":0}}
+]}}`
+
+func TestFetchWallPageCounters(t *testing.T) {
+	items, total, err := fakeClient(wallGetBody).fetchWallPage(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(items) != 2 {
+		t.Fatalf("count=%d, items=%d", total, len(items))
+	}
+
+	posts := New("token", "-1").ExtractPosts(items)
+	if len(posts) != 2 {
+		t.Fatalf("ExtractPosts: %d постов", len(posts))
+	}
+	p := posts[0]
+	if p.VKFullID != "-1_10" || p.Date != 1700000000 || p.EditedAt != 1700003600 ||
+		p.Likes != 42 || p.Reposts != 7 || p.Views != 1500 || p.Comments != 3 {
+		t.Fatalf("свежий пост: %+v", p)
+	}
+	if len(p.Photos) != 1 || p.Photos[0].URL != "https://sun9-1.userapi.com/w.jpg" ||
+		p.Photos[0].ThumbURL != "https://sun9-1.userapi.com/s.jpg" || p.Photos[0].ID != "-1_5" {
+		t.Fatalf("фото свежего поста: %+v", p.Photos)
+	}
+
+	// поля, которых нет в ответе, — нули, а не ошибка
+	old := posts[1]
+	if old.Date != 1400000000 || old.EditedAt != 0 || old.Likes != 1 || old.Views != 0 || old.Comments != 0 {
+		t.Fatalf("старый пост: %+v", old)
+	}
+}
+
+func TestFetchWallPageError(t *testing.T) {
+	_, _, err := fakeClient(`{"error":{"error_code":5,"error_msg":"User authorization failed"}}`).fetchWallPage(100, 0)
+	var vkErr *Error
+	if !errors.As(err, &vkErr) || vkErr.Code != ErrCodeAuth {
+		t.Fatalf("ошибка VK: %v", err)
+	}
+}